@@ -0,0 +1,189 @@
+package dirculese
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCommandTimeout is how long an external command is allowed to run when its configuration doesn't specify a
+// Timeout.
+const DefaultCommandTimeout = 60 * time.Second
+
+// commandOutputLimit is how many bytes of a command's output are kept for the log. Anything it prints after that is
+// dropped.
+const commandOutputLimit = 64 * 1024
+
+// commandGracePeriod is how long a command that's already running is given to finish once the run's context is done
+// (because the run was interrupted or used up its time budget) before it's killed.
+var commandGracePeriod = 10 * time.Second
+
+// CommandStageAction, CommandStagePreHook and CommandStagePostHook describe why an external command is being run. The
+// stage is passed to the command in the DIRCULESE_STAGE environment variable.
+const (
+	CommandStageAction   = "action"
+	CommandStagePreHook  = "pre-hook"
+	CommandStagePostHook = "post-hook"
+)
+
+// Command is an external program that a Rule runs for each file it matches, either as the rule's action or as one of
+// its hooks. Command.path is the program to execute and Command.args are its arguments, which may contain the
+// placeholders {file}, {name}, {source}, {target}, {size} and {modtime}. If Command.args is empty, the full path of the
+// file is passed as the only argument. The same values are always exported to the program as DIRCULESE_* environment
+// variables, along with the names of the rule and its directory (DIRCULESE_RULE and DIRCULESE_DIRECTORY). A command
+// that runs for longer than Command.timeout is killed, and a command that fails only stops the rule if
+// Command.failOnError is true.
+type Command struct {
+	path        string
+	args        []string
+	timeout     time.Duration
+	failOnError bool
+}
+
+// GetCommand creates a Command based on the contents of a CommandConfig struct. It returns nil if there is no
+// configuration, which means the rule doesn't use a command.
+func GetCommand(config *CommandConfig) (command *Command) {
+	if config == nil {
+		return
+	}
+	command = &Command{
+		path:        config.Path,
+		args:        config.Args,
+		timeout:     time.Duration(config.Timeout) * time.Second,
+		failOnError: config.FailOnError,
+	}
+	if command.timeout <= 0 {
+		command.timeout = DefaultCommandTimeout
+	}
+	return
+}
+
+// Run executes the command for a single file f that was matched by the rule r. filePath is the current full path of
+// the file and destination is the directory the rule would move it into (which is empty for rules that don't have a
+// target). Everything the command prints is captured and written to the log. The command is killed if it takes longer
+// than c.timeout, or if it's still running commandGracePeriod after ctx is done (e.g. because the run was interrupted),
+// so that the file it's run for is usually finished. An error is returned if the command couldn't be run successfully
+// and c.failOnError is true, or if it was killed because ctx is done, so that nothing else is done with the file.
+func (c *Command) Run(ctx context.Context, stage string, r *Rule, f os.FileInfo, filePath string, destination string) (err error) {
+	if c.path == "" {
+		return errors.New("you need to specify the path of the command to run")
+	}
+
+	values := map[string]string{
+		"file":    filePath,
+		"name":    f.Name(),
+		"source":  r.source.path,
+		"target":  destination,
+		"size":    strconv.FormatInt(f.Size(), 10),
+		"modtime": strconv.FormatInt(f.ModTime().Unix(), 10),
+	}
+
+	// every placeholder is replaced in a single pass, so that values which contain placeholders themselves (e.g. a
+	// file named "{size}.txt") are passed along as they are
+	var pairs []string
+	for key, value := range values {
+		pairs = append(pairs, "{"+key+"}", value)
+	}
+	replacer := strings.NewReplacer(pairs...)
+	var args []string
+	if len(c.args) == 0 {
+		args = []string{filePath}
+	}
+	for _, arg := range c.args {
+		args = append(args, replacer.Replace(arg))
+	}
+
+	// the command isn't stopped as soon as ctx is done, so that it can finish what it's doing to the file
+	runCtx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	finished := make(chan struct{})
+	defer close(finished)
+	gracePeriod := commandGracePeriod
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-finished:
+			return
+		}
+		select {
+		case <-time.After(gracePeriod):
+			cancel()
+		case <-finished:
+		}
+	}()
+
+	cmd := exec.CommandContext(runCtx, c.path, args...)
+	cmd.Env = os.Environ()
+	for key, value := range values {
+		cmd.Env = append(cmd.Env, "DIRCULESE_"+strings.ToUpper(key)+"="+value)
+	}
+	cmd.Env = append(cmd.Env, "DIRCULESE_HANDLER="+r.handler, "DIRCULESE_STAGE="+stage, "DIRCULESE_RULE="+r.name, "DIRCULESE_DIRECTORY="+r.source.label())
+
+	output := &cappedBuffer{limit: commandOutputLimit}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	runErr := cmd.Run()
+	// runCtx is only cancelled before the command is done if the grace period ran out
+	interrupted := runErr != nil && runCtx.Err() == context.Canceled
+	switch {
+	case interrupted:
+		runErr = errors.New("stopped because the run was interrupted")
+	case runErr != nil && runCtx.Err() == context.DeadlineExceeded:
+		runErr = errors.New("timed out after " + c.timeout.String())
+	}
+
+	message := "Ran the command " + c.path + " (" + stage + ") for the file " + f.Name() + " in the path " + r.source.path
+	if runErr != nil {
+		message += " but it failed (" + runErr.Error() + ")"
+	}
+	message += "."
+	if trimmed := strings.TrimSpace(output.String()); trimmed != "" {
+		message += " Output: " + trimmed
+		if output.truncated {
+			message += " (truncated)"
+		}
+	}
+
+	entry := LogEntry{Level: LevelInfo, Action: ActionCommand, Source: filePath, Destination: destination, Message: message}
+	if runErr == nil {
+		r.log(entry)
+		return
+	}
+	if c.failOnError || interrupted {
+		return errors.New(message)
+	}
+	entry.Level = LevelWarn
+	r.log(entry)
+	return
+}
+
+// cappedBuffer is an io.Writer that keeps the first cappedBuffer.limit bytes written to it and quietly drops the rest,
+// so that a command which prints a lot can't use up the memory of the run. cappedBuffer.truncated is true if anything
+// was dropped.
+type cappedBuffer struct {
+	buffer    bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Write implements io.Writer. It never fails, so that the command doesn't notice its output is being dropped.
+func (b *cappedBuffer) Write(p []byte) (n int, err error) {
+	if room := b.limit - b.buffer.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buffer.Write(p)
+}
+
+// String returns what has been kept of the output.
+func (b *cappedBuffer) String() string {
+	return b.buffer.String()
+}
@@ -0,0 +1,157 @@
+package dirculese
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetCommand(t *testing.T) {
+	if got := GetCommand(nil); got != nil {
+		t.Errorf("Expected no command for an empty configuration. Got '%v'", got)
+	}
+
+	got := GetCommand(&CommandConfig{Path: "/bin/true", Args: []string{"{file}"}, FailOnError: true})
+	if got.path != "/bin/true" || got.args[0] != "{file}" || !got.failOnError {
+		t.Errorf("Command doesn't match its configuration. Got '%v'", got)
+	}
+	if got.timeout != DefaultCommandTimeout {
+		t.Errorf("Mismatch in timeout. Got '%v', want '%v'", got.timeout, DefaultCommandTimeout)
+	}
+
+	got = GetCommand(&CommandConfig{Path: "/bin/true", Timeout: 5})
+	if got.timeout != 5*time.Second {
+		t.Errorf("Mismatch in timeout. Got '%v', want '%v'", got.timeout, 5*time.Second)
+	}
+}
+
+func TestCommand_Run(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("this test needs a POSIX shell")
+	}
+
+	// get path to the directory the test is running in
+	_, dir, _, _ := runtime.Caller(0)
+	dir = filepath.FromSlash(strings.TrimRight(dir, "command_tes.go"))
+
+	testDirectory := Directory{path: dir + "testdata"}
+	testRule := Rule{name: "json", source: &testDirectory, handler: "ExtensionHandler"}
+	fileInfo, err := os.Stat(dir + "testdata" + string(os.PathSeparator) + "dirculese.test.json")
+	if err != nil {
+		t.Fatal("Couldn't stat the test configuration file: " + err.Error())
+	}
+	filePath := dir + "testdata" + string(os.PathSeparator) + "dirculese.test.json"
+	outputPath := dir + "testdata" + string(os.PathSeparator) + "command.out"
+	defer os.Remove(outputPath)
+
+	// the arguments and environment should both describe the file
+	command := Command{
+		path:    "/bin/sh",
+		args:    []string{"-c", `echo "$1 $DIRCULESE_NAME $DIRCULESE_STAGE $DIRCULESE_RULE" > "$2"`, "sh", "{file}", outputPath},
+		timeout: DefaultCommandTimeout,
+	}
+	if err = command.Run(context.Background(), CommandStageAction, &testRule, fileInfo, filePath, ""); err != nil {
+		t.Errorf("Command returned an error. Got '%v'", err)
+	}
+	output, _ := ioutil.ReadFile(outputPath)
+	want := filePath + " dirculese.test.json " + CommandStageAction + " json"
+	if got := strings.TrimSpace(string(output)); got != want {
+		t.Errorf("Mismatch in command output. Got '%v', want '%v'", got, want)
+	}
+
+	// non-zero exits are only errors when failOnError is set
+	command = Command{path: "/bin/sh", args: []string{"-c", "exit 3"}, timeout: DefaultCommandTimeout}
+	if err = command.Run(context.Background(), CommandStagePostHook, &testRule, fileInfo, filePath, ""); err != nil {
+		t.Errorf("Command returned an error without failOnError. Got '%v'", err)
+	}
+	command.failOnError = true
+	// the rule's label is added by whatever runs the rule, so the error doesn't have it
+	if err = command.Run(context.Background(), CommandStagePostHook, &testRule, fileInfo, filePath, ""); err == nil {
+		t.Error("Command didn't return an error for a non-zero exit with failOnError")
+	} else if strings.HasPrefix(err.Error(), "[") {
+		t.Errorf("The error of the command already has a label. Got '%v'", err)
+	}
+
+	// commands that take too long are killed
+	command = Command{path: "/bin/sh", args: []string{"-c", "exec sleep 5"}, timeout: 100 * time.Millisecond, failOnError: true}
+	err = command.Run(context.Background(), CommandStagePreHook, &testRule, fileInfo, filePath, "")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Command didn't time out. Got '%v'", err)
+	}
+
+	// a command that's running when the run is interrupted gets to finish, and isn't reported as failed
+	logger := &recorder{}
+	testDirectory.options = &Options{Logger: logger, ErrorLogger: logger}
+	ctx, cancel := context.WithCancel(context.Background())
+	command = Command{path: "/bin/sh", args: []string{"-c", `sleep 0.3; echo finished > "$1"`, "sh", outputPath}, timeout: DefaultCommandTimeout}
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err = command.Run(ctx, CommandStageAction, &testRule, fileInfo, filePath, ""); err != nil {
+		t.Errorf("Command that finished after the run was interrupted returned an error. Got '%v'", err)
+	}
+	if output, _ = ioutil.ReadFile(outputPath); strings.TrimSpace(string(output)) != "finished" {
+		t.Errorf("Command didn't finish after the run was interrupted. Got '%v'", string(output))
+	}
+	if len(logger.messages) != 1 || strings.Contains(logger.messages[0], "failed") {
+		t.Errorf("Command that finished after the run was interrupted was logged as failed. Got '%v'", logger.messages)
+	}
+
+	// commands that are still running once the grace period is over are stopped, and then the file is left alone even
+	// without failOnError
+	defer func(gracePeriod time.Duration) { commandGracePeriod = gracePeriod }(commandGracePeriod)
+	commandGracePeriod = 100 * time.Millisecond
+	command = Command{path: "/bin/sh", args: []string{"-c", "exec sleep 5"}, timeout: DefaultCommandTimeout}
+	started := time.Now()
+	err = command.Run(ctx, CommandStagePreHook, &testRule, fileInfo, filePath, "")
+	if err == nil || !strings.Contains(err.Error(), "interrupted") || time.Since(started) > 2*time.Second {
+		t.Errorf("Command wasn't stopped with the run. Got '%v' after %v", err, time.Since(started))
+	}
+}
+
+func TestCommand_RunPlaceholders(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("this test needs a POSIX shell")
+	}
+
+	dir, err := ioutil.TempDir("", "dirculese-command")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "{size}.txt")
+	if err = ioutil.WriteFile(filePath, []byte("12345"), 0644); err != nil {
+		t.Fatal("Couldn't create the test file: " + err.Error())
+	}
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal("Couldn't stat the test file: " + err.Error())
+	}
+	testRule := Rule{name: "placeholders", source: &Directory{path: dir}, handler: "ExtensionHandler"}
+	outputPath := filepath.Join(dir, "command.out")
+
+	// placeholders in the values that replace other placeholders are left alone
+	command := Command{
+		path:    "/bin/sh",
+		args:    []string{"-c", `echo "$1 $2" > "$3"`, "sh", "{name}", "{size}", outputPath},
+		timeout: DefaultCommandTimeout,
+	}
+	if err = command.Run(context.Background(), CommandStageAction, &testRule, fileInfo, filePath, ""); err != nil {
+		t.Errorf("Command returned an error. Got '%v'", err)
+	}
+	output, _ := ioutil.ReadFile(outputPath)
+	if got, want := strings.TrimSpace(string(output)), "{size}.txt 5"; got != want {
+		t.Errorf("Mismatch in command output. Got '%v', want '%v'", got, want)
+	}
+
+	// only the start of a long output is kept
+	command = Command{path: "/bin/sh", args: []string{"-c", "yes | head -c 1000000; exit 1"}, timeout: DefaultCommandTimeout, failOnError: true}
+	err = command.Run(context.Background(), CommandStageAction, &testRule, fileInfo, filePath, "")
+	if err == nil || len(err.Error()) > commandOutputLimit+1024 || !strings.HasSuffix(err.Error(), "(truncated)") {
+		t.Errorf("The output of the command wasn't truncated. Got %v bytes", len(fmt.Sprint(err)))
+	}
+}
@@ -0,0 +1,564 @@
+package dirculese
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfigError is a single problem with a dirculese configuration file. ConfigError.Path is the location of the problem
+// inside the configuration (e.g. Directories[0].Rules[1].Handler) and ConfigError.Line and ConfigError.Column point to
+// it in the file itself, if it's known. ConfigError.File is only set if the problem is in a file that was included by
+// the configuration file (see LoadConfigTree).
+type ConfigError struct {
+	File    string
+	Line    int
+	Column  int
+	Path    string
+	Message string
+}
+
+// Error formats a ConfigError as file:line:column: path: message, leaving out anything that isn't known.
+func (e ConfigError) Error() (message string) {
+	if e.File != "" {
+		message += e.File + ":"
+	}
+	if e.Line > 0 {
+		message += strconv.Itoa(e.Line) + ":" + strconv.Itoa(e.Column) + ": "
+	}
+	if e.Path != "" {
+		message += e.Path + ": "
+	}
+	return message + e.Message
+}
+
+// ConfigPosition is the line and column of a field or list item in a dirculese configuration file. ConfigPosition.File
+// is only set for fields that came from an included file.
+type ConfigPosition struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// ConfigErrors is a list of every problem that was found in a dirculese configuration file, so that they can all be
+// reported at once.
+type ConfigErrors []ConfigError
+
+// Error formats a ConfigErrors list with one problem per line.
+func (e ConfigErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, configError := range e {
+		messages[i] = configError.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// locate fills in the line and column of every error in the list from positions, which maps configuration paths to
+// their position in the file. Errors whose own path isn't in positions (e.g. a missing field) point to the closest
+// parent that is.
+func (e ConfigErrors) locate(positions map[string]ConfigPosition) {
+	for i := range e {
+		if e[i].Line > 0 {
+			continue
+		}
+		for configPath := e[i].Path; ; configPath = parentConfigPath(configPath) {
+			if position, ok := positions[configPath]; ok {
+				e[i].File, e[i].Line, e[i].Column = position.File, position.Line, position.Column
+				break
+			}
+			if configPath == "" {
+				break
+			}
+		}
+	}
+}
+
+// covers reports whether any of the errors in the list is about configPath or something that contains it.
+func (e ConfigErrors) covers(configPath string) bool {
+	for _, configError := range e {
+		if isInsideConfigPath(configPath, configError.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// sort orders the errors in the list by their position in the file, with errors in the configuration file itself before
+// errors in the files it includes. Errors without a position come first.
+func (e ConfigErrors) sort() {
+	sort.SliceStable(e, func(i int, j int) bool {
+		if e[i].File != e[j].File {
+			return e[i].File < e[j].File
+		}
+		return e[i].Line < e[j].Line || (e[i].Line == e[j].Line && e[i].Column < e[j].Column)
+	})
+}
+
+// joinConfigPath adds a field name to a configuration path.
+func joinConfigPath(configPath string, field string) string {
+	if configPath == "" {
+		return field
+	}
+	return configPath + "." + field
+}
+
+// indexConfigPath adds a list index to a configuration path.
+func indexConfigPath(configPath string, index int) string {
+	return configPath + "[" + strconv.Itoa(index) + "]"
+}
+
+// parentConfigPath removes the last field name or list index from a configuration path.
+func parentConfigPath(configPath string) string {
+	i := strings.LastIndexAny(configPath, ".[")
+	if i < 0 {
+		return ""
+	}
+	return configPath[:i]
+}
+
+// ParseJSONConfigTree parses the contents of a JSON configuration file into a tree of generic values (objects become
+// map[string]interface{}, lists become []interface{} and numbers become json.Number). It also returns the position of
+// every field and list item in the tree, keyed by its configuration path. Syntax errors are returned as ConfigErrors
+// that point to where the problem is.
+func ParseJSONConfigTree(data []byte) (tree interface{}, positions map[string]ConfigPosition, err error) {
+	parser := jsonTreeParser{data: data, decoder: json.NewDecoder(bytes.NewReader(data)), positions: make(map[string]ConfigPosition)}
+	parser.decoder.UseNumber()
+	tree, err = parser.value("")
+	if err == nil {
+		if _, trailingErr := parser.decoder.Token(); trailingErr != io.EOF {
+			err = errors.New("unexpected data after the end of the configuration")
+		}
+	}
+	if err != nil {
+		offset := parser.decoder.InputOffset()
+		if syntaxError, ok := err.(*json.SyntaxError); ok {
+			offset = syntaxError.Offset
+		}
+		line, column := lineAndColumn(data, int(offset))
+		return nil, nil, ConfigErrors{{Line: line, Column: column, Message: err.Error()}}
+	}
+	return tree, parser.positions, nil
+}
+
+// jsonTreeParser walks the tokens of a JSON document to build the tree returned by ParseJSONConfigTree.
+type jsonTreeParser struct {
+	data      []byte
+	decoder   *json.Decoder
+	positions map[string]ConfigPosition
+}
+
+// value parses the next value in the document, which is found at configPath.
+func (p *jsonTreeParser) value(configPath string) (value interface{}, err error) {
+	p.positions[configPath] = p.position()
+	token, err := p.decoder.Token()
+	if err != nil {
+		return
+	}
+	switch token {
+	case json.Delim('{'):
+		object := make(map[string]interface{})
+		for p.decoder.More() {
+			// errors about a field should point to its name rather than its value
+			position := p.position()
+			var key interface{}
+			key, err = p.decoder.Token()
+			if err != nil {
+				return
+			}
+			fieldPath := joinConfigPath(configPath, key.(string))
+			object[key.(string)], err = p.value(fieldPath)
+			if err != nil {
+				return
+			}
+			p.positions[fieldPath] = position
+		}
+		_, err = p.decoder.Token()
+		return object, err
+	case json.Delim('['):
+		list := make([]interface{}, 0)
+		for i := 0; p.decoder.More(); i++ {
+			var item interface{}
+			item, err = p.value(indexConfigPath(configPath, i))
+			if err != nil {
+				return
+			}
+			list = append(list, item)
+		}
+		_, err = p.decoder.Token()
+		return list, err
+	}
+	return token, nil
+}
+
+// position returns the line and column of the start of the next token in the document.
+func (p *jsonTreeParser) position() ConfigPosition {
+	offset := int(p.decoder.InputOffset())
+	for offset < len(p.data) && strings.IndexByte(" \t\r\n,:", p.data[offset]) >= 0 {
+		offset++
+	}
+	line, column := lineAndColumn(p.data, offset)
+	return ConfigPosition{Line: line, Column: column}
+}
+
+// lineAndColumn converts a byte offset in data into a line and column, both starting at 1.
+func lineAndColumn(data []byte, offset int) (line int, column int) {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	line = 1 + bytes.Count(data[:offset], []byte("\n"))
+	column = 1 + offset - (bytes.LastIndexByte(data[:offset], '\n') + 1)
+	return
+}
+
+// CheckConfigTree compares a tree of generic values (see ParseJSONConfigTree) with the Go type t that it is going to be
+// decoded into, and returns every field that t doesn't have and every value that has the wrong type. Field names are
+// matched case-insensitively, just like encoding/json does.
+func CheckConfigTree(tree interface{}, t reflect.Type, configPath string) (errs ConfigErrors) {
+	if tree == nil || t == reflect.TypeOf(json.RawMessage{}) {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return CheckConfigTree(tree, t.Elem(), configPath)
+	case reflect.Struct:
+		object, ok := tree.(map[string]interface{})
+		if !ok {
+			return ConfigErrors{{Path: configPath, Message: "should be an object"}}
+		}
+		for _, key := range sortedKeys(object) {
+			field, ok := configField(t, key)
+			if !ok {
+				errs = append(errs, ConfigError{Path: joinConfigPath(configPath, key), Message: "unknown field" + suggestion(key, configFieldNames(t))})
+				continue
+			}
+			errs = append(errs, CheckConfigTree(object[key], field.Type, joinConfigPath(configPath, key))...)
+		}
+	case reflect.Map:
+		object, ok := tree.(map[string]interface{})
+		if !ok {
+			return ConfigErrors{{Path: configPath, Message: "should be an object"}}
+		}
+		for _, key := range sortedKeys(object) {
+			errs = append(errs, CheckConfigTree(object[key], t.Elem(), joinConfigPath(configPath, key))...)
+		}
+	case reflect.Slice:
+		list, ok := tree.([]interface{})
+		if !ok {
+			return ConfigErrors{{Path: configPath, Message: "should be a list"}}
+		}
+		for i, item := range list {
+			errs = append(errs, CheckConfigTree(item, t.Elem(), indexConfigPath(configPath, i))...)
+		}
+	case reflect.String:
+		if _, ok := tree.(string); !ok {
+			return ConfigErrors{{Path: configPath, Message: "should be a string"}}
+		}
+	case reflect.Bool:
+		if _, ok := tree.(bool); !ok {
+			return ConfigErrors{{Path: configPath, Message: "should be true or false"}}
+		}
+	case reflect.Int, reflect.Int64:
+		number, ok := tree.(json.Number)
+		if _, err := number.Int64(); !ok || err != nil {
+			return ConfigErrors{{Path: configPath, Message: "should be a whole number"}}
+		}
+	}
+	return
+}
+
+// configField finds the field of the struct type t that a configuration key maps to, preferring an exact match over a
+// case-insensitive one.
+func configField(t reflect.Type, key string) (field reflect.StructField, ok bool) {
+	if field, ok = t.FieldByName(key); ok {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if strings.EqualFold(t.Field(i).Name, key) {
+			return t.Field(i), true
+		}
+	}
+	return
+}
+
+// configFieldNames returns the names of all the fields of the struct type t.
+func configFieldNames(t reflect.Type) (names []string) {
+	for i := 0; i < t.NumField(); i++ {
+		names = append(names, t.Field(i).Name)
+	}
+	return
+}
+
+// sortedKeys returns the keys of an object in alphabetical order, so that errors are always reported in the same order.
+func sortedKeys(object map[string]interface{}) (keys []string) {
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// suggestion returns a " (did you mean ...?)" hint if one of the candidates looks like a misspelling or abbreviation of
+// value, and an empty string otherwise.
+func suggestion(value string, candidates []string) string {
+	for _, candidate := range candidates {
+		lowerValue, lowerCandidate := strings.ToLower(value), strings.ToLower(candidate)
+		if editDistance(lowerValue, lowerCandidate) <= 1+len(value)/4 || (lowerValue != "" && strings.HasPrefix(lowerCandidate, lowerValue)) {
+			return " (did you mean " + candidate + "?)"
+		}
+	}
+	return ""
+}
+
+// editDistance returns the Levenshtein distance between two strings.
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+// ValidateConfig checks the settings in a DirectoriesConfig struct and returns every problem it finds: unknown
+// handlers, missing settings that a handler needs, invalid policies and commands, names that are used twice, and source
+// or target directories that don't exist.
+func ValidateConfig(config DirectoriesConfig) (errs ConfigErrors) {
+	return validateConfig(config, nil)
+}
+
+// validateConfig checks a configuration like ValidateConfig does, looking for its directories in the filesystem of
+// options (see Options.fileSystem).
+func validateConfig(config DirectoriesConfig, options *Options) (errs ConfigErrors) {
+	if len(config.Directories) < 1 {
+		errs = append(errs, ConfigError{Path: "Directories", Message: "your configuration file should include at least one directory"})
+	}
+	if config.Workers < 0 {
+		errs = append(errs, ConfigError{Path: "Workers", Message: "can't be negative"})
+	}
+	errs = append(errs, validateStability(config.Stability, "Stability")...)
+	errs = append(errs, validateLogging(config.Logging, "Logging")...)
+	errs = append(errs, validateWebhooks(config.Webhooks, "Webhooks")...)
+	directoryNames := make(map[string]string)
+	for i, directoryConf := range config.Directories {
+		directoryPath := indexConfigPath("Directories", i)
+		errs = append(errs, validateName(directoryConf.Name, joinConfigPath(directoryPath, "Name"), directoryNames)...)
+		if err := (&Directory{path: directoryConf.Path, options: options}).CheckPath(); err != nil {
+			errs = append(errs, ConfigError{Path: joinConfigPath(directoryPath, "Path"), Message: err.Error()})
+		}
+		if !oneOf(directoryConf.Hidden, "", HiddenIgnore, HiddenInclude, HiddenOnly) {
+			errs = append(errs, ConfigError{Path: joinConfigPath(directoryPath, "Hidden"), Message: "should be one of " + HiddenIgnore + ", " + HiddenInclude + " or " + HiddenOnly})
+		}
+		if !oneOf(directoryConf.Evaluation, "", EvaluationSequential, EvaluationFirstMatch) {
+			errs = append(errs, ConfigError{Path: joinConfigPath(directoryPath, "Evaluation"), Message: "should be one of " + EvaluationSequential + " or " + EvaluationFirstMatch})
+		}
+		errs = append(errs, validateStability(directoryConf.Stability, joinConfigPath(directoryPath, "Stability"))...)
+		ruleNames := make(map[string]string)
+		for j, ruleConf := range directoryConf.Rules {
+			rulePath := indexConfigPath(joinConfigPath(directoryPath, "Rules"), j)
+			errs = append(errs, validateName(ruleConf.Name, joinConfigPath(rulePath, "Name"), ruleNames)...)
+			errs = append(errs, validateRule(ruleConf, rulePath, options)...)
+			if ruleConf.Continue && directoryConf.Evaluation != EvaluationFirstMatch {
+				errs = append(errs, ConfigError{Path: joinConfigPath(rulePath, "Continue"), Message: "only applies to directories whose Evaluation is " + EvaluationFirstMatch})
+			}
+		}
+	}
+	return
+}
+
+// validateName checks the name of a directory or rule, which is found at configPath. Names are used to select
+// directories and rules with the -directories and -rules flags, so they can't contain commas or slashes and have to be
+// unique among their siblings, which are tracked in used (by name, along with where they're used).
+func validateName(name string, configPath string, used map[string]string) (errs ConfigErrors) {
+	if name == "" {
+		return
+	}
+	if strings.ContainsAny(name, ",/") {
+		errs = append(errs, ConfigError{Path: configPath, Message: "names can't contain commas or slashes"})
+	}
+	if other, ok := used[name]; ok {
+		errs = append(errs, ConfigError{Path: configPath, Message: "the name \"" + name + "\" is already used by " + parentConfigPath(other)})
+	} else {
+		used[name] = configPath
+	}
+	return
+}
+
+// validateRule checks the settings of a single rule, which is found at configPath, looking for its target in the
+// filesystem of options.
+func validateRule(ruleConf RuleConfig, configPath string, options *Options) (errs ConfigErrors) {
+	add := func(field string, message string) {
+		errs = append(errs, ConfigError{Path: joinConfigPath(configPath, field), Message: message})
+	}
+
+	errs = append(errs, validateHandler(ruleConf, configPath)...)
+
+	switch {
+	case ruleConf.Delete && ruleConf.Command != nil:
+		add("Command", "a rule can't both delete files and hand them to a command")
+	case !ruleConf.Delete && ruleConf.Command == nil && ruleConf.Target == "":
+		add("Target", "you need to specify a target directory (or set Delete or Command)")
+	case ruleConf.Target != "":
+		if err := (&Directory{path: ruleConf.Target, options: options}).CheckPath(); err != nil {
+			add("Target", err.Error())
+		}
+	}
+
+	if !oneOf(ruleConf.Symlinks, "", SymlinksSkip, SymlinksMove, SymlinksFollow, SymlinksClean) {
+		add("Symlinks", "should be one of "+SymlinksSkip+", "+SymlinksMove+", "+SymlinksFollow+" or "+SymlinksClean)
+	}
+	errs = append(errs, validateCommand(ruleConf.Command, joinConfigPath(configPath, "Command"))...)
+	errs = append(errs, validateCommand(ruleConf.PreHook, joinConfigPath(configPath, "PreHook"))...)
+	errs = append(errs, validateCommand(ruleConf.PostHook, joinConfigPath(configPath, "PostHook"))...)
+	errs = append(errs, validateWebhooks(ruleConf.Webhooks, joinConfigPath(configPath, "Webhooks"))...)
+	return
+}
+
+// validateHandler checks that a rule's handler is registered, decodes the rule's Options for it and lets the handler
+// check the rule's settings (see Handler.Validate). The rule is found at configPath.
+func validateHandler(ruleConf RuleConfig, configPath string) (errs ConfigErrors) {
+	if ruleConf.Handler == "" {
+		return ConfigErrors{{Path: joinConfigPath(configPath, "Handler"), Message: "you need to specify a handler (one of " + strings.Join(HandlerNames(), ", ") + ")"}}
+	}
+	handler, ok := LookupHandler(ruleConf.Handler)
+	if !ok {
+		return ConfigErrors{{Path: joinConfigPath(configPath, "Handler"), Message: "unrecognized handler \"" + ruleConf.Handler + "\"" + suggestion(ruleConf.Handler, HandlerNames())}}
+	}
+	options, errs := decodeHandlerOptions(handler, ruleConf.Options, joinConfigPath(configPath, "Options"))
+	if len(errs) > 0 {
+		return
+	}
+	for _, handlerError := range handler.Validate(ruleConf, options) {
+		handlerError.Path = joinConfigPath(configPath, handlerError.Path)
+		errs = append(errs, handlerError)
+	}
+	return
+}
+
+// validateCommand checks the settings of a command or hook, which is found at configPath.
+func validateCommand(commandConf *CommandConfig, configPath string) (errs ConfigErrors) {
+	if commandConf == nil {
+		return
+	}
+	if commandConf.Path == "" {
+		errs = append(errs, ConfigError{Path: joinConfigPath(configPath, "Path"), Message: "you need to specify the path of the command to run"})
+	} else if _, err := exec.LookPath(commandConf.Path); err != nil {
+		errs = append(errs, ConfigError{Path: joinConfigPath(configPath, "Path"), Message: err.Error()})
+	}
+	if commandConf.Timeout < 0 {
+		errs = append(errs, ConfigError{Path: joinConfigPath(configPath, "Timeout"), Message: "can't be negative"})
+	}
+	return
+}
+
+// validateStability checks the settings of a stability check, which is found at configPath.
+func validateStability(stabilityConf *StabilityConfig, configPath string) (errs ConfigErrors) {
+	if stabilityConf == nil {
+		return
+	}
+	for i, pattern := range stabilityConf.PartialPatterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			errs = append(errs, ConfigError{Path: indexConfigPath(joinConfigPath(configPath, "PartialPatterns"), i), Message: err.Error()})
+		}
+	}
+	if stabilityConf.SettleTime < 0 {
+		errs = append(errs, ConfigError{Path: joinConfigPath(configPath, "SettleTime"), Message: "can't be negative"})
+	}
+	return
+}
+
+// validateLogging checks the logging settings, which are found at configPath.
+func validateLogging(loggingConf *LoggingConfig, configPath string) (errs ConfigErrors) {
+	if loggingConf == nil {
+		return
+	}
+	if loggingConf.Level != "" {
+		if _, err := ParseLevel(loggingConf.Level); err != nil {
+			errs = append(errs, ConfigError{Path: joinConfigPath(configPath, "Level"), Message: "should be one of debug, info, warn or error"})
+		}
+	}
+	if !oneOf(strings.ToLower(loggingConf.Format), "", LogFormatText, LogFormatJSON) {
+		errs = append(errs, ConfigError{Path: joinConfigPath(configPath, "Format"), Message: "should be one of " + LogFormatText + " or " + LogFormatJSON})
+	}
+	for i, destinationConf := range loggingConf.Destinations {
+		destinationPath := indexConfigPath(joinConfigPath(configPath, "Destinations"), i)
+		destinationType, ok := LogDestinationType(destinationConf.Type)
+		if !ok {
+			errs = append(errs, ConfigError{Path: joinConfigPath(destinationPath, "Type"), Message: "should be one of " + LogDestinationFile + ", " + LogDestinationStderr + ", " + LogDestinationSyslog + " or " + LogDestinationJournald})
+		}
+		if destinationType == LogDestinationStderr && destinationConf.Path != "" {
+			errs = append(errs, ConfigError{Path: joinConfigPath(destinationPath, "Path"), Message: "doesn't apply to " + LogDestinationStderr})
+		}
+		settings := map[string]int{"MaxSize": destinationConf.MaxSize, "Interval": destinationConf.Interval, "MaxBackups": destinationConf.MaxBackups, "MaxBackupAge": destinationConf.MaxBackupAge}
+		for _, name := range []string{"MaxSize", "Interval", "MaxBackups", "MaxBackupAge"} {
+			// a negative MaxBackups keeps every backup
+			if settings[name] < 0 && name != "MaxBackups" {
+				errs = append(errs, ConfigError{Path: joinConfigPath(destinationPath, name), Message: "can't be negative"})
+			} else if ok && settings[name] != 0 && destinationType != LogDestinationFile {
+				errs = append(errs, ConfigError{Path: joinConfigPath(destinationPath, name), Message: "only applies to " + LogDestinationFile + " destinations"})
+			}
+		}
+		if ok && destinationConf.Compress && destinationType != LogDestinationFile {
+			errs = append(errs, ConfigError{Path: joinConfigPath(destinationPath, "Compress"), Message: "only applies to " + LogDestinationFile + " destinations"})
+		}
+	}
+	return
+}
+
+// validateWebhooks checks the settings of a list of webhooks, which is found at configPath.
+func validateWebhooks(webhookConfs []WebhookConfig, configPath string) (errs ConfigErrors) {
+	for i, webhookConf := range webhookConfs {
+		webhookPath := indexConfigPath(configPath, i)
+		add := func(field string, message string) {
+			errs = append(errs, ConfigError{Path: joinConfigPath(webhookPath, field), Message: message})
+		}
+		if webhookConf.URL == "" {
+			add("URL", "you need to specify the URL to send the webhook to")
+		} else if parsed, err := url.Parse(webhookConf.URL); err != nil || !oneOf(parsed.Scheme, "http", "https") || parsed.Host == "" {
+			add("URL", "should be an http or https URL")
+		}
+		if !oneOf(webhookConf.Events, "", WebhookEventsSummary, WebhookEventsFiles) {
+			add("Events", "should be one of "+WebhookEventsSummary+" or "+WebhookEventsFiles)
+		}
+		if webhookConf.Timeout < 0 {
+			add("Timeout", "can't be negative")
+		}
+		if webhookConf.Retries < 0 {
+			add("Retries", "can't be negative")
+		} else if webhookConf.Retries > MaxWebhookRetries {
+			add("Retries", "can't be more than "+strconv.Itoa(MaxWebhookRetries))
+		}
+		if _, err := GetWebhook(webhookConf); err != nil {
+			add("Body", err.Error())
+		}
+	}
+	return
+}
+
+// oneOf reports whether value is equal to any of the options.
+func oneOf(value string, options ...string) bool {
+	for _, option := range options {
+		if value == option {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package dirculese
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseJSONConfigTree(t *testing.T) {
+	data := []byte("{\n  \"Directories\": [\n    {\"Path\": \"/tmp\"}\n  ]\n}")
+	tree, positions, err := ParseJSONConfigTree(data)
+	if err != nil {
+		t.Fatalf("Couldn't parse valid JSON. Got '%v'", err)
+	}
+	if tree.(map[string]interface{})["Directories"].([]interface{})[0].(map[string]interface{})["Path"] != "/tmp" {
+		t.Errorf("Mismatch in tree. Got '%v'", tree)
+	}
+	want := map[string]ConfigPosition{
+		"Directories":         {Line: 2, Column: 3},
+		"Directories[0]":      {Line: 3, Column: 5},
+		"Directories[0].Path": {Line: 3, Column: 6},
+	}
+	for configPath, position := range want {
+		if positions[configPath] != position {
+			t.Errorf("Mismatch in the position of %v. Got '%v', want '%v'", configPath, positions[configPath], position)
+		}
+	}
+
+	_, _, err = ParseJSONConfigTree([]byte("{\n  \"Directories\": [\n    {\"Path\": \"/tmp\",}\n  ]\n}"))
+	errs, ok := err.(ConfigErrors)
+	if !ok || len(errs) != 1 || errs[0].Line != 3 {
+		t.Errorf("Syntax error wasn't reported on line 3. Got '%v'", err)
+	}
+}
+
+func TestCheckConfigTree(t *testing.T) {
+	data := []byte(`{"Directories": [{"Path": "/tmp", "Rules": [{"Extentions": ["png"], "handler": "Prefix", "Delete": "yes"}]}], "Directory": []}`)
+	tree, _, err := ParseJSONConfigTree(data)
+	if err != nil {
+		t.Fatalf("Couldn't parse valid JSON. Got '%v'", err)
+	}
+	want := []string{
+		"Directories[0].Rules[0].Delete: should be true or false",
+		"Directories[0].Rules[0].Extentions: unknown field (did you mean Extensions?)",
+		"Directory: unknown field (did you mean Directories?)",
+	}
+	got := CheckConfigTree(tree, reflect.TypeOf(DirectoriesConfig{}), "")
+	if got.Error() != strings.Join(want, "\n") {
+		t.Errorf("Mismatch in errors. Got '%v', want '%v'", got.Error(), strings.Join(want, "\n"))
+	}
+}
+
+func TestGetConfigStruct_Errors(t *testing.T) {
+	// get path to the directory the test is running in
+	_, dir, _, _ := runtime.Caller(0)
+	dir = filepath.FromSlash(strings.TrimRight(dir, "config_tes.go"))
+
+	configFile, err := ioutil.TempFile("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary configuration file: " + err.Error())
+	}
+	defer os.Remove(configFile.Name())
+	configFile.WriteString(`{
+  "Directories": [
+    {
+      "Path": "` + filepath.ToSlash(dir) + `testdata",
+      "Rules": [
+        {
+          "Target": "/PATH-DOES-NOT-EXIST",
+          "Handler": "Prefix",
+          "Extentions": ["png"]
+        },
+        {
+          "Delete": true,
+          "Handler": "ExtensionHandler"
+        }
+      ]
+    }
+  ]
+}`)
+	configFile.Close()
+
+	_, err = GetConfigStruct(configFile.Name(), "")
+	want := []string{
+		"7:11: Directories[0].Rules[0].Target: stat /PATH-DOES-NOT-EXIST: no such file or directory",
+		"8:11: Directories[0].Rules[0].Handler: unrecognized handler \"Prefix\" (did you mean PrefixHandler?)",
+		"9:11: Directories[0].Rules[0].Extentions: unknown field (did you mean Extensions?)",
+		"11:9: Directories[0].Rules[1].Extensions: you need to specify at least one extension",
+	}
+	if err == nil || err.Error() != strings.Join(want, "\n") {
+		t.Errorf("Mismatch in errors. Got '%v', want '%v'", err, strings.Join(want, "\n"))
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	// get path to the directory the test is running in
+	_, dir, _, _ := runtime.Caller(0)
+	dir = filepath.FromSlash(strings.TrimRight(dir, "config_tes.go"))
+
+	valid := DirectoriesConfig{Directories: []DirectoryConfig{{
+		Path: dir + "testdata",
+		Rules: []RuleConfig{
+			{Target: dir + "testdata", Handler: "ExtensionHandler", Extensions: []string{"png"}},
+			{Delete: true, Handler: "BrokenSymlinkHandler"},
+		},
+	}}}
+	if errs := ValidateConfig(valid); len(errs) > 0 {
+		t.Errorf("Valid configuration failed validation. Got '%v'", errs)
+	}
+
+	if errs := ValidateConfig(DirectoriesConfig{}); len(errs) != 1 {
+		t.Errorf("Empty configuration passed validation. Got '%v'", errs)
+	}
+
+	invalid := DirectoriesConfig{Logging: &LoggingConfig{
+		Level:        "loud",
+		Destinations: []LogDestinationConfig{{Type: "syslog", MaxSize: 5}, {Type: "Email"}},
+	}, Webhooks: []WebhookConfig{{URL: "ftp://example.com", Events: "All", Retries: -1}, {URL: "http://localhost", Retries: MaxWebhookRetries + 1}}, Directories: []DirectoryConfig{{
+		Name:   "Downloads,Desktop",
+		Path:   dir + "PATH-DOES-NOT-EXIST",
+		Hidden: "Sometimes",
+		Rules: []RuleConfig{
+			{Name: "images", Handler: "SuffixHandler", SuffixDelimiters: []string{""}, Symlinks: "Ignore", Continue: true},
+			{Name: "images", Handler: "ExtensionHandler", Extensions: []string{"png"}, Delete: true, Command: &CommandConfig{}, Webhooks: []WebhookConfig{{Body: "{{.Rule"}}},
+		},
+	}}}
+	want := []string{
+		"Logging.Level",
+		"Logging.Destinations[0].MaxSize",
+		"Logging.Destinations[1].Type",
+		"Webhooks[0].URL",
+		"Webhooks[0].Events",
+		"Webhooks[0].Retries",
+		"Webhooks[1].Retries",
+		"Directories[0].Name",
+		"Directories[0].Path",
+		"Directories[0].Hidden",
+		"Directories[0].Rules[0].SuffixDelimiters",
+		"Directories[0].Rules[0].Target",
+		"Directories[0].Rules[0].Symlinks",
+		"Directories[0].Rules[0].Continue",
+		"Directories[0].Rules[1].Name",
+		"Directories[0].Rules[1].Command",
+		"Directories[0].Rules[1].Command.Path",
+		"Directories[0].Rules[1].Webhooks[0].URL",
+		"Directories[0].Rules[1].Webhooks[0].Body",
+	}
+	errs := ValidateConfig(invalid)
+	var got []string
+	for _, configError := range errs {
+		got = append(got, configError.Path)
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Mismatch in errors. Got '%v', want '%v'", errs, want)
+	}
+}
@@ -0,0 +1,986 @@
+package dirculese
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultConfigFile is the name of the file in the user's home directory that older versions of dirculese used for
+// their configuration, which is still looked for (see ConfigSearchPaths). DefaultLogFile is the name of the file that
+// dirculese will log to (see GetLogFilePath).
+const (
+	DefaultConfigFile = ".dirculese.json"
+	DefaultLogFile    = "dirculese.log"
+)
+
+// ConfigFileNames is the list of files in the user's home directory that dirculese will look for (in order) when the
+// -config flag isn't used (see ConfigSearchPaths).
+var ConfigFileNames = []string{DefaultConfigFile, ".dirculese.yaml", ".dirculese.yml", ".dirculese.toml"}
+
+// DirectoriesConfig is a simple struct that is used to map to the top-level array of directories in a dirculese JSON
+// configuration file. DirectoriesConfig.Include, DirectoriesConfig.Variables and DirectoriesConfig.RuleTemplates are
+// resolved when the file is loaded (see GetConfigStruct), and DirectoriesConfig.Workers is how many directories and
+// files can be handled at the same time (see RunDirectories). DirectoriesConfig.Logging is where the dirculese command
+// logs to (see OpenLogDestinations), and DirectoriesConfig.Webhooks are sent a summary of every run or the files that
+// every rule moved and deleted (see Webhook).
+type DirectoriesConfig struct {
+	Directories   []DirectoryConfig
+	Stability     *StabilityConfig
+	Logging       *LoggingConfig
+	Webhooks      []WebhookConfig
+	Variables     map[string]string
+	RuleTemplates map[string]RuleConfig
+	Include       []string
+	Workers       int
+}
+
+// DirectoryConfig is a simple struct that is used to map to a single directory in a dirculese JSON configuration file.
+type DirectoryConfig struct {
+	Name        string
+	Description string
+	Enabled     *bool
+	Path        string
+	Rules       []RuleConfig
+	Stability   *StabilityConfig
+	Hidden      string
+	Evaluation  string
+}
+
+// RuleConfig is a simple struct that is used to map to a single rule in a dirculese JSON configuration file.
+// RuleConfig.Options holds the settings of the rule's handler (see Handler.Options), and is decoded once the handler is
+// known.
+type RuleConfig struct {
+	Name             string
+	Description      string
+	Enabled          *bool
+	Priority         int
+	Continue         bool
+	Template         string
+	Target           string
+	Delete           bool
+	Handler          string
+	Options          json.RawMessage
+	Extensions       []string
+	IgnoreCase       bool
+	PrefixDelimiters []string
+	SuffixDelimiters []string
+	SizeMax          int
+	SizeMin          int
+	DateMax          int
+	DateMin          int
+	Symlinks         string
+	Command          *CommandConfig
+	PreHook          *CommandConfig
+	PostHook         *CommandConfig
+	Webhooks         []WebhookConfig
+}
+
+// CommandConfig is a simple struct that is used to map to an external command (either a rule's action or one of its
+// hooks) in a dirculese JSON configuration file.
+type CommandConfig struct {
+	Path        string
+	Args        []string
+	Timeout     int
+	FailOnError bool
+}
+
+// WebhookConfig is a simple struct that is used to map to a webhook in a dirculese JSON configuration file, either at
+// the top level of the file or in a rule (see Webhook).
+type WebhookConfig struct {
+	URL     string
+	Events  string
+	Secret  string
+	Timeout int
+	Retries int
+	Headers map[string]string
+	Body    string
+}
+
+// StabilityConfig is a simple struct that is used to map to the stability check of a dirculese JSON configuration file.
+// It can be set for all directories at the top level of the file and overridden for individual directories.
+type StabilityConfig struct {
+	PartialPatterns []string
+	SettleTime      int
+	SkipOpen        bool
+}
+
+// LoggingConfig is a simple struct that is used to map to the logging settings of a dirculese JSON configuration file.
+// LoggingConfig.Level and LoggingConfig.Format are the level and format of the log (see ParseLevel and NewLogWriter),
+// and LoggingConfig.Destinations are where it's written to, which is the log file (see GetLogFilePath) if there aren't
+// any.
+type LoggingConfig struct {
+	Level        string
+	Format       string
+	Destinations []LogDestinationConfig
+}
+
+// LogDestinationConfig is a simple struct that is used to map to a single log destination in a dirculese JSON
+// configuration file. LogDestinationConfig.Type is one of LogDestinationFile, LogDestinationStderr,
+// LogDestinationSyslog or LogDestinationJournald, and LogDestinationConfig.Path is the path of the log file or of the
+// socket that syslog or the journal listens on (the default one is used if it's empty). The rest of the settings only
+// apply to files, and decide when they're rotated (see Rotation): LogDestinationConfig.MaxSize is in megabytes
+// (DefaultLogMaxSize if it's zero), LogDestinationConfig.Interval in hours, and LogDestinationConfig.MaxBackupAge in
+// days. LogDestinationConfig.MaxBackups is DefaultLogMaxBackups if it's zero, and every backup is kept if it's
+// negative.
+type LogDestinationConfig struct {
+	Type         string
+	Path         string
+	MaxSize      int
+	Interval     int
+	MaxBackups   int
+	MaxBackupAge int
+	Compress     bool
+}
+
+// Directory is the basic type of a managed directory. Directories are managed based on the Rule items in the
+// Directory.rules slice, which are executed sequentially by Directory.Ruler(). The Directory.path string should be an
+// existing, accessible directory, which is validated by calling Directory.CheckPath(). Files that fail the
+// Directory.stability check during a run are collected in Directory.unstable and left alone by the rules.
+// Directory.hidden is the directory's policy for hidden files, which is one of HiddenIgnore (the default),
+// HiddenInclude or HiddenOnly. Directory.name is what the directory is called in log messages and errors (see
+// Directory.label), and directories that are Directory.disabled are left alone. Directory.evaluation is how the rules
+// are evaluated, which is one of EvaluationSequential (the default) or EvaluationFirstMatch (see Directory.FirstMatch).
+// The directory is read once per run into Directory.entries, which every rule shares, and the entries that rules have
+// moved or deleted are tracked in Directory.consumed. Directory.workers is how many files each rule can handle at the
+// same time (see Rule.handleConcurrently), which RunDirectories sets to its share of the configuration's Workers, and
+// Directory.options are the Options of the Engine it belongs to.
+type Directory struct {
+	rules      []Rule
+	name       string
+	disabled   bool
+	path       string
+	stability  Stability
+	unstable   map[string]string
+	hidden     string
+	evaluation string
+	entries    []os.FileInfo
+	consumed   map[string]bool
+	workers    int
+	options    *Options
+}
+
+// Rule defines a single criteria for managing a directory. Rule.source is a pointer to a Directory representation of
+// the source directory and Rule.target is a pointer to a Directory representation of the target directory. Any files in
+// the source directory that match the rule's criteria will be moved into the target directory, unless Rule.delete is
+// true, in which case the files will be deleted instead, or Rule.command is set, in which case the files will be handed
+// to an external command instead. Rule.preHook and Rule.postHook are optional commands that are run before and after
+// each file is handled, and Rule.symlinks is the rule's policy for symlinks (see Rule.Apply). Rule.handler is the name
+// of the registered Handler that should be used to execute the rule's logic, and is looked up by Rule.Handler(), and
+// Rule.options are that handler's options. Rule.name is what the rule is called in log messages and errors (see
+// Rule.label), Rule.description is a note about what it's for, and rules that are Rule.disabled are skipped. Rules with
+// a higher Rule.priority are run first, and Rule.continues lets the rules after this one handle the files it matched
+// too when the directory is evaluated with EvaluationFirstMatch. Rule.webhooks are sent a summary of what the rule did,
+// or the files it moved and deleted (see Webhook). Rule.turn is only set on the copies of a rule that handle files
+// concurrently, and makes their moves take turns (see Rule.move). Rule.ctx is the context of the run that the rule is
+// handling a file for, which its commands and hooks are stopped with after a grace period (see Command.Run).
+type Rule struct {
+	name             string
+	description      string
+	disabled         bool
+	priority         int
+	continues        bool
+	source           *Directory
+	target           *Directory
+	delete           bool
+	handler          string
+	options          interface{}
+	extensions       []string
+	ignoreCase       bool
+	prefixDelimiters []string
+	suffixDelimiters []string
+	sizeMax          int
+	sizeMin          int
+	dateMax          int
+	dateMin          int
+	symlinks         string
+	command          *Command
+	preHook          *Command
+	postHook         *Command
+	webhooks         []*Webhook
+	turn             *turn
+	ctx              context.Context
+}
+
+// CheckPath tests to see if a directory's d.path points to an existing directory on the filesystem (see
+// Options.FS).
+func (d *Directory) CheckPath() (err error) {
+	var fileInfo os.FileInfo
+	if d.path == "" {
+		return errors.New("empty paths are not valid")
+	}
+	fileInfo, err = d.options.fileSystem().Stat(d.path)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	if !fileInfo.IsDir() {
+		return errors.New(d.path + " is not a directory")
+	}
+	return
+}
+
+// label returns what a directory is called in log messages and errors, which is its d.name or, if it doesn't have
+// one, its d.path.
+func (d *Directory) label() string {
+	if d.name != "" {
+		return d.name
+	}
+	return d.path
+}
+
+// label returns what a rule is called in log messages and errors, which is its r.name prefixed with the label of its
+// r.source directory (e.g. Downloads/images).
+func (r *Rule) label() string {
+	if r.source == nil {
+		return r.name
+	}
+	return r.source.label() + "/" + r.name
+}
+
+// log writes a log entry about a directory (see Options.log).
+func (d *Directory) log(entry LogEntry) {
+	entry.Directory = d.label()
+	d.options.log(entry)
+}
+
+// log writes a log entry about a rule (see Options.log).
+func (r *Rule) log(entry LogEntry) {
+	if r.source == nil {
+		return
+	}
+	entry.Directory = r.source.label()
+	entry.Rule = r.label()
+	r.source.options.log(entry)
+}
+
+// failed logs that a rule stopped because of an error and sends a RuleFailed event.
+func (r *Rule) failed(err error) {
+	r.log(LogEntry{Level: LevelError, Action: ActionFail, Message: "Stopped the rule because of an error.", Err: err})
+	r.source.options.emit(RuleFailed{Time: r.source.options.now(), Directory: r.source.label(), Rule: r.name, Err: err})
+}
+
+// Contents returns the contents of a directory's d.path, leaving out any files that were found to be unstable by the
+// directory's d.stability check, any files that its d.hidden policy excludes and any files that were already consumed
+// by a rule. The directory is only read (see FS.ReadDir) and checked for stability the first time Contents is called
+// during a run, so every rule works from the same snapshot and sees the same set of unstable files (and each of them is
+// only logged once). The snapshot is sorted by name, so that files are always handled (and renamed when they collide
+// with each other) in the same order.
+// If ctx is done while the stability check waits for files to settle, the files it was waiting for are skipped.
+func (d *Directory) Contents(ctx context.Context) (contents []os.FileInfo, err error) {
+	if d.entries == nil {
+		d.entries, err = d.options.fileSystem().ReadDir(d.path)
+		if err != nil {
+			return nil, errors.New(err.Error())
+		}
+		sort.Slice(d.entries, func(i, j int) bool {
+			return d.entries[i].Name() < d.entries[j].Name()
+		})
+		d.consumed = make(map[string]bool)
+		d.unstable = d.stability.unstableFiles(ctx, d.options.fileSystem(), d.path, d.entries, d.options.now())
+		var names []string
+		for name := range d.unstable {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			d.log(LogEntry{Level: LevelInfo, Action: ActionSkip, Source: d.path + string(os.PathSeparator) + name, Message: "Skipped the file " + name + " in the path " + d.path + " because " + d.unstable[name] + "."})
+			d.options.emit(FileSkipped{Time: d.options.now(), Directory: d.label(), Path: d.path + string(os.PathSeparator) + name, Reason: d.unstable[name]})
+		}
+		d.options.emit(DirectoryScanned{Time: d.options.now(), Directory: d.label(), Path: d.path, Entries: len(d.entries), Unstable: len(d.unstable)})
+	}
+	for _, f := range d.entries {
+		if _, unstable := d.unstable[f.Name()]; unstable || d.consumed[f.Name()] {
+			continue
+		}
+		switch d.hidden {
+		case HiddenInclude:
+		case HiddenOnly:
+			if !IsHidden(f.Name()) {
+				continue
+			}
+		default:
+			if IsHidden(f.Name()) {
+				continue
+			}
+		}
+		contents = append(contents, f)
+	}
+	return
+}
+
+// Ruler sequentially executes the individuals rules in a directory's d.rules slice, skipping any that aren't enabled.
+// Errors are prefixed with the label of the rule they came from (see Rule.label). The stability check is reset at the
+// start of every run, along with the snapshot of the directory's d.entries, so that files which have finished being
+// written (and files that were added since the last run) can be picked up. If the directory's d.evaluation
+// is EvaluationFirstMatch, the rules are evaluated file by file instead (see Directory.FirstMatch) and every file that
+// none of them matched is logged. Once ctx is done, no more rules (or files) are started and ctx.Err() is returned as
+// it is, without a label.
+func (d *Directory) Ruler(ctx context.Context) (err error) {
+	d.unstable = nil
+	d.entries = nil
+	if d.evaluation == EvaluationFirstMatch {
+		var unmatched []string
+		unmatched, err = d.FirstMatch(ctx)
+		for _, name := range unmatched {
+			d.log(LogEntry{Level: LevelInfo, Action: ActionSkip, Source: d.path + string(os.PathSeparator) + name, Message: "No rule matched the file " + name + " in the path " + d.path + "."})
+			d.options.emit(FileSkipped{Time: d.options.now(), Directory: d.label(), Path: d.path + string(os.PathSeparator) + name, Reason: "no rule matched it"})
+		}
+		return
+	}
+	for _, element := range d.rules {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if element.disabled {
+			element.log(LogEntry{Level: LevelDebug, Action: ActionSkip, Message: "Skipped the rule because it isn't enabled."})
+			continue
+		}
+		err = element.Handler(ctx)
+		if err != nil && err == ctx.Err() {
+			return
+		}
+		if err != nil {
+			element.failed(err)
+			return errors.New("[" + element.label() + "] " + err.Error())
+		}
+	}
+	return
+}
+
+// Handler reads a rule's r.handler property and runs the handler registered under that name (see RegisterHandler). This
+// allows rules that are defined in text configuration files to be easily mapped to handlers.
+func (r *Rule) Handler(ctx context.Context) (err error) {
+	return r.handleWith(ctx, r.handler)
+}
+
+// ExtensionHandler iterates through all of the files in a rule's r.source directory, and if any file has an extension
+// that's listed in the r.extensions slice, it is either moved into the r.target directory or deleted, depending on the
+// boolean state of r.delete. Files can have more than one extension (see FileExtensions), so backup.tar.gz is matched
+// by both tar.gz and gz, and extensions are compared case-insensitively if r.ignoreCase is true.
+func (r *Rule) ExtensionHandler(ctx context.Context) (err error) {
+	return r.handleWith(ctx, "ExtensionHandler")
+}
+
+// PrefixHandler iterates through all of the files in a rule's r.source directory and handles any file whose name
+// portion (excluding extension, see SplitExtension) includes a substring that matches any member of the the
+// r.prefixDelimiters slice.
+// Matching files are either deleted (depending on the boolean state of r.delete) or moved into a subdirectory of
+// r.target. The name of this subdirectory will be the portion of the filename that precedes the prefix delimiter and
+// the subdirectory will be automatically created if it does not already exist.
+func (r *Rule) PrefixHandler(ctx context.Context) (err error) {
+	return r.handleWith(ctx, "PrefixHandler")
+}
+
+// SuffixHandler iterates through all of the files in a rule's r.source directory and handles any file whose name
+// portion (excluding extension, see SplitExtension) includes a substring that matches any member of the the
+// r.suffixDelimiters slice.
+// Matching files are either deleted (depending on the boolean state of r.delete) or moved into a subdirectory of
+// r.target. The name of this subdirectory will be the portion of the filename that follows the suffix delimiter and
+// the subdirectory will be automatically created if it does not already exist.
+func (r *Rule) SuffixHandler(ctx context.Context) (err error) {
+	return r.handleWith(ctx, "SuffixHandler")
+}
+
+// BrokenSymlinkHandler iterates through all of the items in a rule's r.source directory and handles any symlink that
+// points to something which doesn't exist. Broken symlinks are either deleted (depending on the boolean state of
+// r.delete) or moved into the r.target directory, and the rule's r.symlinks policy doesn't apply to them.
+func (r *Rule) BrokenSymlinkHandler(ctx context.Context) (err error) {
+	return r.handleWith(ctx, "BrokenSymlinkHandler")
+}
+
+// handleWith runs the named handler: it makes sure the rule has the settings the handler needs, then handles every item
+// in the rule's r.source directory that the handler matches (see Rule.matcher and Rule.handle), several at a time if
+// the directory has more than one worker (unless it's a dry run or the rule follows symlinks). Once ctx is done, the
+// file that is being handled is finished but no more are started, and ctx.Err() is returned.
+func (r *Rule) handleWith(ctx context.Context, handler string) (err error) {
+	match, err := r.matcher(handler)
+	if err != nil {
+		return
+	}
+
+	// make sure the path we're going to be moving items into exists and is accessible
+	err = r.checkTarget()
+	if err != nil {
+		return errors.New(err.Error())
+	}
+
+	// get a list of all the items in the directory we're managing
+	files, err := r.source.Contents(ctx)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+
+	// find every item that the handler matches
+	var items []os.FileInfo
+	var destinations []string
+	for _, f := range files {
+		if destination, ok := match(f); ok {
+			items = append(items, f)
+			r.source.options.emit(FileMatched{Time: r.source.options.now(), Directory: r.source.label(), Rule: r.name, Path: r.source.path + string(os.PathSeparator) + f.Name(), Destination: destination})
+			destinations = append(destinations, destination)
+		}
+	}
+
+	// dry runs keep track of the files they pretend to move, and rules that follow symlinks can reach a file through a
+	// link while it's being handled on its own, so both always handle their files one by one
+	if r.source.workers > 1 && len(items) > 1 && !r.source.options.dryRun() && r.symlinks != SymlinksFollow {
+		err = r.handleConcurrently(ctx, handler, items, destinations, r.source.workers)
+		for _, f := range items {
+			r.source.consume(f.Name())
+		}
+		return
+	}
+	for i, f := range items {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// a dry run may have pretended to handle the file already, through a symlink that points to it
+		if r.source.consumed[f.Name()] {
+			continue
+		}
+		err = r.handle(ctx, handler, f, destinations[i])
+		if err != nil {
+			return errors.New(err.Error())
+		}
+		r.source.consume(f.Name())
+	}
+	return
+}
+
+// matcher looks up the named handler (see LookupHandler) and returns the function that decides whether it matches an
+// item in the rule's r.source directory, and if so, which directory the item should be moved into. It returns an error
+// if the handler isn't registered or the rule is missing a setting that the handler needs (see Handler.Validate).
+func (r *Rule) matcher(handler string) (match func(f os.FileInfo) (destination string, ok bool), err error) {
+	h, ok := LookupHandler(handler)
+	if !ok {
+		return nil, errors.New("unrecognized handler")
+	}
+	if r.options == nil {
+		r.options = h.Options()
+	}
+	if errs := h.Validate(r.settings(), r.options); len(errs) > 0 {
+		return nil, errors.New(errs[0].Message)
+	}
+	return func(f os.FileInfo) (destination string, ok bool) {
+		return h.Match(r, f)
+	}, nil
+}
+
+// handle performs a rule's action on an item f that the named handler matched (see Handler.Act). The rule keeps ctx
+// while it does, so that the commands and hooks it runs for the item are stopped when the run is (see Command.Run).
+func (r *Rule) handle(ctx context.Context, handler string, f os.FileInfo, destination string) (err error) {
+	h, ok := LookupHandler(handler)
+	if !ok {
+		return errors.New("unrecognized handler")
+	}
+	r.ctx = ctx
+	return h.Act(r, f, destination)
+}
+
+// context returns the context of the run that the rule is handling a file for (see Rule.handle), or an empty context
+// if it isn't handling one for a run (e.g. when a handler is called directly).
+func (r *Rule) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// settings returns the settings of a rule that handlers check, as they would appear in a configuration file.
+func (r *Rule) settings() RuleConfig {
+	return RuleConfig{
+		Name:             r.name,
+		Description:      r.description,
+		Target:           r.TargetPath(),
+		Delete:           r.delete,
+		Handler:          r.handler,
+		Extensions:       r.extensions,
+		IgnoreCase:       r.ignoreCase,
+		PrefixDelimiters: r.prefixDelimiters,
+		SuffixDelimiters: r.suffixDelimiters,
+		SizeMax:          r.sizeMax,
+		SizeMin:          r.sizeMin,
+		DateMax:          r.dateMax,
+		DateMin:          r.dateMin,
+		Symlinks:         r.symlinks,
+	}
+}
+
+// Name returns the name of a rule, which is what it's called in log messages and errors.
+func (r *Rule) Name() string {
+	return r.name
+}
+
+// SourcePath returns the path of the directory that a rule organizes.
+func (r *Rule) SourcePath() string {
+	return r.source.path
+}
+
+// FS returns the filesystem that a rule organizes (see Options.FS), which handlers should use for everything they do
+// with files.
+func (r *Rule) FS() FS {
+	return r.source.options.fileSystem()
+}
+
+// Options returns a rule's handler options, decoded from its Options setting (see Handler.Options).
+func (r *Rule) Options() interface{} {
+	return r.options
+}
+
+// checkTarget makes sure the r.target directory exists and is accessible. This is only necessary when matching files
+// are going to be moved, so rules that delete files or hand them to a command are not checked.
+func (r *Rule) checkTarget() (err error) {
+	if r.delete || r.command != nil {
+		return
+	}
+	if r.target == nil {
+		return errors.New("you need to specify a target directory")
+	}
+	// the target is on the same filesystem as the source
+	return (&Directory{path: r.target.path, options: r.source.options}).CheckPath()
+}
+
+// TargetPath returns the path of a rule's r.target directory, or an empty string if the rule doesn't have one (which is
+// allowed for rules that delete files or hand them to a command).
+func (r *Rule) TargetPath() string {
+	if r.target == nil {
+		return ""
+	}
+	return r.target.path
+}
+
+// Apply performs a rule's action on a single file f from the r.source directory that was matched by one of the
+// handlers. Regular files are handed to Rule.act, while symlinks are handled according to the rule's r.symlinks policy:
+// SymlinksSkip (the default) leaves them alone, SymlinksMove acts on the link itself, SymlinksFollow acts on the file
+// the link points to, and SymlinksClean deletes the link if it is broken and leaves it alone otherwise. A file that is
+// no longer in the directory (because a symlink that was followed earlier in the run pointed to it) is skipped.
+func (r *Rule) Apply(f os.FileInfo, destination string) (err error) {
+	filePath := r.source.path + string(os.PathSeparator) + f.Name()
+	if _, statErr := r.FS().Lstat(filePath); os.IsNotExist(statErr) {
+		r.log(LogEntry{Level: LevelInfo, Action: ActionSkip, Source: filePath, Message: "Skipped the file " + f.Name() + " in the path " + r.source.path + " because it was already handled through a symlink."})
+		r.source.options.emit(FileSkipped{Time: r.source.options.now(), Directory: r.source.label(), Rule: r.name, Path: filePath, Reason: "it was already handled through a symlink"})
+		return
+	}
+	if f.Mode()&os.ModeSymlink == 0 {
+		return r.act(f, filePath, destination, r.delete)
+	}
+
+	switch r.symlinks {
+	case SymlinksMove:
+		return r.act(f, filePath, destination, r.delete)
+	case SymlinksClean:
+		if isBrokenSymlink(r.FS(), filePath) {
+			return r.act(f, filePath, destination, true)
+		}
+		r.log(LogEntry{Level: LevelInfo, Action: ActionSkip, Source: filePath, Message: "Skipped the symlink " + f.Name() + " in the path " + r.source.path + " because it isn't broken."})
+		r.source.options.emit(FileSkipped{Time: r.source.options.now(), Directory: r.source.label(), Rule: r.name, Path: filePath, Reason: "it's a symlink that isn't broken"})
+	case SymlinksFollow:
+		targetPath, target, followErr := followSymlink(r.FS(), filePath)
+		if followErr != nil || target.IsDir() {
+			r.log(LogEntry{Level: LevelInfo, Action: ActionSkip, Source: filePath, Message: "Skipped the symlink " + f.Name() + " in the path " + r.source.path + " because it doesn't point to a file."})
+			r.source.options.emit(FileSkipped{Time: r.source.options.now(), Directory: r.source.label(), Rule: r.name, Path: filePath, Reason: "it's a symlink that doesn't point to a file"})
+			return
+		}
+		err = r.act(target, targetPath, destination, r.delete)
+		if err != nil {
+			return errors.New(err.Error())
+		}
+		// once the file it points to has been moved or deleted, the link is broken and can go too
+		if (r.delete || r.command == nil) && r.source.options.dryRun() {
+			r.log(LogEntry{Level: LevelInfo, Action: ActionDelete, Source: filePath, Message: "Would delete the symlink " + f.Name() + " in the path " + r.source.path + " because the file it pointed to would be handled."})
+			r.source.options.emit(FileDeleted{Time: r.source.options.now(), Directory: r.source.label(), Rule: r.name, Path: filePath, Size: f.Size()})
+			r.source.markConsumed(f.Name())
+		} else if r.delete || r.command == nil {
+			err = r.FS().Remove(filePath)
+			if err != nil {
+				return errors.New(err.Error())
+			}
+			r.log(LogEntry{Level: LevelInfo, Action: ActionDelete, Source: filePath, Message: "Deleted the symlink " + f.Name() + " in the path " + r.source.path + " because the file it pointed to was handled."})
+			r.source.options.emit(FileDeleted{Time: r.source.options.now(), Directory: r.source.label(), Rule: r.name, Path: filePath, Size: f.Size()})
+		}
+	}
+	return
+}
+
+// act performs a rule's action on a single file f whose current full path is filePath. The file is deleted if remove is
+// true, handed to r.command if there is one, and otherwise moved into the destination directory (which is created if
+// necessary). The r.preHook and r.postHook commands, if any, are run before and after the action. During a dry run, the
+// action is only logged (see Rule.pretend).
+func (r *Rule) act(f os.FileInfo, filePath string, destination string, remove bool) (err error) {
+	var message string
+	var newPath string
+	if r.source.options.dryRun() {
+		return r.pretend(f, filePath, destination, remove)
+	}
+
+	if r.preHook != nil {
+		err = r.preHook.Run(r.context(), CommandStagePreHook, r, f, filePath, destination)
+		if err != nil {
+			return errors.New(err.Error())
+		}
+	}
+
+	switch {
+	// if the file should be removed, delete it
+	case remove:
+		err = r.FS().Remove(filePath)
+		message = "Deleted the file " + f.Name() + " in the path " + filepath.Dir(filePath) + "."
+		newPath = filePath
+	// if there is a command, let it take care of the file
+	case r.command != nil:
+		err = r.command.Run(r.context(), CommandStageAction, r, f, filePath, destination)
+	// otherwise, move it into the destination directory
+	default:
+		newPath, message, err = r.move(f, filePath, destination)
+	}
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	switch {
+	case remove:
+		r.source.options.emit(FileDeleted{Time: r.source.options.now(), Directory: r.source.label(), Rule: r.name, Path: filePath, Size: f.Size()})
+		r.log(LogEntry{Level: LevelInfo, Action: ActionDelete, Source: filePath, Message: message})
+	case newPath == filePath && message != "":
+		r.log(LogEntry{Level: LevelInfo, Action: ActionSkip, Source: filePath, Destination: destination, Message: message})
+	case message != "":
+		r.log(LogEntry{Level: LevelInfo, Action: ActionMove, Source: filePath, Destination: newPath, Message: message})
+	}
+	if newPath != "" {
+		filePath = newPath
+	}
+
+	if r.postHook != nil {
+		err = r.postHook.Run(r.context(), CommandStagePostHook, r, f, filePath, destination)
+		if err != nil {
+			return errors.New(err.Error())
+		}
+	}
+	return
+}
+
+// move moves a single file f from filePath into the destination directory, creating the destination if it doesn't exist
+// yet and renaming the file if a file with the same name is already there. Relative symlinks are updated so they still
+// point to the same file from their new location. It returns the new path of the file along with a message describing
+// what happened. If the rule has a r.turn, the move waits for it, so that files which are handled at the same time are
+// still renamed in a predictable order.
+func (r *Rule) move(f os.FileInfo, filePath string, destination string) (newPath string, message string, err error) {
+	if r.turn != nil {
+		r.turn.wait()
+		defer r.turn.done()
+	}
+	newPath = filePath
+	source := filepath.Dir(filePath)
+	fs := r.FS()
+
+	// create the new directory if necessary
+	if _, statErr := fs.Stat(destination); os.IsNotExist(statErr) {
+		err = fs.MkdirAll(destination, 0755)
+		if err != nil {
+			return
+		}
+	}
+
+	// pick the name the file will have in the new location
+	newName, err := r.freeName(f, destination)
+	if err != nil {
+		// if there was an error, let's register it as such
+		err = errors.New("Couldn't move the file " + f.Name() + " from the path " + source + " to " + destination + " (" + err.Error() + ").")
+		return
+	}
+	if newName == "" {
+		message = "Didn't move the file " + f.Name() + " from the path " + source + " to " + destination + " because a file with the same name already exists there."
+		r.source.options.emit(ConflictResolved{Time: r.source.options.now(), Directory: r.source.label(), Rule: r.name, Path: filePath, Destination: destination})
+		return
+	}
+
+	err = fs.Rename(filePath, destination+string(os.PathSeparator)+newName)
+	if err != nil {
+		return
+	}
+	newPath = destination + string(os.PathSeparator) + newName
+	if f.Mode()&os.ModeSymlink != 0 {
+		err = relink(fs, newPath, source)
+		if err != nil {
+			return
+		}
+	}
+	r.emitMoved(filePath, destination, newName, f.Size())
+	message = "Moved the file " + f.Name() + " from the path " + source + " to " + destination + "."
+	if newName != f.Name() {
+		message = "Moved the file " + f.Name() + " from the path " + source + " to " + destination + " (renamed to " + newName + ") because a file with the same name already exists there."
+	}
+	return
+}
+
+// freeName picks the name a file f will have in the destination directory. Lstat the full path of the new file we want
+// to create and check for an IsNotExist error, which means a file by that name doesn't already exist in the new
+// location and we're safe to move it there. Otherwise, numbers are appended to the end of the file's name (before its
+// extension) until a free name is found. An empty name is returned if there isn't one.
+func (r *Rule) freeName(f os.FileInfo, destination string) (newName string, err error) {
+	newName = f.Name()
+	_, statErr := r.FS().Lstat(destination + string(os.PathSeparator) + newName)
+	if statErr != nil && !os.IsNotExist(statErr) {
+		return "", errors.New(statErr.Error())
+	}
+	if statErr == nil {
+		// if there was no error, it means a file by that name does already exist in the new location, so lets try
+		// appending numbers to the end of the filename and redo the stat check up to 9998 times (which is an entirely
+		// arbitrary limit)
+		newName = ""
+		base, extension := SplitExtension(f.Name(), r.extensions, r.ignoreCase)
+		for i := 0; i < 9999; i++ {
+			appendedFileName := base + strconv.Itoa(i) + extension
+			if _, e := r.FS().Lstat(destination + string(os.PathSeparator) + appendedFileName); os.IsNotExist(e) {
+				return appendedFileName, nil
+			}
+		}
+	}
+	return
+}
+
+// pretend logs what Rule.act would do with a single file f whose current full path is filePath, without doing it or
+// running any hooks. Files from the r.source directory that would be moved or deleted are treated as consumed, so that
+// the rules after this one don't pretend to handle them again.
+func (r *Rule) pretend(f os.FileInfo, filePath string, destination string, remove bool) (err error) {
+	source := filepath.Dir(filePath)
+	entry := LogEntry{Level: LevelInfo, Action: ActionMove, Source: filePath, Destination: destination}
+	var message string
+	switch {
+	case remove:
+		entry.Action, entry.Destination = ActionDelete, ""
+		message = "Would delete the file " + f.Name() + " in the path " + source + "."
+		r.source.options.emit(FileDeleted{Time: r.source.options.now(), Directory: r.source.label(), Rule: r.name, Path: filePath, Size: f.Size()})
+	case r.command != nil:
+		entry.Action = ActionCommand
+		message = "Would run the command " + r.command.path + " (" + CommandStageAction + ") for the file " + f.Name() + " in the path " + source + "."
+	default:
+		newName, nameErr := r.freeName(f, destination)
+		switch {
+		case nameErr != nil:
+			return errors.New("Couldn't move the file " + f.Name() + " from the path " + source + " to " + destination + " (" + nameErr.Error() + ").")
+		case newName == "":
+			entry.Action = ActionSkip
+			message = "Wouldn't move the file " + f.Name() + " from the path " + source + " to " + destination + " because a file with the same name already exists there."
+			r.source.options.emit(ConflictResolved{Time: r.source.options.now(), Directory: r.source.label(), Rule: r.name, Path: filePath, Destination: destination})
+		case newName != f.Name():
+			entry.Destination = destination + string(os.PathSeparator) + newName
+			message = "Would move the file " + f.Name() + " from the path " + source + " to " + destination + " (renamed to " + newName + ") because a file with the same name already exists there."
+			r.emitMoved(filePath, destination, newName, f.Size())
+		default:
+			entry.Destination = destination + string(os.PathSeparator) + newName
+			message = "Would move the file " + f.Name() + " from the path " + source + " to " + destination + "."
+			r.emitMoved(filePath, destination, newName, f.Size())
+		}
+	}
+	entry.Message = message
+	r.log(entry)
+
+	if (remove || r.command == nil) && source == filepath.Clean(r.source.path) {
+		r.source.markConsumed(f.Name())
+	}
+	return
+}
+
+// emitMoved sends a FileMoved event for the file at filePath, which was moved into the destination directory under
+// newName, preceded by a ConflictResolved event if that isn't the file's own name.
+func (r *Rule) emitMoved(filePath string, destination string, newName string, size int64) {
+	o := r.source.options
+	if newName != filepath.Base(filePath) {
+		o.emit(ConflictResolved{Time: o.now(), Directory: r.source.label(), Rule: r.name, Path: filePath, Destination: destination, NewName: newName})
+	}
+	o.emit(FileMoved{Time: o.now(), Directory: r.source.label(), Rule: r.name, From: filePath, To: destination + string(os.PathSeparator) + newName, Size: size})
+}
+
+// GetConfigStruct loads a JSON, YAML or TOML file (in the given format, see GetConfigFormat) and the files it includes
+// (see LoadConfigTree) from the given path on the filesystem and maps its contents to a DirectoriesConfig struct,
+// applying rule templates (see ApplyRuleTemplates), substituting variables (see SubstituteVariables) and expanding
+// directory paths and rule targets (see ExpandConfig). The file is checked thoroughly along the way: unknown fields,
+// values of the wrong type, unknown templates and variables, paths that can't be expanded and every problem found by
+// ValidateConfig are returned together as ConfigErrors, each pointing to the line and column (and file, for included
+// files) it refers to and sorted by their position in the file. As much of the configuration as could be read is
+// returned even if there are problems.
+func GetConfigStruct(path string, format string) (conf DirectoriesConfig, err error) {
+	conf = DirectoriesConfig{}
+	tree, positions, err := LoadConfigTree(path, format)
+	if err != nil {
+		return
+	}
+	errs := CheckConfigTree(tree, reflect.TypeOf(conf), "")
+	resolveErrs := ApplyRuleTemplates(tree, positions)
+	resolveErrs = append(resolveErrs, SubstituteVariables(tree)...)
+
+	// every format is parsed into the same kind of tree, so it can be decoded the same way
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return conf, errors.New(err.Error())
+	}
+	if decodeErr := json.Unmarshal(data, &conf); decodeErr != nil && len(errs) == 0 {
+		errs = append(errs, ConfigError{Message: decodeErr.Error()})
+	}
+
+	// values that couldn't be resolved or expanded would only fail validation again, so only report them once
+	resolveErrs = append(resolveErrs, ExpandConfig(&conf)...)
+	errs = append(errs, resolveErrs...)
+	for _, validationError := range ValidateConfig(conf) {
+		if !resolveErrs.covers(validationError.Path) {
+			errs = append(errs, validationError)
+		}
+	}
+	if len(errs) > 0 {
+		errs.locate(positions)
+		errs.sort()
+		err = errs
+	}
+	return
+}
+
+// GetDirectories creates an array of Directories (including the rules associated with each one) based on the contents
+// of a DirectoriesConfig struct. Rule templates are resolved into plain rules by GetConfigStruct, so every rule here
+// already has all of its settings. Directories and rules are enabled unless their Enabled setting is false, and rules
+// that don't have a Name are called "rule 1", "rule 2" and so on, after their position in the directory. Each
+// directory's rules are sorted by their Priority (highest first), and rules with the same priority keep their order.
+func GetDirectories(config DirectoriesConfig) (directories []Directory) {
+	directories = make([]Directory, len(config.Directories))
+	for i, directoryConf := range config.Directories {
+		// rules keep a pointer to their source directory, so make sure it points into the slice we return
+		d := &directories[i]
+		d.name = directoryConf.Name
+		d.disabled = directoryConf.Enabled != nil && !*directoryConf.Enabled
+		d.path = directoryConf.Path
+		d.hidden = directoryConf.Hidden
+		d.evaluation = directoryConf.Evaluation
+		d.workers = config.Workers
+		if directoryConf.Stability != nil {
+			d.stability = GetStability(*directoryConf.Stability)
+		} else if config.Stability != nil {
+			d.stability = GetStability(*config.Stability)
+		}
+		for j, ruleConf := range directoryConf.Rules {
+			rule := Rule{}
+			targetDirectory := Directory{path: ruleConf.Target}
+			rule.name = ruleConf.Name
+			if rule.name == "" {
+				rule.name = "rule " + strconv.Itoa(j+1)
+			}
+			rule.description = ruleConf.Description
+			rule.disabled = ruleConf.Enabled != nil && !*ruleConf.Enabled
+			rule.priority = ruleConf.Priority
+			rule.continues = ruleConf.Continue
+			rule.source = d
+			rule.target = &targetDirectory
+			rule.delete = ruleConf.Delete
+			rule.handler = ruleConf.Handler
+			if handler, ok := LookupHandler(ruleConf.Handler); ok {
+				// the options were already checked by ValidateConfig
+				rule.options, _ = decodeHandlerOptions(handler, ruleConf.Options, "Options")
+			}
+			rule.extensions = ruleConf.Extensions
+			rule.ignoreCase = ruleConf.IgnoreCase
+			rule.prefixDelimiters = ruleConf.PrefixDelimiters
+			rule.suffixDelimiters = ruleConf.SuffixDelimiters
+			rule.sizeMax = ruleConf.SizeMax
+			rule.sizeMin = ruleConf.SizeMin
+			rule.dateMax = ruleConf.DateMax
+			rule.dateMin = ruleConf.DateMin
+			rule.symlinks = ruleConf.Symlinks
+			rule.command = GetCommand(ruleConf.Command)
+			rule.preHook = GetCommand(ruleConf.PreHook)
+			rule.postHook = GetCommand(ruleConf.PostHook)
+			rule.webhooks = GetWebhooks(ruleConf.Webhooks)
+			d.rules = append(d.rules, rule)
+		}
+		sort.SliceStable(d.rules, func(a, b int) bool {
+			return d.rules[a].priority > d.rules[b].priority
+		})
+	}
+	return
+}
+
+// SelectRules disables every directory whose name or path isn't in directoryNames and every rule whose name or label
+// (see Rule.label) isn't in ruleNames, so that only the selected directories and rules are run. An empty list selects
+// everything. Names that don't match any directory or rule are returned as an error. Directories and rules that aren't
+// enabled in the configuration file stay disabled even if they're selected.
+func SelectRules(directories []Directory, directoryNames []string, ruleNames []string) (err error) {
+	matched := make(map[string]bool)
+	for i := range directories {
+		d := &directories[i]
+		if len(directoryNames) > 0 && !selectName(matched, directoryNames, d.name, d.path) {
+			d.disabled = true
+		}
+		for j := range d.rules {
+			r := &d.rules[j]
+			if len(ruleNames) > 0 && !selectName(matched, ruleNames, r.name, r.label()) {
+				r.disabled = true
+			}
+		}
+	}
+	var unknown []string
+	for _, name := range append(append([]string{}, directoryNames...), ruleNames...) {
+		if !matched[name] {
+			unknown = append(unknown, "\""+name+"\"")
+		}
+	}
+	if len(unknown) > 0 {
+		return errors.New("there is no directory or rule called " + strings.Join(unknown, ", "))
+	}
+	return
+}
+
+// selectName reports whether any of the given names of a directory or rule are in selected, and records the ones that
+// are in matched.
+func selectName(matched map[string]bool, selected []string, names ...string) (ok bool) {
+	for _, name := range names {
+		if name != "" && oneOf(name, selected...) {
+			matched[name] = true
+			ok = true
+		}
+	}
+	return
+}
+
+// SplitNames splits a comma-separated list of names, like the ones given to the -directories or -rules flag, ignoring
+// spaces around the names and empty names.
+func SplitNames(list string) (names []string) {
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// GetSampleConfig generates a sample dirculese configuration file.
+func GetSampleConfig() (config string) {
+	config = `{"Directories":[{"Path":"/path/to/a/source/directory/that/you/want/to/keep/organized/with/dirculese/rules","Rules":[{"Target":"/path/to/a/destination/directory/where/items/matching/your/rule/will/be/moved","Delete":false,"Handler":"ExtensionHandler","Extensions":["png"],"PrefixDelimiters":["__"],"SuffixDelimiters":["--"],"SizeMax":0,"SizeMin":0,"DateMax":0,"DateMin":0}]}]}`
+	return
+}
+
+// GetUserHome returns the runtime user's home directory.
+func GetUserHome() (home string, err error) {
+	currentUser, _ := user.Current()
+	home = currentUser.HomeDir
+	if home == "" {
+		err = errors.New("can't find your home directory (try using the -config flag with the full path to your config file)")
+	}
+	return
+}
+
+// ValidateConfigFile checks to see if the configuration file at the provided path exists on the filesystem and can be
+// parsed in its format (see GetConfigFormat). Syntax errors are returned as ConfigErrors that point to where the
+// problem is.
+func ValidateConfigFile(path string, format string) (err error) {
+	confContents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	_, _, _, err = ParseConfigTree(confContents, GetConfigFormat(path, format))
+	return
+}
@@ -0,0 +1,26 @@
+/*
+Package dirculese organizes directories according to rules that move, delete or run commands on the files in them. It's
+what the dirculese command is built on.
+
+A configuration is loaded with GetConfigStruct (or built as a DirectoriesConfig), and run by an Engine:
+
+	config, err := dirculese.GetConfigStruct("/path/to/config.yaml", "")
+	if err != nil {
+		return err
+	}
+	engine, err := dirculese.New(config, dirculese.Options{Logger: log.New(os.Stdout, "", log.LstdFlags)})
+	if err != nil {
+		return err
+	}
+	return engine.Run(context.Background())
+
+Engine.Select restricts a run to some of the directories and rules, and Options.DryRun only logs what a run would do.
+Options.Logger and Options.ErrorLogger can be LogWriters, which write leveled log entries with fields as text or JSON
+(see LogEntry), or the MultiLogger that OpenLogDestinations returns for a LoggingConfig, which logs to rotated files
+(see RotatingFile), standard error, syslog and journald. Options.FS changes the filesystem that is organized (see FS,
+MemFS and ReadOnlyFS). Cancelling the context given to Engine.Run, or setting Options.TimeBudget, stops a run after the
+files that are being handled, and the rest are left for the next run. Metrics turns the events of runs (see Event) into
+Prometheus metrics, and a Reporter turns them into a Report in Markdown, HTML or JSON. The Webhooks of a configuration
+(see WebhookConfig) are sent by its engine after each run, or for every file, and Engine.Run waits for them.
+*/
+package dirculese
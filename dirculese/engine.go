@@ -0,0 +1,166 @@
+package dirculese
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// Logger is what an Engine writes its log messages to. A *log.Logger can be used as a Logger.
+type Logger interface {
+	Println(v ...interface{})
+}
+
+// Options changes how an Engine works. Options.Logger receives the debug and info messages about everything the engine
+// does and Options.ErrorLogger receives the warnings and errors about everything that goes wrong; either of them can be
+// nil, in which case those messages are discarded. Loggers that implement EntryLogger (like LogWriter) receive every
+// message as a LogEntry, with its level and fields. Options.Clock is used instead of time.Now to decide how long ago
+// files were modified (see Stability). Options.FS is the filesystem that is organized, which is OSFS if it's nil. If
+// Options.DryRun is true, nothing is moved or deleted and no commands or hooks are run, and the engine only logs what
+// it would have done (the filesystem is wrapped in a ReadOnlyFS to make sure of it). If Options.TimeBudget is set, each
+// run stops (like it does when its context is cancelled, see Engine.Run) once it has taken that long. The subscribers
+// of the engine (see Engine.Subscribe) are kept with its options, so that everything that has them can send events.
+type Options struct {
+	Logger      Logger
+	ErrorLogger Logger
+	Clock       func() time.Time
+	FS          FS
+	DryRun      bool
+	TimeBudget  time.Duration
+	bus         *eventBus
+	runID       string
+}
+
+// log fills in the time and run ID of an entry and writes it to o.Logger, or to o.ErrorLogger if it's a warning or an
+// error. Loggers that don't implement EntryLogger are only given the entry's text (see LogEntry.text).
+func (o *Options) log(entry LogEntry) {
+	if o == nil {
+		return
+	}
+	logger := o.Logger
+	if entry.Level >= LevelWarn {
+		logger = o.ErrorLogger
+	}
+	if logger == nil {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = o.now()
+	}
+	entry.RunID = o.runID
+	if entryLogger, ok := logger.(EntryLogger); ok {
+		entryLogger.Log(entry)
+		return
+	}
+	logger.Println(entry.text())
+}
+
+// now returns the current time according to o.Clock, or time.Now if there isn't one.
+func (o *Options) now() time.Time {
+	if o != nil && o.Clock != nil {
+		return o.Clock()
+	}
+	return time.Now()
+}
+
+// fileSystem returns the filesystem to organize, which is o.FS (or OSFS if there isn't one), made read-only during dry
+// runs.
+func (o *Options) fileSystem() (fs FS) {
+	fs = OSFS{}
+	if o != nil && o.FS != nil {
+		fs = o.FS
+	}
+	if o.dryRun() {
+		fs = ReadOnlyFS{fs}
+	}
+	return
+}
+
+// dryRun reports whether o.DryRun is set.
+func (o *Options) dryRun() bool {
+	return o != nil && o.DryRun
+}
+
+// Engine organizes the directories of a configuration. It's created with New, and can be told to only run some of the
+// directories and rules with Engine.Select before Engine.Run is called.
+type Engine struct {
+	config      DirectoriesConfig
+	options     Options
+	directories []Directory
+	notifier    *notifier
+}
+
+// New creates an Engine that organizes the directories of config. The configuration is checked like ValidateConfig
+// does first (against the engine's filesystem), and its problems are returned as ConfigErrors. Configurations loaded
+// with GetConfigStruct have already been checked, and have had their templates, variables and paths resolved.
+func New(config DirectoriesConfig, options Options) (engine *Engine, err error) {
+	if errs := validateConfig(config, &options); len(errs) > 0 {
+		return nil, errs
+	}
+	engine = &Engine{config: config, options: options}
+	engine.options.bus = &eventBus{}
+	engine.directories = GetDirectories(config)
+	for i := range engine.directories {
+		engine.directories[i].options = &engine.options
+	}
+	engine.notifier = newNotifier(engine)
+	return
+}
+
+// Select makes the engine only run the directories whose names (or paths) are in directoryNames and the rules whose
+// names are in ruleNames (see SelectRules). An empty list selects everything.
+func (e *Engine) Select(directoryNames []string, ruleNames []string) (err error) {
+	return SelectRules(e.directories, directoryNames, ruleNames)
+}
+
+// Run organizes every enabled directory once (see RunDirectories), using as many workers as the configuration's Workers
+// setting allows. It sends a RunStarted event before it starts and a RunFinished event when it's done. If ctx is
+// cancelled or the run uses up its time budget, the files that are being handled are finished (except for their
+// commands and hooks, which are stopped), but no more are started: the interruption is logged, RunFinished.Interrupted
+// is set, and the files that are left are organized the next time the engine runs. Every run gets a random ID, which is
+// in its log entries and events. If the configuration or its rules have Webhooks, Run returns once they've been sent,
+// or a few seconds after ctx is done if they're still being sent then (see Webhook).
+func (e *Engine) Run(ctx context.Context) (err error) {
+	e.options.runID = newRunID()
+	if e.notifier != nil {
+		e.notifier.begin()
+	}
+	if e.options.TimeBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.options.TimeBudget)
+		defer cancel()
+	}
+
+	started := e.options.now()
+	enabled := 0
+	for _, d := range e.directories {
+		if !d.disabled {
+			enabled++
+		}
+	}
+	e.options.emit(RunStarted{Time: started, RunID: e.options.runID, Directories: enabled, DryRun: e.options.DryRun})
+	err = RunDirectories(ctx, e.directories, e.config.Workers)
+	finished := e.options.now()
+	interrupted := ctx.Err() != nil
+	if ctx.Err() == context.DeadlineExceeded && e.options.TimeBudget > 0 {
+		e.options.log(LogEntry{Level: LevelWarn, Action: ActionStop, Message: "The run used up its time budget of " + e.options.TimeBudget.String() + " and was stopped; the remaining files will be organized next time."})
+	} else if interrupted {
+		e.options.log(LogEntry{Level: LevelWarn, Action: ActionStop, Message: "The run was interrupted (" + ctx.Err().Error() + "); the remaining files will be organized next time."})
+	}
+	e.options.emit(RunFinished{Time: finished, RunID: e.options.runID, Duration: finished.Sub(started), Err: err, Interrupted: interrupted})
+	if e.notifier != nil {
+		e.notifier.wait(ctx)
+	}
+	return
+}
+
+// newRunID returns a random ID for a run, or one based on the current time if there isn't any randomness available.
+func newRunID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,253 @@
+package dirculese
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorder is a Logger that keeps the messages it's given.
+type recorder struct {
+	messages []string
+}
+
+func (r *recorder) Println(v ...interface{}) {
+	r.messages = append(r.messages, fmt.Sprint(v...))
+}
+
+func TestNew(t *testing.T) {
+	invalid := DirectoriesConfig{Directories: []DirectoryConfig{{Path: "relative/path", Rules: []RuleConfig{{Handler: "NoSuchHandler"}}}}}
+	if _, err := New(invalid, Options{}); err == nil {
+		t.Error("New accepted an invalid configuration")
+	} else if _, ok := err.(ConfigErrors); !ok {
+		t.Errorf("New didn't return ConfigErrors. Got '%T'", err)
+	}
+
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+	config := DirectoriesConfig{Directories: []DirectoryConfig{{
+		Path:  tempDirectory,
+		Rules: []RuleConfig{{Name: "images", Handler: "ExtensionHandler", Extensions: []string{"png"}, Delete: true}},
+	}}}
+	engine, err := New(config, Options{})
+	if err != nil {
+		t.Fatalf("New returned an error. Got '%v'", err)
+	}
+	if err = engine.Select(nil, []string{"documents"}); err == nil {
+		t.Error("Selecting a rule that doesn't exist didn't return an error")
+	}
+}
+
+func TestEngine_DryRun(t *testing.T) {
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+	target := filepath.Join(tempDirectory, "images")
+	os.Mkdir(target, 0755)
+	for _, name := range []string{"a.png", "b.png", "c.txt", filepath.Join("images", "a.png")} {
+		ioutil.WriteFile(filepath.Join(tempDirectory, name), []byte{}, 0644)
+	}
+	hookPath := filepath.Join(tempDirectory, "hook.log")
+
+	config := DirectoriesConfig{Directories: []DirectoryConfig{{
+		Path: tempDirectory,
+		Name: "downloads",
+		Rules: []RuleConfig{
+			{Name: "images", Handler: "ExtensionHandler", Extensions: []string{"png"}, Target: target, PreHook: &CommandConfig{
+				Path: "/bin/sh",
+				Args: []string{"-c", `echo "$1" >> "$2"`, "sh", "{name}", hookPath},
+			}},
+			{Name: "everything", Handler: "ExtensionHandler", Extensions: []string{"png", "txt"}, Delete: true},
+		},
+	}}}
+	logger := &recorder{}
+	engine, err := New(config, Options{Logger: logger, DryRun: true})
+	if err != nil {
+		t.Fatalf("New returned an error. Got '%v'", err)
+	}
+	if err = engine.Run(context.Background()); err != nil {
+		t.Fatalf("Run returned an error. Got '%v'", err)
+	}
+
+	// nothing was touched and no hooks were run
+	for _, name := range []string{"a.png", "b.png", "c.txt", filepath.Join("images", "a.png")} {
+		if _, statErr := os.Stat(filepath.Join(tempDirectory, name)); statErr != nil {
+			t.Errorf("Dry run changed %v. Got '%v'", name, statErr)
+		}
+	}
+	if _, statErr := os.Stat(hookPath); statErr == nil {
+		t.Error("Dry run ran a hook")
+	}
+
+	// the files the first rule would move aren't offered to the second one
+	want := []string{
+		"[downloads/images] Would move the file a.png from the path " + tempDirectory + " to " + target + " (renamed to a0.png) because a file with the same name already exists there.",
+		"[downloads/images] Would move the file b.png from the path " + tempDirectory + " to " + target + ".",
+		"[downloads/everything] Would delete the file c.txt in the path " + tempDirectory + ".",
+	}
+	var got []string
+	for _, message := range logger.messages {
+		if strings.Contains(message, "Would") {
+			got = append(got, message)
+		}
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Mismatch in dry run messages. Got '%v', want '%v'", got, want)
+	}
+}
+
+func TestEngine_Clock(t *testing.T) {
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+	ioutil.WriteFile(filepath.Join(tempDirectory, "a.txt"), []byte{}, 0644)
+
+	// the file was just written, but according to the clock it was written two hours ago, so it's already settled and
+	// the run doesn't wait for an hour
+	config := DirectoriesConfig{Directories: []DirectoryConfig{{
+		Path:      tempDirectory,
+		Stability: &StabilityConfig{SettleTime: 3600},
+		Rules:     []RuleConfig{{Handler: "ExtensionHandler", Extensions: []string{"txt"}, Delete: true}},
+	}}}
+	engine, err := New(config, Options{Clock: func() time.Time { return time.Now().Add(2 * time.Hour) }})
+	if err != nil {
+		t.Fatalf("New returned an error. Got '%v'", err)
+	}
+	if err = engine.Run(context.Background()); err != nil {
+		t.Fatalf("Run returned an error. Got '%v'", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(tempDirectory, "a.txt")); !os.IsNotExist(statErr) {
+		t.Errorf("The settled file wasn't deleted. Got '%v'", statErr)
+	}
+}
+
+func TestEngine_FS(t *testing.T) {
+	fs := NewMemFS()
+	fs.MkdirAll("/downloads", 0755)
+	fs.MkdirAll("/images/a", 0755)
+	fs.MkdirAll("/documents", 0755)
+	for _, name := range []string{"/downloads/a.png", "/downloads/b.png", "/downloads/report__2020.txt", "/images/a.png", "/elsewhere.png"} {
+		fs.WriteFile(name, 1, 0644)
+	}
+	fs.Symlink("/elsewhere.png", "/downloads/link.png")
+
+	config := DirectoriesConfig{Directories: []DirectoryConfig{{
+		Path: "/downloads",
+		Rules: []RuleConfig{
+			{Handler: "ExtensionHandler", Extensions: []string{"png"}, Target: "/images", Symlinks: SymlinksFollow},
+			{Handler: "PrefixHandler", PrefixDelimiters: []string{"__"}, Target: "/documents"},
+		},
+	}}}
+	if _, err := New(config, Options{}); err == nil {
+		t.Error("New found the directories of the in-memory filesystem on the real one")
+	}
+	engine, err := New(config, Options{FS: fs})
+	if err != nil {
+		t.Fatalf("New returned an error. Got '%v'", err)
+	}
+	if err = engine.Run(context.Background()); err != nil {
+		t.Fatalf("Run returned an error. Got '%v'", err)
+	}
+
+	want := map[string]bool{
+		"/images/a.png":                      true,
+		"/images/a0.png":                     true,
+		"/images/b.png":                      true,
+		"/images/elsewhere.png":              true,
+		"/documents/report/report__2020.txt": true,
+		"/downloads/a.png":                   false,
+		"/downloads/link.png":                false,
+		"/elsewhere.png":                     false,
+	}
+	for name, exists := range want {
+		if _, statErr := fs.Lstat(name); (statErr == nil) != exists {
+			t.Errorf("Mismatch in whether %v exists. Got '%v', want '%v'", name, statErr == nil, exists)
+		}
+	}
+}
+
+func TestEngine_Interrupted(t *testing.T) {
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+	ioutil.WriteFile(filepath.Join(tempDirectory, "a.txt"), []byte{}, 0644)
+
+	config := DirectoriesConfig{Directories: []DirectoryConfig{{
+		Path:  tempDirectory,
+		Rules: []RuleConfig{{Handler: "ExtensionHandler", Extensions: []string{"txt"}, Delete: true}},
+	}}}
+	logger := &recorder{}
+	engine, err := New(config, Options{ErrorLogger: logger})
+	if err != nil {
+		t.Fatalf("New returned an error. Got '%v'", err)
+	}
+	var finished RunFinished
+	engine.Subscribe(func(event Event) {
+		if e, ok := event.(RunFinished); ok {
+			finished = e
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = engine.Run(ctx); err == nil {
+		t.Error("An interrupted run didn't return an error")
+	}
+	if _, statErr := os.Stat(filepath.Join(tempDirectory, "a.txt")); statErr != nil {
+		t.Errorf("An interrupted run handled a file. Got '%v'", statErr)
+	}
+	if !finished.Interrupted {
+		t.Error("RunFinished doesn't say that the run was interrupted")
+	}
+	if len(logger.messages) != 1 || !strings.Contains(logger.messages[0], "interrupted") {
+		t.Errorf("Mismatch in the logged interruption. Got '%v'", logger.messages)
+	}
+}
+
+func TestEngine_TimeBudget(t *testing.T) {
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+	ioutil.WriteFile(filepath.Join(tempDirectory, "a.txt"), []byte{}, 0644)
+
+	// the file was just written, so the run would wait an hour for it to settle if the budget didn't stop it
+	config := DirectoriesConfig{Directories: []DirectoryConfig{{
+		Path:      tempDirectory,
+		Stability: &StabilityConfig{SettleTime: 3600},
+		Rules:     []RuleConfig{{Handler: "ExtensionHandler", Extensions: []string{"txt"}, Delete: true}},
+	}}}
+	logger := &recorder{}
+	engine, err := New(config, Options{ErrorLogger: logger, TimeBudget: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("New returned an error. Got '%v'", err)
+	}
+	started := time.Now()
+	if err = engine.Run(context.Background()); err == nil {
+		t.Error("A run that used up its time budget didn't return an error")
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Errorf("The run didn't stop when it used up its time budget. Got '%v'", elapsed)
+	}
+	if _, statErr := os.Stat(filepath.Join(tempDirectory, "a.txt")); statErr != nil {
+		t.Errorf("The unsettled file was handled. Got '%v'", statErr)
+	}
+	if len(logger.messages) != 1 || !strings.Contains(logger.messages[0], "time budget") {
+		t.Errorf("Mismatch in the logged interruption. Got '%v'", logger.messages)
+	}
+}
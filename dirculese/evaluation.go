@@ -0,0 +1,79 @@
+package dirculese
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+// EvaluationSequential and EvaluationFirstMatch are the ways that the rules of a directory can be evaluated.
+// EvaluationSequential (the default) runs each rule over the whole directory in turn, while EvaluationFirstMatch scans
+// the directory once and gives each file to the first rule that matches it (see Directory.FirstMatch).
+const (
+	EvaluationSequential = "Sequential"
+	EvaluationFirstMatch = "FirstMatch"
+)
+
+// FirstMatch evaluates a directory's rules file by file: the directory is read once, and each item in it is offered to
+// the rules in order (which is by priority, see GetDirectories) until one of them matches it. Only that rule is
+// applied, unless its r.continues is set, in which case the item is offered to the following rules too (as long as it's
+// still in the directory). It returns the names of the files that none of the rules matched. Once ctx is done, no more
+// files are offered to the rules and ctx.Err() is returned.
+func (d *Directory) FirstMatch(ctx context.Context) (unmatched []string, err error) {
+	var rules []*Rule
+	var matchers []func(f os.FileInfo) (destination string, ok bool)
+	for i := range d.rules {
+		r := &d.rules[i]
+		if r.disabled {
+			r.log(LogEntry{Level: LevelDebug, Action: ActionSkip, Message: "Skipped the rule because it isn't enabled."})
+			continue
+		}
+		match, matchErr := r.matcher(r.handler)
+		if matchErr == nil {
+			matchErr = r.checkTarget()
+		}
+		if matchErr != nil {
+			r.failed(matchErr)
+			return nil, errors.New("[" + r.label() + "] " + matchErr.Error())
+		}
+		rules = append(rules, r)
+		matchers = append(matchers, match)
+	}
+
+	files, err := d.Contents(ctx)
+	if err != nil {
+		return nil, errors.New("[" + d.label() + "] " + err.Error())
+	}
+
+	for _, f := range files {
+		if ctx.Err() != nil {
+			return unmatched, ctx.Err()
+		}
+		// a dry run may have pretended to handle the file already, through a symlink that points to it
+		if d.consumed[f.Name()] {
+			continue
+		}
+		matched := false
+		for i, r := range rules {
+			destination, ok := matchers[i](f)
+			if !ok {
+				continue
+			}
+			matched = true
+			d.options.emit(FileMatched{Time: d.options.now(), Directory: d.label(), Rule: r.name, Path: d.path + string(os.PathSeparator) + f.Name(), Destination: destination})
+			err = r.handle(ctx, r.handler, f, destination)
+			if err != nil {
+				r.failed(err)
+				return unmatched, errors.New("[" + r.label() + "] " + err.Error())
+			}
+			// a file that was moved or deleted can't be handled by any other rule
+			if consumed := d.consume(f.Name()); !r.continues || consumed {
+				break
+			}
+		}
+		if !matched && !f.IsDir() {
+			unmatched = append(unmatched, f.Name())
+		}
+	}
+	return
+}
@@ -0,0 +1,65 @@
+package dirculese
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDirectory_FirstMatch(t *testing.T) {
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+	for _, name := range []string{"a.png", "b.jpg", "c.txt", "d.png"} {
+		ioutil.WriteFile(filepath.Join(tempDirectory, name), []byte{}, 0644)
+	}
+	os.Mkdir(filepath.Join(tempDirectory, "folder"), 0755)
+	logPath := filepath.Join(tempDirectory, "continue.log")
+
+	config := DirectoriesConfig{Directories: []DirectoryConfig{{
+		Path:       tempDirectory,
+		Evaluation: EvaluationFirstMatch,
+		Rules: []RuleConfig{
+			{Name: "images", Handler: "ExtensionHandler", Extensions: []string{"png", "jpg"}, Target: filepath.Join(tempDirectory, "images")},
+			{Name: "pngs", Priority: 10, Handler: "ExtensionHandler", Extensions: []string{"png"}, Target: filepath.Join(tempDirectory, "pngs")},
+			{Name: "log", Priority: 20, Continue: true, Handler: "ExtensionHandler", Extensions: []string{"png"}, Command: &CommandConfig{
+				Path: "/bin/sh",
+				Args: []string{"-c", `echo "$1" >> "$2"`, "sh", "{name}", logPath},
+			}},
+		},
+	}}}
+	for _, ruleConf := range config.Directories[0].Rules {
+		if ruleConf.Target != "" {
+			os.Mkdir(ruleConf.Target, 0755)
+		}
+	}
+	directories := GetDirectories(config)
+	if directories[0].rules[0].name != "log" || directories[0].rules[2].name != "images" {
+		t.Errorf("Rules weren't sorted by priority. Got '%v'", directories[0].rules)
+	}
+
+	unmatched, err := directories[0].FirstMatch(context.Background())
+	if err != nil {
+		t.Fatalf("FirstMatch returned an error. Got '%v'", err)
+	}
+	if strings.Join(unmatched, ",") != "c.txt" {
+		t.Errorf("Mismatch in unmatched files. Got '%v', want 'c.txt'", unmatched)
+	}
+
+	// the continuing rule saw the pngs first, then the first rule that moved them stopped the evaluation
+	want := map[string]bool{"pngs/a.png": true, "pngs/d.png": true, "images/b.jpg": true, "images/a.png": false, "c.txt": true}
+	for name, exists := range want {
+		if _, statErr := os.Stat(filepath.Join(tempDirectory, name)); (statErr == nil) != exists {
+			t.Errorf("Mismatch in whether %v exists. Got '%v', want '%v'", name, statErr == nil, exists)
+		}
+	}
+	logged, _ := ioutil.ReadFile(logPath)
+	if got := strings.Fields(string(logged)); strings.Join(got, ",") != "a.png,d.png" {
+		t.Errorf("Mismatch in files seen by the continuing rule. Got '%v'", got)
+	}
+}
@@ -0,0 +1,180 @@
+package dirculese
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is something that happened while an Engine was running, which is delivered to the engine's subscribers (see
+// Engine.Subscribe). It's one of RunStarted, DirectoryScanned, FileMatched, FileMoved, FileDeleted, ConflictResolved,
+// FileSkipped, RuleFailed and RunFinished, which subscribers tell apart with a type switch. Directories are identified
+// by their labels (their names, or their paths if they don't have one), and rules by their names along with the label
+// of their directory, which are in separate fields. During a dry run, FileMoved, FileDeleted and ConflictResolved
+// describe what would have happened.
+type Event interface {
+	event()
+}
+
+// Subscriber is a function that an Engine calls with every event (see Engine.Subscribe).
+type Subscriber func(event Event)
+
+// RunStarted is sent when Engine.Run starts, with the ID of the run (which is in all of its log entries, see LogEntry)
+// and the number of enabled directories it's going to organize.
+type RunStarted struct {
+	Time        time.Time
+	RunID       string
+	Directories int
+	DryRun      bool
+}
+
+// DirectoryScanned is sent when a directory has been read for the run, with the number of entries in it and the number
+// of files that were skipped because they aren't stable yet (see Stability).
+type DirectoryScanned struct {
+	Time      time.Time
+	Directory string
+	Path      string
+	Entries   int
+	Unstable  int
+}
+
+// FileMatched is sent when a rule's handler matches a file, before the rule acts on it.
+type FileMatched struct {
+	Time        time.Time
+	Directory   string
+	Rule        string
+	Path        string
+	Destination string
+}
+
+// FileMoved is sent when a rule has moved a file from From to To, with the size of the file in bytes.
+type FileMoved struct {
+	Time      time.Time
+	Directory string
+	Rule      string
+	From      string
+	To        string
+	Size      int64
+}
+
+// FileDeleted is sent when a rule has deleted a file (or a symlink whose file it handled), with the size of the file in
+// bytes.
+type FileDeleted struct {
+	Time      time.Time
+	Directory string
+	Rule      string
+	Path      string
+	Size      int64
+}
+
+// ConflictResolved is sent when a file couldn't be moved under its own name because a file with the same name already
+// exists in the destination. NewName is the name it was given instead, or empty if no free name was found and the file
+// was left where it was.
+type ConflictResolved struct {
+	Time        time.Time
+	Directory   string
+	Rule        string
+	Path        string
+	Destination string
+	NewName     string
+}
+
+// FileSkipped is sent when a file is left where it is on purpose, with the reason why: because it isn't stable yet (see
+// Stability), because no rule matched it in a directory that's evaluated with EvaluationFirstMatch, because it's a
+// symlink that doesn't point to a file (or isn't broken, for SymlinksClean), or because it was already handled through
+// a symlink. Rule is empty if the file was skipped by its directory rather than by one of
+// its rules. Files that are left where they are because their name is taken are sent as ConflictResolved instead.
+type FileSkipped struct {
+	Time      time.Time
+	Directory string
+	Rule      string
+	Path      string
+	Reason    string
+}
+
+// RuleFailed is sent when a rule stops because of an error.
+type RuleFailed struct {
+	Time      time.Time
+	Directory string
+	Rule      string
+	Err       error
+}
+
+// RunFinished is sent when Engine.Run is done, with how long the run took and the error it returned, if any.
+// Interrupted is set if the run was stopped early, because its context was cancelled or its time budget was used up.
+type RunFinished struct {
+	Time        time.Time
+	RunID       string
+	Duration    time.Duration
+	Err         error
+	Interrupted bool
+}
+
+func (RunStarted) event()       {}
+func (DirectoryScanned) event() {}
+func (FileMatched) event()      {}
+func (FileMoved) event()        {}
+func (FileDeleted) event()      {}
+func (ConflictResolved) event() {}
+func (FileSkipped) event()      {}
+func (RuleFailed) event()       {}
+func (RunFinished) event()      {}
+
+// ruleKey identifies a rule in the events of a run, by the label of its directory and the rule's name.
+type ruleKey struct {
+	directory string
+	rule      string
+}
+
+// eventBus delivers events to subscribers. Directories and files are handled by several goroutines when there are
+// workers, so deliveries are serialized by eventBus.delivery and every subscriber sees the events one at a time, in the
+// order they were sent. eventBus.mutex only guards the list of subscribers, so subscribing never waits for a delivery.
+type eventBus struct {
+	mutex       sync.Mutex
+	delivery    sync.Mutex
+	subscribers []Subscriber
+}
+
+// subscribe adds a subscriber to the bus. A subscriber that's added while an event is being delivered gets the events
+// after it.
+func (b *eventBus) subscribe(subscriber Subscriber) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.subscribers = append(b.subscribers, subscriber)
+}
+
+// publish delivers an event to every subscriber, in the order they subscribed.
+func (b *eventBus) publish(event Event) {
+	b.mutex.Lock()
+	subscribers := b.subscribers
+	b.mutex.Unlock()
+
+	b.delivery.Lock()
+	defer b.delivery.Unlock()
+	for _, subscriber := range subscribers {
+		subscriber(event)
+	}
+}
+
+// emit sends an event to the subscribers of the Engine that o belongs to, if there are any.
+func (o *Options) emit(event Event) {
+	if o != nil && o.bus != nil {
+		o.bus.publish(event)
+	}
+}
+
+// Subscribe makes the engine call subscriber with every event from now on. Subscribers are called synchronously, from
+// whichever goroutine the event happened in (but never by two goroutines at once), so the engine waits for them and
+// they shouldn't take long or block. They can subscribe other subscribers, but they must not call back into the engine
+// in any other way (e.g. by running it), since the events that causes would wait for the one being delivered.
+func (e *Engine) Subscribe(subscriber Subscriber) {
+	e.options.bus.subscribe(subscriber)
+}
+
+// SubscribeChannel makes the engine send every event from now on to events. The engine waits until each event is
+// received, so the channel should be buffered or read by another goroutine for as long as the engine runs (which is
+// until it sends RunFinished).
+func (e *Engine) SubscribeChannel(events chan<- Event) {
+	e.Subscribe(func(event Event) {
+		events <- event
+	})
+}
@@ -0,0 +1,89 @@
+package dirculese
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestEngine_Subscribe(t *testing.T) {
+	fs := NewMemFS()
+	fs.MkdirAll("/downloads", 0755)
+	fs.MkdirAll("/images", 0755)
+	fs.MkdirAll("/documents", 0755)
+	for _, name := range []string{"/downloads/a.png", "/downloads/b.txt", "/downloads/c.pdf", "/images/a.png"} {
+		fs.WriteFile(name, 1, 0644)
+	}
+
+	config := DirectoriesConfig{Directories: []DirectoryConfig{{
+		Path: "/downloads",
+		Name: "downloads",
+		Rules: []RuleConfig{
+			{Name: "images", Handler: "ExtensionHandler", Extensions: []string{"png"}, Target: "/images"},
+			{Name: "text", Handler: "ExtensionHandler", Extensions: []string{"txt"}, Delete: true},
+			{Name: "documents", Handler: "ExtensionHandler", Extensions: []string{"pdf"}, Target: "/documents"},
+		},
+	}}}
+	engine, err := New(config, Options{FS: fs})
+	if err != nil {
+		t.Fatalf("New returned an error. Got '%v'", err)
+	}
+	var got []string
+	engine.Subscribe(func(event Event) {
+		switch e := event.(type) {
+		case RunStarted:
+			got = append(got, fmt.Sprintf("RunStarted %v", e.Directories))
+		case DirectoryScanned:
+			got = append(got, fmt.Sprintf("DirectoryScanned %v %v", e.Directory, e.Entries))
+		case FileMatched:
+			got = append(got, "FileMatched "+e.Directory+"/"+e.Rule+" "+e.Path)
+		case FileMoved:
+			got = append(got, "FileMoved "+e.From+" "+e.To)
+		case FileDeleted:
+			got = append(got, "FileDeleted "+e.Path)
+		case ConflictResolved:
+			got = append(got, "ConflictResolved "+e.Path+" "+e.NewName)
+		case RuleFailed:
+			got = append(got, "RuleFailed "+e.Directory+"/"+e.Rule)
+		case RunFinished:
+			got = append(got, fmt.Sprintf("RunFinished %v", e.Err != nil))
+		}
+	})
+	events := make(chan Event, 100)
+	engine.SubscribeChannel(events)
+	// subscribers can subscribe others while an event is being delivered, which then get the events after it
+	var late int
+	engine.Subscribe(func(event Event) {
+		if _, ok := event.(RunStarted); ok {
+			engine.Subscribe(func(event Event) { late++ })
+		}
+	})
+
+	// the documents directory disappears after the configuration was checked, so its rule fails
+	fs.Remove("/documents")
+	if err = engine.Run(context.Background()); err == nil {
+		t.Error("Run didn't return the error of the failed rule")
+	}
+
+	want := []string{
+		"RunStarted 1",
+		"DirectoryScanned downloads 3",
+		"FileMatched downloads/images /downloads/a.png",
+		"ConflictResolved /downloads/a.png a0.png",
+		"FileMoved /downloads/a.png /images/a0.png",
+		"FileMatched downloads/text /downloads/b.txt",
+		"FileDeleted /downloads/b.txt",
+		"RuleFailed downloads/documents",
+		"RunFinished true",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Mismatch in events. Got '%v', want '%v'", got, want)
+	}
+	if len(events) != len(want) {
+		t.Errorf("Mismatch in the number of events sent to the channel. Got '%v', want '%v'", len(events), len(want))
+	}
+	if late != len(want)-1 {
+		t.Errorf("Mismatch in the number of events sent to the subscriber that was added during the run. Got '%v', want '%v'", late, len(want)-1)
+	}
+}
@@ -0,0 +1,206 @@
+package dirculese
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// XDGUserDirs is the list of well-known user directories that can be used in paths as {xdg:NAME}, e.g. {xdg:DOWNLOAD}.
+var XDGUserDirs = []string{"DESKTOP", "DOCUMENTS", "DOWNLOAD", "MUSIC", "PICTURES", "PUBLICSHARE", "TEMPLATES", "VIDEOS"}
+
+// ExpandPath expands a path from a configuration file so that the same file can be shared between machines. A leading
+// ~ or ~user is replaced by the user's home directory, $VAR and ${VAR} are replaced by the value of an environment
+// variable ($$ being a literal $), and {xdg:NAME} is replaced by one of the XDGUserDirs. ${VAR:-default} falls back to
+// the expanded default if the variable is unset or empty, and the default can contain other references, like
+// ${A:-${B}}. Variables and directories that can't be resolved are returned as an error.
+func ExpandPath(path string) (expanded string, err error) {
+	expanded, err = expandTilde(path)
+	if err != nil {
+		return
+	}
+	var builder strings.Builder
+	for i := 0; i < len(expanded); i++ {
+		var value string
+		var length int
+		switch {
+		case strings.HasPrefix(expanded[i:], "$$"):
+			value, length = "$", 2
+		case expanded[i] == '$':
+			value, length, err = expandVariable(expanded[i:])
+		case strings.HasPrefix(expanded[i:], "{xdg:"):
+			end := strings.Index(expanded[i:], "}")
+			if end < 0 {
+				return "", errors.New("missing \"}\" after \"{xdg:\"")
+			}
+			value, err = XDGUserDir(expanded[i+len("{xdg:") : i+end])
+			length = end + 1
+		default:
+			builder.WriteByte(expanded[i])
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		builder.WriteString(value)
+		i += length - 1
+	}
+	return builder.String(), nil
+}
+
+// expandTilde replaces a leading ~ or ~user in path with the matching home directory.
+func expandTilde(path string) (expanded string, err error) {
+	if !strings.HasPrefix(path, "~") {
+		return path, nil
+	}
+	name := path[1:]
+	rest := ""
+	if i := strings.IndexAny(name, `/\`); i >= 0 {
+		name, rest = name[:i], name[i:]
+	}
+	if name == "" {
+		var home string
+		home, err = GetUserHome()
+		return home + rest, err
+	}
+	account, err := user.Lookup(name)
+	if err != nil {
+		return "", errors.New("can't find the home directory of the user \"" + name + "\"")
+	}
+	return account.HomeDir + rest, nil
+}
+
+// expandVariable expands the $VAR, ${VAR} or ${VAR:-default} reference at the start of text, and returns its value and
+// the number of characters it took up.
+func expandVariable(text string) (value string, length int, err error) {
+	if strings.HasPrefix(text, "${") {
+		end := closingBrace(text)
+		if end < 0 {
+			return "", 0, errors.New("missing \"}\" after \"${\"")
+		}
+		name, fallback, hasFallback := text[2:end], "", false
+		if i := strings.Index(name, ":-"); i >= 0 {
+			name, fallback, hasFallback = name[:i], name[i+2:], true
+		}
+		value, ok := os.LookupEnv(name)
+		switch {
+		case hasFallback && value == "":
+			// like in a shell, the default is expanded too
+			value, err = ExpandPath(fallback)
+			return value, end + 1, err
+		case !ok:
+			return "", 0, errors.New("unresolved variable ${" + name + "}")
+		}
+		return value, end + 1, nil
+	}
+
+	// like in a shell, variable names can't start with a digit
+	length = 1
+	for length < len(text) && (text[length] == '_' || isAlphanumeric(text[length])) && (length > 1 || !isDigit(text[length])) {
+		length++
+	}
+	if length == 1 {
+		return "$", 1, nil
+	}
+	value, ok := os.LookupEnv(text[1:length])
+	if !ok {
+		return "", 0, errors.New("unresolved variable $" + text[1:length])
+	}
+	return value, length, nil
+}
+
+// closingBrace returns the index of the } that closes the ${ at the start of text, skipping over the references that
+// its default may contain (like ${B} in ${A:-${B}}), or -1 if there isn't one.
+func closingBrace(text string) int {
+	depth := 0
+	for i := 2; i < len(text); i++ {
+		switch {
+		case strings.HasPrefix(text[i:], "$$"):
+			i++
+		case text[i] == '{':
+			depth++
+		case text[i] == '}' && depth == 0:
+			return i
+		case text[i] == '}':
+			depth--
+		}
+	}
+	return -1
+}
+
+// isAlphanumeric reports whether c is an ASCII letter or digit.
+func isAlphanumeric(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || isDigit(c)
+}
+
+// isDigit reports whether c is an ASCII digit.
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// XDGUserDir returns one of the well-known XDGUserDirs (e.g. DOWNLOAD). Like xdg-user-dir, it uses the XDG_NAME_DIR
+// environment variable if it's set, and otherwise reads the user-dirs.dirs file in $XDG_CONFIG_HOME (or ~/.config).
+func XDGUserDir(name string) (path string, err error) {
+	name = strings.ToUpper(name)
+	if !oneOf(name, XDGUserDirs...) {
+		return "", errors.New("unrecognized XDG user directory \"" + name + "\"" + suggestion(name, XDGUserDirs))
+	}
+	key := "XDG_" + name + "_DIR"
+	if path = os.Getenv(key); path != "" {
+		return
+	}
+
+	home, err := GetUserHome()
+	if err != nil {
+		return
+	}
+	configHome, err := XDGDirectory("XDG_CONFIG_HOME", ".config")
+	if err != nil {
+		return
+	}
+	userDirs, err := os.Open(filepath.Join(configHome, "user-dirs.dirs"))
+	if err != nil {
+		return "", errors.New("can't find the XDG user directory " + name + ": " + err.Error())
+	}
+	defer userDirs.Close()
+
+	// lines look like XDG_DOWNLOAD_DIR="$HOME/Downloads"
+	scanner := bufio.NewScanner(userDirs)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, key+"=") {
+			continue
+		}
+		path = strings.Trim(strings.TrimPrefix(line, key+"="), "\"")
+		if strings.HasPrefix(path, "$HOME") {
+			path = home + strings.TrimPrefix(path, "$HOME")
+		}
+		return path, nil
+	}
+	return "", errors.New("the XDG user directory " + name + " isn't set in " + userDirs.Name())
+}
+
+// ExpandConfig expands (see ExpandPath) the directory paths and rule targets in a DirectoriesConfig struct in place,
+// and returns every value that couldn't be expanded.
+func ExpandConfig(config *DirectoriesConfig) (errs ConfigErrors) {
+	expand := func(value *string, configPath string) {
+		expanded, err := ExpandPath(*value)
+		if err != nil {
+			errs = append(errs, ConfigError{Path: configPath, Message: err.Error()})
+			return
+		}
+		*value = expanded
+	}
+	for i := range config.Directories {
+		directoryConf := &config.Directories[i]
+		directoryPath := indexConfigPath("Directories", i)
+		expand(&directoryConf.Path, joinConfigPath(directoryPath, "Path"))
+		for j := range directoryConf.Rules {
+			expand(&directoryConf.Rules[j].Target, joinConfigPath(indexConfigPath(joinConfigPath(directoryPath, "Rules"), j), "Target"))
+		}
+	}
+	return
+}
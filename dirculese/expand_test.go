@@ -0,0 +1,84 @@
+package dirculese
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandPath(t *testing.T) {
+	home, err := GetUserHome()
+	if err != nil {
+		t.Skip("this test needs a home directory")
+	}
+
+	configHome, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(configHome)
+	err = ioutil.WriteFile(filepath.Join(configHome, "user-dirs.dirs"), []byte("# written by xdg-user-dirs-update\nXDG_DOWNLOAD_DIR=\"$HOME/Downloads\"\nXDG_MUSIC_DIR=\"/srv/music\"\n"), 0644)
+	if err != nil {
+		t.Fatal("Couldn't write user-dirs.dirs: " + err.Error())
+	}
+
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", configHome)
+	os.Unsetenv("XDG_DOWNLOAD_DIR")
+	os.Unsetenv("XDG_MUSIC_DIR")
+	os.Unsetenv("XDG_VIDEOS_DIR")
+	os.Setenv("DIRCULESE_TEST_VARIABLE", "value")
+	os.Setenv("DIRCULESE_TEST_EMPTY", "")
+	os.Unsetenv("DIRCULESE_TEST_UNSET")
+	defer os.Unsetenv("DIRCULESE_TEST_VARIABLE")
+	defer os.Unsetenv("DIRCULESE_TEST_EMPTY")
+
+	tests := map[string]string{
+		"/absolute/path":                      "/absolute/path",
+		"~":                                   home,
+		"~/Downloads":                         home + "/Downloads",
+		"/not/~/expanded":                     "/not/~/expanded",
+		"/a/$DIRCULESE_TEST_VARIABLE/b":       "/a/value/b",
+		"/a/${DIRCULESE_TEST_VARIABLE}b":      "/a/valueb",
+		"/a/${DIRCULESE_TEST_UNSET:-default}": "/a/default",
+		"/a/${DIRCULESE_TEST_EMPTY:-default}": "/a/default",
+		"${DIRCULESE_TEST_UNSET:-~/archive}":  home + "/archive",
+		"/a/$DIRCULESE_TEST_EMPTY":            "/a/",
+		"/a/${DIRCULESE_TEST_UNSET:-${DIRCULESE_TEST_VARIABLE}}/b":             "/a/value/b",
+		"/a/${DIRCULESE_TEST_UNSET:-${DIRCULESE_TEST_EMPTY:-{xdg:music}/x}}/b": "/a//srv/music/x/b",
+		"/a/${DIRCULESE_TEST_UNSET:-$${DIRCULESE_TEST_VARIABLE}}":              "/a/${DIRCULESE_TEST_VARIABLE}",
+		"/a/$$DIRCULESE_TEST_VARIABLE":                                         "/a/$DIRCULESE_TEST_VARIABLE",
+		"/price/$5":                                                            "/price/$5",
+		"{xdg:DOWNLOAD}/torrents":                                              home + "/Downloads/torrents",
+		"{xdg:music}":                                                          "/srv/music",
+	}
+	for path, want := range tests {
+		if got, err := ExpandPath(path); got != want || err != nil {
+			t.Errorf("Mismatch in expansion of %v. Got '%v' (%v), want '%v'", path, got, err, want)
+		}
+	}
+
+	unresolved := []string{"$DIRCULESE_TEST_UNSET", "${DIRCULESE_TEST_UNSET}", "${DIRCULESE_TEST_VARIABLE", "${DIRCULESE_TEST_UNSET:-${DIRCULESE_TEST_VARIABLE}", "{xdg:VIDEOS}", "{xdg:DOWNLOADS}", "~dirculese-no-such-user"}
+	for _, path := range unresolved {
+		if got, err := ExpandPath(path); err == nil {
+			t.Errorf("Unresolvable path %v was expanded. Got '%v'", path, got)
+		}
+	}
+}
+
+func TestExpandConfig(t *testing.T) {
+	os.Unsetenv("DIRCULESE_TEST_UNSET")
+	config := DirectoriesConfig{Directories: []DirectoryConfig{{
+		Path:  "${DIRCULESE_TEST_UNSET:-/tmp}",
+		Rules: []RuleConfig{{Target: "$DIRCULESE_TEST_UNSET/archive"}},
+	}}}
+	errs := ExpandConfig(&config)
+	if config.Directories[0].Path != "/tmp" {
+		t.Errorf("Mismatch in path. Got '%v', want '/tmp'", config.Directories[0].Path)
+	}
+	if len(errs) != 1 || errs[0].Path != "Directories[0].Rules[0].Target" || !strings.Contains(errs[0].Message, "DIRCULESE_TEST_UNSET") {
+		t.Errorf("Unresolved variable wasn't reported. Got '%v'", errs)
+	}
+}
@@ -0,0 +1,93 @@
+package dirculese
+
+import (
+	"strings"
+)
+
+// HiddenIgnore, HiddenInclude and HiddenOnly are the policies a directory can have for hidden files (files whose names
+// start with a dot, like .DS_Store or .bashrc). By default hidden files are ignored, but they can also be handled like
+// any other file or be the only files that the directory's rules handle.
+const (
+	HiddenIgnore  = "Ignore"
+	HiddenInclude = "Include"
+	HiddenOnly    = "Only"
+)
+
+// CompoundExtensions are the well-known extensions that span more than one dot. They are used to find where a file's
+// name ends when it isn't matched by any of a rule's own extensions.
+var CompoundExtensions = []string{
+	"tar.gz",
+	"tar.bz2",
+	"tar.xz",
+	"tar.zst",
+	"tar.lz",
+	"tar.lz4",
+	"tar.lzma",
+	"tar.br",
+	"tar.Z",
+	"d.ts",
+	"d.mts",
+	"d.cts",
+	"min.js",
+	"min.css",
+	"js.map",
+}
+
+// IsHidden reports whether a file name is hidden, which means it starts with a dot.
+func IsHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// FileExtensions returns every extension that a file name could be said to have, longest first and without leading
+// dots. For example, backup.tar.gz has the extensions tar.gz and gz. The leading dot of a hidden file doesn't start an
+// extension, so .bashrc has no extensions at all and .config.json only has json. Like filepath.Ext, a name that ends
+// with a dot has no extension.
+func FileExtensions(name string) (extensions []string) {
+	if strings.HasSuffix(name, ".") {
+		return
+	}
+	parts := strings.Split(strings.TrimLeft(name, "."), ".")
+	for i := 1; i < len(parts); i++ {
+		extensions = append(extensions, strings.Join(parts[i:], "."))
+	}
+	return
+}
+
+// MatchExtension returns the longest of a file name's extensions (see FileExtensions) that is listed in extensions. An
+// empty entry in extensions matches names that don't have an extension. If ignoreCase is true, extensions are compared
+// case-insensitively, so JPG matches jpg.
+func MatchExtension(name string, extensions []string, ignoreCase bool) (extension string, ok bool) {
+	fileExtensions := FileExtensions(name)
+	if len(fileExtensions) == 0 {
+		fileExtensions = []string{""}
+	}
+	for _, fileExtension := range fileExtensions {
+		for _, candidate := range extensions {
+			if fileExtension == candidate || (ignoreCase && strings.EqualFold(fileExtension, candidate)) {
+				return fileExtension, true
+			}
+		}
+	}
+	return
+}
+
+// SplitExtension splits a file name into its base and its extension (including the dot). The extension is the longest
+// one that's listed in extensions or, failing that, in CompoundExtensions, and otherwise it's the last one, in the same
+// way as filepath.Ext. For example, backup.tar.gz is split into backup and .tar.gz. The leading dot of a hidden file is
+// always part of the base, so .bashrc is split into .bashrc and an empty extension.
+func SplitExtension(name string, extensions []string, ignoreCase bool) (base string, extension string) {
+	matched, ok := MatchExtension(name, extensions, ignoreCase)
+	if !ok {
+		matched, ok = MatchExtension(name, CompoundExtensions, true)
+	}
+	if !ok {
+		fileExtensions := FileExtensions(name)
+		if len(fileExtensions) > 0 {
+			matched = fileExtensions[len(fileExtensions)-1]
+		}
+	}
+	if matched == "" {
+		return name, ""
+	}
+	return name[:len(name)-len(matched)-1], name[len(name)-len(matched)-1:]
+}
@@ -0,0 +1,136 @@
+package dirculese
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestIsHidden(t *testing.T) {
+	want := map[string]bool{
+		".DS_Store":   true,
+		".bashrc":     true,
+		"notes.txt":   false,
+		"backup.tar.": false,
+	}
+	for name, hidden := range want {
+		if got := IsHidden(name); got != hidden {
+			t.Errorf("Wrong result for %v. Got '%v', want '%v'", name, got, hidden)
+		}
+	}
+}
+
+func TestFileExtensions(t *testing.T) {
+	want := map[string]string{
+		"photo.png":      "png",
+		"backup.tar.gz":  "tar.gz,gz",
+		".bashrc":        "",
+		".config.json":   "json",
+		"..hidden.d.ts":  "d.ts,ts",
+		"README":         "",
+		"trailing.dot.":  "",
+		"archive.v1.zip": "v1.zip,zip",
+	}
+	for name, extensions := range want {
+		if got := strings.Join(FileExtensions(name), ","); got != extensions {
+			t.Errorf("Wrong extensions for %v. Got '%v', want '%v'", name, got, extensions)
+		}
+	}
+}
+
+func TestMatchExtension(t *testing.T) {
+	type matchTest struct {
+		name       string
+		extensions []string
+		ignoreCase bool
+		want       string
+		ok         bool
+	}
+	matchTestTable := []matchTest{
+		{name: "photo.png", extensions: []string{"png"}, want: "png", ok: true},
+		{name: "photo.PNG", extensions: []string{"png"}, ok: false},
+		{name: "photo.PNG", extensions: []string{"png"}, ignoreCase: true, want: "PNG", ok: true},
+		{name: "backup.tar.gz", extensions: []string{"gz"}, want: "gz", ok: true},
+		{name: "backup.tar.gz", extensions: []string{"gz", "tar.gz"}, want: "tar.gz", ok: true},
+		{name: "types.d.ts", extensions: []string{"ts", "d.ts"}, want: "d.ts", ok: true},
+		{name: "README", extensions: []string{""}, want: "", ok: true},
+		{name: ".bashrc", extensions: []string{"bashrc"}, ok: false},
+	}
+	for _, m := range matchTestTable {
+		got, ok := MatchExtension(m.name, m.extensions, m.ignoreCase)
+		if got != m.want || ok != m.ok {
+			t.Errorf("Wrong match for %v. Got '%v' (%v), want '%v' (%v)", m.name, got, ok, m.want, m.ok)
+		}
+	}
+}
+
+func TestSplitExtension(t *testing.T) {
+	type splitTest struct {
+		name       string
+		extensions []string
+		base       string
+		extension  string
+	}
+	splitTestTable := []splitTest{
+		{name: "photo.png", base: "photo", extension: ".png"},
+		{name: "backup.tar.gz", base: "backup", extension: ".tar.gz"},
+		{name: "BACKUP.TAR.ZST", base: "BACKUP", extension: ".TAR.ZST"},
+		{name: "report.final.pdf", base: "report.final", extension: ".pdf"},
+		{name: "report.final.pdf", extensions: []string{"final.pdf"}, base: "report", extension: ".final.pdf"},
+		{name: ".bashrc", base: ".bashrc", extension: ""},
+		{name: ".config.json", base: ".config", extension: ".json"},
+		{name: "README", base: "README", extension: ""},
+	}
+	for _, s := range splitTestTable {
+		base, extension := SplitExtension(s.name, s.extensions, false)
+		if base != s.base || extension != s.extension {
+			t.Errorf("Wrong split for %v. Got '%v' and '%v', want '%v' and '%v'", s.name, base, extension, s.base, s.extension)
+		}
+	}
+}
+
+func TestDirectory_Contents_Hidden(t *testing.T) {
+	// get path to the directory the test is running in
+	_, dir, _, _ := runtime.Caller(0)
+	dir = filepath.FromSlash(strings.TrimRight(dir, "extension_tes.go"))
+
+	// create mock files inside the testdata directory
+	mockFiles := []string{".DS_Store", ".directory"}
+	for _, mockFile := range mockFiles {
+		f, err := os.OpenFile(dir+"testdata"+string(os.PathSeparator)+mockFile, os.O_RDONLY|os.O_CREATE, 0777)
+		if err != nil {
+			t.Error("Error while creating mock files for this test: " + err.Error())
+		} else {
+			f.Close()
+		}
+	}
+	defer func() {
+		for _, mockFile := range mockFiles {
+			os.Remove(dir + "testdata" + string(os.PathSeparator) + mockFile)
+		}
+	}()
+
+	want := map[string]string{
+		"":            "dirculese.test.json",
+		HiddenIgnore:  "dirculese.test.json",
+		HiddenInclude: ".DS_Store,.directory,dirculese.test.json",
+		HiddenOnly:    ".DS_Store,.directory",
+	}
+	for policy, files := range want {
+		testDirectory := Directory{path: dir + "testdata", hidden: policy}
+		fileInfos, err := testDirectory.Contents(context.Background())
+		if err != nil {
+			t.Error("Error while getting the contents of " + testDirectory.path + ": " + err.Error())
+		}
+		var names []string
+		for _, fileInfo := range fileInfos {
+			names = append(names, fileInfo.Name())
+		}
+		if got := strings.Join(names, ","); got != files {
+			t.Errorf("Incorrect filelist for the policy '%v'. Got '%v', want '%v'", policy, got, files)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package dirculese
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// ConfigFormatJSON, ConfigFormatYAML and ConfigFormatTOML are the formats that a dirculese configuration file can be
+// written in.
+const (
+	ConfigFormatJSON = "json"
+	ConfigFormatYAML = "yaml"
+	ConfigFormatTOML = "toml"
+)
+
+// ConfigFormats is the list of formats that can be used with the -format flag.
+var ConfigFormats = []string{ConfigFormatJSON, ConfigFormatYAML, ConfigFormatTOML}
+
+// GetConfigFormat returns the format of the configuration file at path. If a format was specified (e.g. with the
+// -format flag), it is used verbatim. Otherwise, the format is chosen by the file's extension (see
+// FormatFromExtension).
+func GetConfigFormat(path string, format string) string {
+	if format != "" {
+		return strings.ToLower(format)
+	}
+	return FormatFromExtension(path)
+}
+
+// FormatFromExtension returns the configuration format that matches the extension of path: .yaml and .yml files are
+// YAML, .toml files are TOML and everything else is JSON.
+func FormatFromExtension(path string) (format string) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ConfigFormatYAML
+	case ".toml":
+		return ConfigFormatTOML
+	}
+	return ConfigFormatJSON
+}
+
+// ParseConfigTree parses the contents of a configuration file in the given format into a tree of generic values (see
+// ParseJSONConfigTree), along with the position of every field and list item and the comments that came right before
+// them, keyed by configuration path. JSON doesn't have comments, so JSON files never return any.
+func ParseConfigTree(data []byte, format string) (tree interface{}, positions map[string]ConfigPosition, comments map[string][]string, err error) {
+	switch format {
+	case ConfigFormatJSON:
+		tree, positions, err = ParseJSONConfigTree(data)
+		return tree, positions, make(map[string][]string), err
+	case ConfigFormatYAML:
+		return ParseYAMLConfigTree(data)
+	case ConfigFormatTOML:
+		return ParseTOMLConfigTree(data)
+	}
+	return nil, nil, nil, errors.New("unrecognized configuration format \"" + format + "\"" + suggestion(format, ConfigFormats))
+}
+
+// WriteConfigTree writes a configuration tree to w in the given format. Fields are written in the order they're
+// declared in DirectoriesConfig and its children, and the comments are written right before the fields they belong to
+// (except in JSON, which doesn't have comments).
+func WriteConfigTree(w io.Writer, tree interface{}, comments map[string][]string, format string) (err error) {
+	t := reflect.TypeOf(DirectoriesConfig{})
+	switch format {
+	case ConfigFormatJSON:
+		return WriteJSONConfigTree(w, tree, t)
+	case ConfigFormatYAML:
+		return WriteYAMLConfigTree(w, tree, t, comments)
+	case ConfigFormatTOML:
+		return WriteTOMLConfigTree(w, tree, t, comments)
+	}
+	return errors.New("unrecognized configuration format \"" + format + "\"" + suggestion(format, ConfigFormats))
+}
+
+// WriteJSONConfigTree writes a configuration tree to w as indented JSON, with fields in the order they're declared in
+// the Go type t.
+func WriteJSONConfigTree(w io.Writer, tree interface{}, t reflect.Type) (err error) {
+	var buffer bytes.Buffer
+	err = writeJSONValue(&buffer, tree, t, "")
+	if err != nil {
+		return
+	}
+	buffer.WriteString("\n")
+	_, err = buffer.WriteTo(w)
+	return
+}
+
+// writeJSONValue adds a single value from a configuration tree to buffer, indenting nested values by two spaces.
+func writeJSONValue(buffer *bytes.Buffer, value interface{}, t reflect.Type, indent string) (err error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			buffer.WriteString("{}")
+			return
+		}
+		buffer.WriteString("{\n")
+		for i, key := range orderedKeys(v, t) {
+			if i > 0 {
+				buffer.WriteString(",\n")
+			}
+			buffer.WriteString(indent + "  " + jsonString(key) + ": ")
+			err = writeJSONValue(buffer, v[key], fieldType(t, key), indent+"  ")
+			if err != nil {
+				return
+			}
+		}
+		buffer.WriteString("\n" + indent + "}")
+	case []interface{}:
+		if len(v) == 0 {
+			buffer.WriteString("[]")
+			return
+		}
+		buffer.WriteString("[\n")
+		for i, item := range v {
+			if i > 0 {
+				buffer.WriteString(",\n")
+			}
+			buffer.WriteString(indent + "  ")
+			err = writeJSONValue(buffer, item, fieldType(t, ""), indent+"  ")
+			if err != nil {
+				return
+			}
+		}
+		buffer.WriteString("\n" + indent + "]")
+	case string:
+		buffer.WriteString(jsonString(v))
+	default:
+		var encoded []byte
+		encoded, err = json.Marshal(v)
+		buffer.Write(encoded)
+	}
+	return
+}
+
+// jsonString formats a string as JSON without escaping HTML characters, since a configuration file isn't HTML.
+func jsonString(value string) string {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
+// writeComments adds comment lines, indented by indent and starting with marker, to lines.
+func writeComments(lines *[]string, comments []string, indent string, marker string) {
+	for _, comment := range comments {
+		if comment == "" {
+			*lines = append(*lines, indent+marker)
+			continue
+		}
+		*lines = append(*lines, indent+marker+" "+comment)
+	}
+}
+
+// orderedKeys returns the keys of an object in the order that their fields are declared in the Go type t, followed by
+// any keys that t doesn't have in alphabetical order. If t isn't a struct, all the keys are returned in alphabetical
+// order.
+func orderedKeys(object map[string]interface{}, t reflect.Type) (keys []string) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	used := make(map[string]bool)
+	if t != nil && t.Kind() == reflect.Struct {
+		for i := 0; i < t.NumField(); i++ {
+			for _, key := range sortedKeys(object) {
+				if !used[key] && strings.EqualFold(key, t.Field(i).Name) {
+					keys = append(keys, key)
+					used[key] = true
+				}
+			}
+		}
+	}
+	for _, key := range sortedKeys(object) {
+		if !used[key] {
+			keys = append(keys, key)
+		}
+	}
+	return
+}
+
+// fieldType returns the Go type of the value found at key inside a value of type t: the type of the matching field for
+// structs and the element type for maps and slices. It returns nil if the type isn't known.
+func fieldType(t reflect.Type, key string) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if field, ok := configField(t, key); ok {
+			return field.Type
+		}
+	case reflect.Map, reflect.Slice:
+		return t.Elem()
+	}
+	return nil
+}
+
+// Migrate is the migrate command. It converts the configuration file at configFilePath, which is in the given format
+// (see GetConfigFormat), into the format that matches the extension of outputPath (see FormatFromExtension) and writes
+// it there, keeping any comments the original file had. Migrate refuses to overwrite a file that already exists.
+func Migrate(configFilePath string, format string, outputPath string) (err error) {
+	if outputPath == "" {
+		return errors.New("you need to specify where to write the migrated configuration file with the -output flag")
+	}
+	data, err := ioutil.ReadFile(configFilePath)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	tree, positions, comments, err := ParseConfigTree(data, GetConfigFormat(configFilePath, format))
+	if err != nil {
+		return
+	}
+	if errs := CheckConfigTree(tree, reflect.TypeOf(DirectoriesConfig{}), ""); len(errs) > 0 {
+		errs.locate(positions)
+		errs.sort()
+		return errs
+	}
+
+	return WriteConfigFile(outputPath, tree, comments)
+}
+
+// WriteConfigFile writes a configuration tree and its comments to a new file at path, in the format that matches its
+// extension (see FormatFromExtension). It refuses to overwrite a file that already exists.
+func WriteConfigFile(path string, tree interface{}, comments map[string][]string) (err error) {
+	outputFile, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	err = WriteConfigTree(outputFile, tree, comments, FormatFromExtension(path))
+	if closeErr := outputFile.Close(); err == nil && closeErr != nil {
+		err = errors.New(closeErr.Error())
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return
+}
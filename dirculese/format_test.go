@@ -0,0 +1,86 @@
+package dirculese
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestGetConfigFormat(t *testing.T) {
+	tests := map[string]string{
+		"/home/user/.dirculese.json": ConfigFormatJSON,
+		"/home/user/.dirculese.YAML": ConfigFormatYAML,
+		"/home/user/.dirculese.yml":  ConfigFormatYAML,
+		"/home/user/.dirculese.toml": ConfigFormatTOML,
+		"/home/user/.dirculese":      ConfigFormatJSON,
+	}
+	for path, want := range tests {
+		if got := GetConfigFormat(path, ""); got != want {
+			t.Errorf("Mismatch in format of %v. Got '%v', want '%v'", path, got, want)
+		}
+	}
+
+	if got := GetConfigFormat("/home/user/.dirculese.json", "TOML"); got != ConfigFormatTOML {
+		t.Errorf("The format wasn't used. Got '%v', want '%v'", got, ConfigFormatTOML)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	// get path to the directory the test is running in
+	_, dir, _, _ := runtime.Caller(0)
+	dir = filepath.FromSlash(strings.TrimRight(dir, "format_tes.go"))
+
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+
+	yamlPath := filepath.Join(tempDirectory, "dirculese.yaml")
+	err = ioutil.WriteFile(yamlPath, []byte(`Directories:
+  # downloads
+  - Path: `+dir+`testdata
+    Rules:
+      - Target: `+dir+`testdata
+        Handler: ExtensionHandler
+        Extensions: [png]
+`), 0644)
+	if err != nil {
+		t.Fatal("Couldn't write the YAML configuration file: " + err.Error())
+	}
+	want, err := GetConfigStruct(yamlPath, "")
+	if err != nil {
+		t.Fatalf("Couldn't load the YAML configuration file. Got '%v'", err)
+	}
+
+	// every format should load into the same configuration, and comments should survive where they can
+	tomlPath := filepath.Join(tempDirectory, "dirculese.toml")
+	jsonPath := filepath.Join(tempDirectory, "dirculese.json")
+	if err = Migrate(yamlPath, "", tomlPath); err != nil {
+		t.Fatalf("Couldn't migrate to TOML. Got '%v'", err)
+	}
+	if err = Migrate(tomlPath, "", jsonPath); err != nil {
+		t.Fatalf("Couldn't migrate to JSON. Got '%v'", err)
+	}
+	for _, path := range []string{tomlPath, jsonPath} {
+		got, err := GetConfigStruct(path, "")
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("Mismatch in migrated configuration %v. Got '%v' (%v), want '%v'", path, got, err, want)
+		}
+	}
+	if contents, _ := ioutil.ReadFile(tomlPath); !strings.HasPrefix(string(contents), "# downloads\n") {
+		t.Errorf("Comment wasn't kept. Got '%v'", string(contents))
+	}
+
+	// existing files are never overwritten
+	if err = Migrate(yamlPath, "", jsonPath); err == nil {
+		t.Error("Migrate overwrote an existing file")
+	}
+	if err = Migrate(yamlPath, "", ""); err == nil {
+		t.Error("Migrate didn't return an error without an output path")
+	}
+}
@@ -0,0 +1,101 @@
+package dirculese
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// FS is the filesystem that an Engine organizes. Every file operation that rules and handlers make goes through it,
+// except for external commands and hooks, which always run against the real filesystem. OSFS is the operating system's
+// filesystem, MemFS keeps everything in memory for tests and simulations, and ReadOnlyFS refuses to change anything.
+// ReadDir returns the entries of a directory in no particular order.
+type FS interface {
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+	Readlink(name string) (string, error)
+	EvalSymlinks(path string) (string, error)
+	MkdirAll(path string, perm os.FileMode) error
+	Rename(oldpath string, newpath string) error
+	Remove(name string) error
+	Symlink(oldname string, newname string) error
+}
+
+// ErrReadOnly is the error that a ReadOnlyFS returns (wrapped in an *os.PathError or *os.LinkError) for every change
+// that it's asked to make.
+var ErrReadOnly = errors.New("the filesystem is read-only")
+
+// OSFS is the operating system's filesystem, which is what an Engine uses unless it's given another one.
+type OSFS struct{}
+
+// Stat is os.Stat.
+func (OSFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// Lstat is os.Lstat.
+func (OSFS) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+// ReadDir reads the directory with ReadDirectory.
+func (OSFS) ReadDir(name string) ([]os.FileInfo, error) {
+	return ReadDirectory(name)
+}
+
+// Readlink is os.Readlink.
+func (OSFS) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+// EvalSymlinks is filepath.EvalSymlinks.
+func (OSFS) EvalSymlinks(path string) (string, error) {
+	return filepath.EvalSymlinks(path)
+}
+
+// MkdirAll is os.MkdirAll.
+func (OSFS) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+// Rename is os.Rename.
+func (OSFS) Rename(oldpath string, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// Remove is os.Remove.
+func (OSFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// Symlink is os.Symlink.
+func (OSFS) Symlink(oldname string, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+// ReadOnlyFS wraps another FS, passing every read through to it and refusing every change with ErrReadOnly. Dry runs
+// use it, so that nothing can be changed by accident even if a handler doesn't check for them.
+type ReadOnlyFS struct {
+	FS
+}
+
+// MkdirAll refuses to create the directory.
+func (ReadOnlyFS) MkdirAll(path string, perm os.FileMode) error {
+	return &os.PathError{Op: "mkdir", Path: path, Err: ErrReadOnly}
+}
+
+// Rename refuses to rename the file.
+func (ReadOnlyFS) Rename(oldpath string, newpath string) error {
+	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: ErrReadOnly}
+}
+
+// Remove refuses to remove the file.
+func (ReadOnlyFS) Remove(name string) error {
+	return &os.PathError{Op: "remove", Path: name, Err: ErrReadOnly}
+}
+
+// Symlink refuses to create the symlink.
+func (ReadOnlyFS) Symlink(oldname string, newname string) error {
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrReadOnly}
+}
@@ -0,0 +1,31 @@
+package dirculese
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReadOnlyFS(t *testing.T) {
+	memFS := NewMemFS()
+	memFS.MkdirAll("/downloads", 0755)
+	memFS.WriteFile("/downloads/a.png", 0, 0644)
+	fs := ReadOnlyFS{memFS}
+
+	if _, err := fs.Stat("/downloads/a.png"); err != nil {
+		t.Errorf("Reads weren't passed through. Got '%v'", err)
+	}
+	changes := map[string]error{
+		"MkdirAll": fs.MkdirAll("/images", 0755),
+		"Rename":   fs.Rename("/downloads/a.png", "/downloads/b.png"),
+		"Remove":   fs.Remove("/downloads/a.png"),
+		"Symlink":  fs.Symlink("a.png", "/downloads/link"),
+	}
+	for name, err := range changes {
+		if !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%v wasn't refused. Got '%v'", name, err)
+		}
+	}
+	if files, _ := memFS.ReadDir("/downloads"); len(files) != 1 || files[0].Name() != "a.png" {
+		t.Errorf("The wrapped filesystem was changed. Got '%v'", files)
+	}
+}
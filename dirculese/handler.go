@@ -0,0 +1,291 @@
+package dirculese
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Handler decides which items in a rule's source directory the rule applies to, and what happens to them. Handlers are
+// registered by name with RegisterHandler, and rules pick one with their Handler setting.
+//
+// Options returns a pointer to a new, empty value of the handler's options, which a rule's Options setting is decoded
+// into (the fields of an options struct can have a description tag, which is shown by HandlerOptions). Handlers that
+// don't take any options return nil. Validate checks a rule's settings and its decoded options before anything is run,
+// returning ConfigErrors whose paths are relative to the rule (e.g. Extensions or Options.Pattern). Match reports
+// whether the handler matches an item f in the rule's source directory, and if so, the directory it should be moved
+// into. Act performs the rule's action on a matched item, which is usually done with Rule.Apply. Handlers should use
+// Rule.FS for anything else they do with files.
+type Handler interface {
+	Description() string
+	Options() interface{}
+	Validate(rule RuleConfig, options interface{}) ConfigErrors
+	Match(rule *Rule, f os.FileInfo) (destination string, ok bool)
+	Act(rule *Rule, f os.FileInfo, destination string) error
+}
+
+// HandlerOption describes one of the fields of a handler's options (see HandlerOptions).
+type HandlerOption struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// handlers is the registry of handlers by name, and handlerNames is the order they were registered in.
+var (
+	handlers      = make(map[string]Handler)
+	handlerNames  []string
+	handlersMutex sync.RWMutex
+)
+
+func init() {
+	RegisterHandler("ExtensionHandler", extensionHandler{})
+	RegisterHandler("PrefixHandler", prefixHandler{})
+	RegisterHandler("SuffixHandler", suffixHandler{})
+	RegisterHandler("BrokenSymlinkHandler", brokenSymlinkHandler{})
+}
+
+// RegisterHandler makes a handler available to rules under the given name. It returns an error if the name is empty,
+// contains whitespace or is already taken.
+func RegisterHandler(name string, handler Handler) (err error) {
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		return errors.New("\"" + name + "\" isn't a valid handler name")
+	}
+	if handler == nil {
+		return errors.New("the handler " + name + " is nil")
+	}
+	handlersMutex.Lock()
+	defer handlersMutex.Unlock()
+	if _, ok := handlers[name]; ok {
+		return errors.New("there is already a handler called " + name)
+	}
+	handlers[name] = handler
+	handlerNames = append(handlerNames, name)
+	return
+}
+
+// LookupHandler returns the handler registered under the given name.
+func LookupHandler(name string) (handler Handler, ok bool) {
+	handlersMutex.RLock()
+	defer handlersMutex.RUnlock()
+	handler, ok = handlers[name]
+	return
+}
+
+// HandlerNames returns the names of every registered handler, in the order they were registered in (the built-in ones
+// come first).
+func HandlerNames() (names []string) {
+	handlersMutex.RLock()
+	defer handlersMutex.RUnlock()
+	return append(names, handlerNames...)
+}
+
+// HandlerOptions describes the fields of a handler's options, in the order they're declared in. Handlers that don't
+// take any options have none.
+func HandlerOptions(handler Handler) (options []HandlerOption) {
+	value := handler.Options()
+	if value == nil {
+		return
+	}
+	t := reflect.TypeOf(value)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		options = append(options, HandlerOption{Name: field.Name, Type: optionType(field.Type), Description: field.Tag.Get("description")})
+	}
+	return
+}
+
+// optionType describes the type of an option the way the configuration file spells it.
+func optionType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return optionType(t.Elem())
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "whole number"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "list of " + optionType(t.Elem()) + "s"
+	}
+	return "object"
+}
+
+// decodeHandlerOptions decodes a rule's raw Options setting, which is found at configPath, into a new value of the
+// handler's options. The options are checked for unknown fields and values of the wrong type first (see
+// CheckConfigTree), so that their problems are reported like the rest of the configuration file's.
+func decodeHandlerOptions(handler Handler, raw json.RawMessage, configPath string) (options interface{}, errs ConfigErrors) {
+	options = handler.Options()
+	if len(raw) == 0 || string(raw) == "null" {
+		return
+	}
+	if options == nil {
+		return nil, ConfigErrors{{Path: configPath, Message: "this handler doesn't take any options"}}
+	}
+	var tree interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, ConfigErrors{{Path: configPath, Message: err.Error()}}
+	}
+	if errs = CheckConfigTree(tree, reflect.TypeOf(options), configPath); len(errs) > 0 {
+		return nil, errs
+	}
+	if err := json.Unmarshal(raw, options); err != nil {
+		return nil, ConfigErrors{{Path: configPath, Message: err.Error()}}
+	}
+	return
+}
+
+// extensionHandler is the ExtensionHandler (see Rule.ExtensionHandler).
+type extensionHandler struct{}
+
+func (extensionHandler) Description() string {
+	return "handles files with one of the rule's Extensions (compared case-insensitively if IgnoreCase is set)"
+}
+
+func (extensionHandler) Options() interface{} {
+	return nil
+}
+
+func (extensionHandler) Validate(rule RuleConfig, options interface{}) (errs ConfigErrors) {
+	if len(rule.Extensions) < 1 {
+		errs = append(errs, ConfigError{Path: "Extensions", Message: "you need to specify at least one extension"})
+	}
+	return
+}
+
+// Match matches files that have one of the extensions in the r.extensions slice (see MatchExtension).
+func (extensionHandler) Match(r *Rule, f os.FileInfo) (destination string, ok bool) {
+	if f.IsDir() {
+		return
+	}
+	_, ok = MatchExtension(f.Name(), r.extensions, r.ignoreCase)
+	return r.TargetPath(), ok
+}
+
+func (extensionHandler) Act(r *Rule, f os.FileInfo, destination string) error {
+	return r.Apply(f, destination)
+}
+
+// prefixHandler is the PrefixHandler (see Rule.PrefixHandler).
+type prefixHandler struct{}
+
+func (prefixHandler) Description() string {
+	return "handles files whose names contain one of the rule's PrefixDelimiters, moving them into a subdirectory named after the part before it"
+}
+
+func (prefixHandler) Options() interface{} {
+	return nil
+}
+
+func (prefixHandler) Validate(rule RuleConfig, options interface{}) ConfigErrors {
+	return validateDelimiters(rule.PrefixDelimiters, "PrefixDelimiters", "prefix")
+}
+
+// Match matches files whose name portion contains one of the r.prefixDelimiters, and sends them to the subdirectory of
+// r.target named after the part of the name before the delimiter.
+func (prefixHandler) Match(r *Rule, f os.FileInfo) (destination string, ok bool) {
+	if f.IsDir() {
+		return
+	}
+	fileName, _ := SplitExtension(f.Name(), r.extensions, r.ignoreCase)
+	for _, prefix := range r.prefixDelimiters {
+		result := strings.Split(fileName, prefix)
+		if len(result) > 1 {
+			return r.TargetPath() + string(os.PathSeparator) + result[0], true
+		}
+	}
+	return
+}
+
+func (prefixHandler) Act(r *Rule, f os.FileInfo, destination string) error {
+	return r.Apply(f, destination)
+}
+
+// suffixHandler is the SuffixHandler (see Rule.SuffixHandler).
+type suffixHandler struct{}
+
+func (suffixHandler) Description() string {
+	return "handles files whose names contain one of the rule's SuffixDelimiters, moving them into a subdirectory named after the part after it"
+}
+
+func (suffixHandler) Options() interface{} {
+	return nil
+}
+
+func (suffixHandler) Validate(rule RuleConfig, options interface{}) ConfigErrors {
+	return validateDelimiters(rule.SuffixDelimiters, "SuffixDelimiters", "suffix")
+}
+
+// Match matches files whose name portion contains one of the r.suffixDelimiters, and sends them to the subdirectory of
+// r.target named after the part of the name after the delimiter.
+func (suffixHandler) Match(r *Rule, f os.FileInfo) (destination string, ok bool) {
+	if f.IsDir() {
+		return
+	}
+	fileName, _ := SplitExtension(f.Name(), r.extensions, r.ignoreCase)
+	for _, suffix := range r.suffixDelimiters {
+		result := strings.Split(fileName, suffix)
+		if len(result) > 1 {
+			return r.TargetPath() + string(os.PathSeparator) + result[1], true
+		}
+	}
+	return
+}
+
+func (suffixHandler) Act(r *Rule, f os.FileInfo, destination string) error {
+	return r.Apply(f, destination)
+}
+
+// validateDelimiters checks the prefix or suffix delimiters of a rule, which are found at the field called field.
+func validateDelimiters(delimiters []string, field string, kind string) (errs ConfigErrors) {
+	if len(delimiters) < 1 {
+		errs = append(errs, ConfigError{Path: field, Message: "you need to specify at least one " + kind + " delimiter"})
+	} else if oneOf("", delimiters...) {
+		errs = append(errs, ConfigError{Path: field, Message: kind + " delimiters can't be empty"})
+	}
+	return
+}
+
+// brokenSymlinkHandler is the BrokenSymlinkHandler (see Rule.BrokenSymlinkHandler).
+type brokenSymlinkHandler struct{}
+
+func (brokenSymlinkHandler) Description() string {
+	return "handles symlinks that point to something which doesn't exist, regardless of the rule's Symlinks policy"
+}
+
+func (brokenSymlinkHandler) Options() interface{} {
+	return nil
+}
+
+func (brokenSymlinkHandler) Validate(rule RuleConfig, options interface{}) ConfigErrors {
+	return nil
+}
+
+// Match matches symlinks that point to something which doesn't exist.
+func (brokenSymlinkHandler) Match(r *Rule, f os.FileInfo) (destination string, ok bool) {
+	filePath := r.source.path + string(os.PathSeparator) + f.Name()
+	return r.TargetPath(), f.Mode()&os.ModeSymlink != 0 && isBrokenSymlink(r.FS(), filePath)
+}
+
+// Act acts on broken symlinks directly, because the rule's r.symlinks policy doesn't apply to them.
+func (brokenSymlinkHandler) Act(r *Rule, f os.FileInfo, destination string) error {
+	return r.act(f, r.source.path+string(os.PathSeparator)+f.Name(), destination, r.delete)
+}
@@ -0,0 +1,147 @@
+package dirculese
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// globHandler is a handler with options, which matches files whose names match its pattern.
+type globHandler struct{}
+
+type globOptions struct {
+	Pattern   string `description:"a shell pattern that file names have to match"`
+	Lowercase bool   `description:"compare lowercased file names"`
+}
+
+func (globHandler) Description() string {
+	return "handles files whose names match a pattern"
+}
+
+func (globHandler) Options() interface{} {
+	return &globOptions{}
+}
+
+func (globHandler) Validate(rule RuleConfig, options interface{}) (errs ConfigErrors) {
+	if _, err := filepath.Match(options.(*globOptions).Pattern, ""); err != nil || options.(*globOptions).Pattern == "" {
+		errs = append(errs, ConfigError{Path: "Options.Pattern", Message: "you need to specify a valid pattern"})
+	}
+	return
+}
+
+func (globHandler) Match(r *Rule, f os.FileInfo) (destination string, ok bool) {
+	options := r.Options().(*globOptions)
+	name := f.Name()
+	if options.Lowercase {
+		name = strings.ToLower(name)
+	}
+	ok, _ = filepath.Match(options.Pattern, name)
+	return r.TargetPath(), ok && !f.IsDir()
+}
+
+func (globHandler) Act(r *Rule, f os.FileInfo, destination string) error {
+	return r.Apply(f, destination)
+}
+
+func init() {
+	RegisterHandler("GlobHandler", globHandler{})
+}
+
+func TestRegisterHandler(t *testing.T) {
+	for _, name := range []string{"", "Two Words", "ExtensionHandler"} {
+		if err := RegisterHandler(name, globHandler{}); err == nil {
+			t.Errorf("Registering a handler called '%v' didn't return an error", name)
+		}
+	}
+	if names := HandlerNames(); strings.Join(names[:4], ",") != "ExtensionHandler,PrefixHandler,SuffixHandler,BrokenSymlinkHandler" {
+		t.Errorf("The built-in handlers weren't registered first. Got '%v'", names)
+	}
+	if _, ok := LookupHandler("GlobHandler"); !ok {
+		t.Error("A registered handler couldn't be looked up")
+	}
+}
+
+func TestHandlerOptions(t *testing.T) {
+	handler, _ := LookupHandler("GlobHandler")
+	want := []HandlerOption{
+		{Name: "Pattern", Type: "string", Description: "a shell pattern that file names have to match"},
+		{Name: "Lowercase", Type: "true or false", Description: "compare lowercased file names"},
+	}
+	got := HandlerOptions(handler)
+	if len(got) != len(want) {
+		t.Fatalf("Mismatch in options. Got '%v', want '%v'", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Mismatch in option. Got '%v', want '%v'", got[i], want[i])
+		}
+	}
+	extension, _ := LookupHandler("ExtensionHandler")
+	if got := HandlerOptions(extension); len(got) != 0 {
+		t.Errorf("The ExtensionHandler has options. Got '%v'", got)
+	}
+}
+
+func TestValidateConfig_HandlerOptions(t *testing.T) {
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+
+	tests := map[string]string{
+		`{"Pattern": "*.png", "Lowercase": true}`: "",
+		`{"Pattern": "*.png", "Colour": true}`:    "Directories[0].Rules[0].Options.Colour: unknown field",
+		`{"Pattern": 5}`:                          "Directories[0].Rules[0].Options.Pattern: should be a string",
+		`{"Pattern": "["}`:                        "Directories[0].Rules[0].Options.Pattern: you need to specify a valid pattern",
+	}
+	for options, want := range tests {
+		config := DirectoriesConfig{Directories: []DirectoryConfig{{
+			Path:  tempDirectory,
+			Rules: []RuleConfig{{Handler: "GlobHandler", Options: json.RawMessage(options), Delete: true}},
+		}}}
+		got := ValidateConfig(config).Error()
+		if !strings.HasPrefix(got, want) || (want == "" && got != "") {
+			t.Errorf("Mismatch in errors for %v. Got '%v', want '%v'", options, got, want)
+		}
+	}
+
+	config := DirectoriesConfig{Directories: []DirectoryConfig{{
+		Path:  tempDirectory,
+		Rules: []RuleConfig{{Handler: "ExtensionHandler", Extensions: []string{"png"}, Options: json.RawMessage(`{}`), Delete: true}},
+	}}}
+	if got := ValidateConfig(config).Error(); got != "Directories[0].Rules[0].Options: this handler doesn't take any options" {
+		t.Errorf("Options were accepted by a handler without any. Got '%v'", got)
+	}
+}
+
+func TestRule_Handler_Registered(t *testing.T) {
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+	for _, name := range []string{"a.PNG", "b.png", "c.txt"} {
+		ioutil.WriteFile(filepath.Join(tempDirectory, name), []byte{}, 0644)
+	}
+
+	config := DirectoriesConfig{Directories: []DirectoryConfig{{
+		Path:  tempDirectory,
+		Rules: []RuleConfig{{Handler: "GlobHandler", Options: json.RawMessage(`{"Pattern": "*.png", "Lowercase": true}`), Delete: true}},
+	}}}
+	engine, err := New(config, Options{})
+	if err != nil {
+		t.Fatalf("New returned an error. Got '%v'", err)
+	}
+	if err = engine.Run(context.Background()); err != nil {
+		t.Fatalf("Run returned an error. Got '%v'", err)
+	}
+	files, _ := ioutil.ReadDir(tempDirectory)
+	if len(files) != 1 || files[0].Name() != "c.txt" {
+		t.Errorf("The registered handler didn't delete the matching files. Got '%v'", files)
+	}
+}
@@ -0,0 +1,284 @@
+package dirculese
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// LoadConfigTree reads the configuration file at path (in the given format, see GetConfigFormat) and parses it into a
+// tree of generic values (see ParseConfigTree), along with the position of every field and list item. Any files listed
+// in its Include setting are loaded the same way (so they can include other files too) and merged into it in order:
+// objects are merged field by field, lists are appended to and every other value is replaced. Includes can be globs
+// (e.g. conf.d/*.yaml, which are merged in alphabetical order) and relative includes are relative to the file that
+// includes them. Problems with an included file are returned as ConfigErrors that point to that file.
+func LoadConfigTree(path string, format string) (tree interface{}, positions map[string]ConfigPosition, err error) {
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, errors.New(err.Error())
+	}
+	return loadConfigTree(path, GetConfigFormat(path, format), "", []string{absolutePath})
+}
+
+// loadConfigTree loads a single configuration file and the files it includes. file is the name used for the file's
+// positions and errors, which is empty for the main configuration file, and stack is the list of files that are
+// already being loaded, which is used to catch files that include themselves.
+func loadConfigTree(path string, format string, file string, stack []string) (tree interface{}, positions map[string]ConfigPosition, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, errors.New(err.Error())
+	}
+	tree, positions, _, err = ParseConfigTree(data, format)
+	if errs, ok := err.(ConfigErrors); ok {
+		for i := range errs {
+			errs[i].File = file
+		}
+	}
+	if err != nil {
+		return
+	}
+	for configPath, position := range positions {
+		position.File = file
+		positions[configPath] = position
+	}
+
+	object, ok := tree.(map[string]interface{})
+	includeKey, hasIncludes := lookupKey(object, "Include")
+	includes, _ := object[includeKey].([]interface{})
+	if !ok || !hasIncludes {
+		return
+	}
+
+	var errs ConfigErrors
+	for i, include := range includes {
+		includePath := indexConfigPath(includeKey, i)
+		pattern, _ := include.(string)
+		matches, includeErr := globInclude(pattern, filepath.Dir(path))
+		if includeErr != nil {
+			errs = append(errs, ConfigError{Path: includePath, Message: includeErr.Error()})
+			continue
+		}
+		for _, match := range matches {
+			if oneOf(match, stack...) {
+				errs = append(errs, ConfigError{Path: includePath, Message: match + " includes itself"})
+				continue
+			}
+			includedTree, includedPositions, includeErr := loadConfigTree(match, FormatFromExtension(match), match, append(stack, match))
+			if includedErrs, ok := includeErr.(ConfigErrors); ok {
+				errs = append(errs, includedErrs...)
+				continue
+			} else if includeErr != nil {
+				errs = append(errs, ConfigError{Path: includePath, Message: includeErr.Error()})
+				continue
+			}
+			if includedObject, ok := includedTree.(map[string]interface{}); ok {
+				mergeConfigTree(object, includedObject, "", "", positions, includedPositions)
+			} else if includedTree != nil {
+				errs = append(errs, ConfigError{File: match, Line: 1, Column: 1, Message: "should be an object"})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		errs.locate(positions)
+		errs.sort()
+		return nil, nil, errs
+	}
+	return
+}
+
+// globInclude returns the absolute paths of the files that an include pattern matches, in alphabetical order. The
+// pattern is expanded first (see ExpandPath) and is relative to directory if it isn't absolute. Patterns without any
+// wildcards have to match an existing file, but globs are allowed to match nothing.
+func globInclude(pattern string, directory string) (matches []string, err error) {
+	pattern, err = ExpandPath(pattern)
+	if err != nil {
+		return
+	}
+	if pattern == "" {
+		return nil, errors.New("empty paths are not valid")
+	}
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(directory, pattern)
+	}
+	pattern, err = filepath.Abs(pattern)
+	if err != nil {
+		return nil, errors.New(err.Error())
+	}
+	matches, err = filepath.Glob(pattern)
+	if err != nil {
+		return nil, errors.New(err.Error())
+	}
+	if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+		return nil, errors.New("can't find the file " + pattern)
+	}
+	return
+}
+
+// mergeConfigTree merges the object overlay into the object base, which are found at basePath and overlayPath in their
+// respective files. Objects are merged field by field, lists are appended to and every other value is replaced. The
+// positions of the fields that come from overlay are copied from overlayPositions into positions.
+func mergeConfigTree(base map[string]interface{}, overlay map[string]interface{}, basePath string, overlayPath string, positions map[string]ConfigPosition, overlayPositions map[string]ConfigPosition) {
+	for _, key := range sortedKeys(overlay) {
+		baseKey, exists := lookupKey(base, key)
+		if !exists {
+			baseKey = key
+		}
+		fieldPath, overlayFieldPath := joinConfigPath(basePath, baseKey), joinConfigPath(overlayPath, key)
+		switch value := overlay[key].(type) {
+		case map[string]interface{}:
+			if object, ok := base[baseKey].(map[string]interface{}); ok {
+				mergeConfigTree(object, value, fieldPath, overlayFieldPath, positions, overlayPositions)
+				continue
+			}
+		case []interface{}:
+			if list, ok := base[baseKey].([]interface{}); ok {
+				for i := range value {
+					copyPositions(positions, overlayPositions, indexConfigPath(fieldPath, len(list)+i), indexConfigPath(overlayFieldPath, i))
+				}
+				base[baseKey] = append(list, value...)
+				continue
+			}
+		}
+		base[baseKey] = overlay[key]
+		copyPositions(positions, overlayPositions, fieldPath, overlayFieldPath)
+	}
+}
+
+// copyPositions copies the position of the configuration path from, and of everything inside it, to the matching paths
+// inside to. Any positions that were already inside to are removed first.
+func copyPositions(positions map[string]ConfigPosition, fromPositions map[string]ConfigPosition, to string, from string) {
+	for configPath := range positions {
+		if isInsideConfigPath(configPath, to) {
+			delete(positions, configPath)
+		}
+	}
+	for configPath, position := range fromPositions {
+		if isInsideConfigPath(configPath, from) {
+			positions[to+configPath[len(from):]] = position
+		}
+	}
+}
+
+// isInsideConfigPath reports whether configPath is parent or one of the fields or list items inside it.
+func isInsideConfigPath(configPath string, parent string) bool {
+	return configPath == parent || strings.HasPrefix(configPath, parent+".") || strings.HasPrefix(configPath, parent+"[")
+}
+
+// lookupKey finds the key of an object that a configuration field name maps to, preferring an exact match over a
+// case-insensitive one (just like encoding/json does).
+func lookupKey(object map[string]interface{}, name string) (key string, ok bool) {
+	if _, ok = object[name]; ok {
+		return name, true
+	}
+	for _, key = range sortedKeys(object) {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// ApplyRuleTemplates replaces every rule in a configuration tree that has a Template setting with a copy of the named
+// template from the tree's RuleTemplates, overridden field by field by the rule's own settings. Fields that come from a
+// template keep the template's position, so that problems with them point to the template. Rules that use templates
+// which don't exist are returned as ConfigErrors, and are left as they are.
+func ApplyRuleTemplates(tree interface{}, positions map[string]ConfigPosition) (errs ConfigErrors) {
+	object, _ := tree.(map[string]interface{})
+	templatesKey, _ := lookupKey(object, "RuleTemplates")
+	templates, _ := object[templatesKey].(map[string]interface{})
+	for _, name := range sortedKeys(templates) {
+		if template, ok := templates[name].(map[string]interface{}); ok {
+			if key, nested := lookupKey(template, "Template"); nested {
+				errs = append(errs, ConfigError{Path: joinConfigPath(joinConfigPath(templatesKey, name), key), Message: "templates can't be based on other templates"})
+			}
+		}
+	}
+
+	directoriesKey, _ := lookupKey(object, "Directories")
+	directories, _ := object[directoriesKey].([]interface{})
+	for i, directory := range directories {
+		directoryObject, _ := directory.(map[string]interface{})
+		rulesKey, _ := lookupKey(directoryObject, "Rules")
+		rules, _ := directoryObject[rulesKey].([]interface{})
+		for j, rule := range rules {
+			rulePath := indexConfigPath(joinConfigPath(indexConfigPath(directoriesKey, i), rulesKey), j)
+			ruleObject, _ := rule.(map[string]interface{})
+			templateKey, ok := lookupKey(ruleObject, "Template")
+			name, isString := ruleObject[templateKey].(string)
+			if !ok || !isString {
+				continue
+			}
+			template, ok := templates[name].(map[string]interface{})
+			if !ok {
+				errs = append(errs, ConfigError{Path: rulePath, Message: "uses the unrecognized template \"" + name + "\"" + suggestion(name, sortedKeys(templates))})
+				continue
+			}
+
+			merged := make(map[string]interface{})
+			for key, value := range template {
+				if _, overridden := lookupKey(ruleObject, key); !overridden {
+					merged[key] = value
+					copyPositions(positions, positions, joinConfigPath(rulePath, key), joinConfigPath(joinConfigPath(templatesKey, name), key))
+				}
+			}
+			for key, value := range ruleObject {
+				merged[key] = value
+			}
+			rules[j] = merged
+		}
+	}
+	return
+}
+
+// SubstituteVariables replaces every {var:NAME} in the string values of a configuration tree with the matching value
+// from the tree's Variables. Variables that don't exist are returned as ConfigErrors.
+func SubstituteVariables(tree interface{}) (errs ConfigErrors) {
+	object, ok := tree.(map[string]interface{})
+	if !ok {
+		return
+	}
+	variablesKey, _ := lookupKey(object, "Variables")
+	variables, _ := object[variablesKey].(map[string]interface{})
+	for _, key := range sortedKeys(object) {
+		if key != variablesKey {
+			object[key], errs = substituteVariables(object[key], variables, key, errs)
+		}
+	}
+	return
+}
+
+// substituteVariables replaces the variables in value, which is found at configPath, and adds any problems to errs.
+func substituteVariables(value interface{}, variables map[string]interface{}, configPath string, errs ConfigErrors) (interface{}, ConfigErrors) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			v[key], errs = substituteVariables(v[key], variables, joinConfigPath(configPath, key), errs)
+		}
+	case []interface{}:
+		substituted := make([]interface{}, len(v))
+		for i, item := range v {
+			substituted[i], errs = substituteVariables(item, variables, indexConfigPath(configPath, i), errs)
+		}
+		return substituted, errs
+	case string:
+		var builder strings.Builder
+		for rest := v; rest != ""; {
+			start := strings.Index(rest, "{var:")
+			end := strings.Index(rest[start+1:], "}") + start + 1
+			if start < 0 || end <= start {
+				builder.WriteString(rest)
+				break
+			}
+			name := rest[start+len("{var:") : end]
+			variable, ok := variables[name].(string)
+			if !ok {
+				return value, append(errs, ConfigError{Path: configPath, Message: "unrecognized variable \"" + name + "\"" + suggestion(name, sortedKeys(variables))})
+			}
+			builder.WriteString(rest[:start] + variable)
+			rest = rest[end+1:]
+		}
+		return builder.String(), errs
+	}
+	return value, errs
+}
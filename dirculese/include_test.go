@@ -0,0 +1,109 @@
+package dirculese
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigTree(t *testing.T) {
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+	os.Mkdir(filepath.Join(tempDirectory, "conf.d"), 0755)
+
+	files := map[string]string{
+		"main.yaml":           "Include: [conf.d/*.toml, shared.json]\nVariables:\n  archive: /srv/archive\nDirectories:\n  - Path: /tmp\n",
+		"conf.d/10-home.toml": "[Variables]\narchive = \"/mnt/archive\"\n\n[[Directories]]\nPath = \"/home\"\n",
+		"conf.d/ignored.yaml": "Directories: [{Path: /ignored}]\n",
+		"shared.json":         "{\"Stability\": {\"SettleTime\": 5}}",
+	}
+	for name, contents := range files {
+		if err = ioutil.WriteFile(filepath.Join(tempDirectory, name), []byte(contents), 0644); err != nil {
+			t.Fatal("Couldn't write " + name + ": " + err.Error())
+		}
+	}
+
+	tree, positions, err := LoadConfigTree(filepath.Join(tempDirectory, "main.yaml"), "")
+	if err != nil {
+		t.Fatalf("Couldn't load the configuration. Got '%v'", err)
+	}
+	want := map[string]interface{}{
+		"Include":     []interface{}{"conf.d/*.toml", "shared.json"},
+		"Variables":   map[string]interface{}{"archive": "/mnt/archive"},
+		"Directories": []interface{}{map[string]interface{}{"Path": "/tmp"}, map[string]interface{}{"Path": "/home"}},
+		"Stability":   map[string]interface{}{"SettleTime": json.Number("5")},
+	}
+	if !reflect.DeepEqual(tree, want) {
+		t.Errorf("Mismatch in merged tree. Got '%v', want '%v'", tree, want)
+	}
+	wantPositions := map[string]ConfigPosition{
+		"Directories[0].Path":  {Line: 5, Column: 5},
+		"Directories[1].Path":  {File: filepath.Join(tempDirectory, "conf.d/10-home.toml"), Line: 5, Column: 1},
+		"Stability.SettleTime": {File: filepath.Join(tempDirectory, "shared.json"), Line: 1, Column: 16},
+	}
+	for configPath, position := range wantPositions {
+		if positions[configPath] != position {
+			t.Errorf("Mismatch in the position of %v. Got '%v', want '%v'", configPath, positions[configPath], position)
+		}
+	}
+
+	// files that can't be found or that include themselves are problems with the configuration
+	ioutil.WriteFile(filepath.Join(tempDirectory, "loop.yaml"), []byte("Include: [loop.yaml, missing.json]\n"), 0644)
+	_, _, err = LoadConfigTree(filepath.Join(tempDirectory, "loop.yaml"), "")
+	errs, ok := err.(ConfigErrors)
+	if !ok || len(errs) != 2 || !strings.Contains(errs[0].Message, "includes itself") || errs[1].Path != "Include[1]" {
+		t.Errorf("Mismatch in errors. Got '%v'", err)
+	}
+}
+
+func TestApplyRuleTemplates(t *testing.T) {
+	tree := map[string]interface{}{
+		"RuleTemplates": map[string]interface{}{
+			"images": map[string]interface{}{"Handler": "ExtensionHandler", "Extensions": []interface{}{"png"}, "Delete": true},
+		},
+		"Directories": []interface{}{map[string]interface{}{"Rules": []interface{}{
+			map[string]interface{}{"Template": "images", "delete": false},
+			map[string]interface{}{"Template": "image"},
+		}}},
+	}
+	positions := map[string]ConfigPosition{"RuleTemplates.images.Extensions": {Line: 4, Column: 5}}
+	errs := ApplyRuleTemplates(tree, positions)
+
+	rules := tree["Directories"].([]interface{})[0].(map[string]interface{})["Rules"].([]interface{})
+	want := map[string]interface{}{"Template": "images", "Handler": "ExtensionHandler", "Extensions": []interface{}{"png"}, "delete": false}
+	if !reflect.DeepEqual(rules[0], want) {
+		t.Errorf("Mismatch in rule. Got '%v', want '%v'", rules[0], want)
+	}
+	if positions["Directories[0].Rules[0].Extensions"] != positions["RuleTemplates.images.Extensions"] {
+		t.Errorf("Fields from the template don't point to the template. Got '%v'", positions)
+	}
+	if len(errs) != 1 || errs[0].Path != "Directories[0].Rules[1]" || !strings.Contains(errs[0].Message, "did you mean images?") {
+		t.Errorf("Unrecognized template wasn't reported. Got '%v'", errs)
+	}
+}
+
+func TestSubstituteVariables(t *testing.T) {
+	tree := map[string]interface{}{
+		"Variables": map[string]interface{}{"archive": "/srv/archive", "kind": "pictures"},
+		"Directories": []interface{}{map[string]interface{}{
+			"Path":  "{var:archive}/inbox",
+			"Rules": []interface{}{map[string]interface{}{"Target": "{var:archive}/{var:kind}", "Extensions": []interface{}{"{var:knd}"}}},
+		}},
+	}
+	errs := SubstituteVariables(tree)
+	directory := tree["Directories"].([]interface{})[0].(map[string]interface{})
+	rule := directory["Rules"].([]interface{})[0].(map[string]interface{})
+	if directory["Path"] != "/srv/archive/inbox" || rule["Target"] != "/srv/archive/pictures" {
+		t.Errorf("Mismatch in substituted values. Got '%v'", directory)
+	}
+	if len(errs) != 1 || errs[0].Path != "Directories[0].Rules[0].Extensions[0]" {
+		t.Errorf("Unrecognized variable wasn't reported. Got '%v'", errs)
+	}
+}
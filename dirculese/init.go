@@ -0,0 +1,256 @@
+package dirculese
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RuleSet is a common kind of rule that the init command can suggest. RuleSet.Extensions are the extensions of the
+// files it matches, or RuleSet.Prefixes are the ways those files' names start (which are used as prefix delimiters, so
+// that matching files are moved straight into the target). RuleSet.Target is where matching files go by default (see
+// ExpandPath), relative to the managed directory if it can't be resolved.
+type RuleSet struct {
+	Name       string
+	Extensions []string
+	Prefixes   []string
+	Target     string
+}
+
+// RuleSets is the list of rule sets that the init command suggests, in the order their rules are written. Screenshots
+// come first so that they're moved before the images rule gets to them.
+var RuleSets = []RuleSet{
+	{Name: "screenshots", Prefixes: []string{"Screenshot from ", "Screenshot_", "Screenshot ", "Screen Shot "}, Target: "{xdg:PICTURES}/Screenshots"},
+	{Name: "images", Extensions: []string{"jpg", "jpeg", "png", "gif", "bmp", "webp", "heic", "heif", "tif", "tiff", "svg", "raw", "cr2", "nef"}, Target: "{xdg:PICTURES}"},
+	{Name: "documents", Extensions: []string{"pdf", "doc", "docx", "odt", "rtf", "txt", "md", "xls", "xlsx", "ods", "csv", "ppt", "pptx", "odp", "epub"}, Target: "{xdg:DOCUMENTS}"},
+	{Name: "archives", Extensions: []string{"zip", "tar", "tar.gz", "tgz", "tar.bz2", "tar.xz", "tar.zst", "7z", "rar", "gz", "bz2", "xz"}, Target: "Archives"},
+	{Name: "installers", Extensions: []string{"deb", "rpm", "AppImage", "flatpakref", "snap", "dmg", "pkg", "exe", "msi", "apk"}, Target: "Installers"},
+}
+
+// ScanDirectory counts the files in the directory at path that each of the RuleSets would match, and also returns the
+// extensions (in lower case) that were found for each of them. Hidden files and directories aren't counted.
+func ScanDirectory(path string) (counts map[string]int, found map[string][]string, err error) {
+	directory := Directory{path: path}
+	files, err := directory.Contents(context.Background())
+	if err != nil {
+		return nil, nil, errors.New(err.Error())
+	}
+	counts = make(map[string]int)
+	found = make(map[string][]string)
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		for _, ruleSet := range RuleSets {
+			match, ok := "", false
+			for _, prefix := range ruleSet.Prefixes {
+				if strings.HasPrefix(f.Name(), prefix) {
+					match, ok = prefix, true
+					break
+				}
+			}
+			if len(ruleSet.Extensions) > 0 {
+				match, ok = MatchExtension(f.Name(), ruleSet.Extensions, true)
+				match = strings.ToLower(match)
+			}
+			if !ok {
+				continue
+			}
+			counts[ruleSet.Name]++
+			if !oneOf(match, found[ruleSet.Name]...) {
+				found[ruleSet.Name] = append(found[ruleSet.Name], match)
+			}
+		}
+	}
+	for name := range found {
+		sort.Strings(found[name])
+	}
+	return
+}
+
+// initPrompter asks the questions of the init command, reading answers from a scanner and writing questions to out.
+type initPrompter struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+// ask writes a question, with its default answer if it has one, and returns the answer. Empty answers (and the end of
+// the input) return the default answer.
+func (p *initPrompter) ask(question string, defaultAnswer string) string {
+	if defaultAnswer != "" {
+		question += " [" + defaultAnswer + "]"
+	}
+	fmt.Fprint(p.out, question+" ")
+	if !p.scanner.Scan() {
+		fmt.Fprintln(p.out)
+		return defaultAnswer
+	}
+	if answer := strings.TrimSpace(p.scanner.Text()); answer != "" {
+		return answer
+	}
+	return defaultAnswer
+}
+
+// Init is the init command. It asks which directories dirculese should manage, scans each of them and suggests rules
+// from the RuleSets that match the files that are actually in it, and then writes a commented configuration file to
+// outputPath (in the format that matches its extension, see FormatFromExtension). Once the file has been written, the
+// target directories of the chosen rules are created if they don't exist. Init refuses to overwrite a file that already
+// exists.
+func Init(in io.Reader, out io.Writer, outputPath string) (err error) {
+	if outputPath == "" {
+		var configHome string
+		configHome, err = XDGDirectory("XDG_CONFIG_HOME", ".config")
+		if err != nil {
+			return
+		}
+		outputPath = filepath.Join(configHome, "dirculese", "config.yaml")
+	}
+	if _, statErr := os.Stat(outputPath); statErr == nil {
+		return errors.New("the file '" + outputPath + "' already exists (use the -output flag to write somewhere else)")
+	}
+
+	prompter := initPrompter{scanner: bufio.NewScanner(in), out: out}
+	var directories []interface{}
+	var targets []string
+	comments := map[string][]string{
+		"Directories": {"Written by dirculese init on " + time.Now().Format("2006-01-02") + ".", "Run dirculese validate after changing this file to check it for problems."},
+	}
+	defaultDirectory, _ := ExpandPath("{xdg:DOWNLOAD}")
+	for {
+		directoryPath := prompter.ask("Which directory should dirculese organize? (leave empty when you're done)", defaultDirectory)
+		defaultDirectory = ""
+		if directoryPath == "" {
+			break
+		}
+		directory, directoryComments, directoryTargets, initErr := initDirectory(&prompter, directoryPath, indexConfigPath("Directories", len(directories)))
+		if initErr != nil {
+			fmt.Fprintln(out, "Whoops: "+initErr.Error()+".")
+			continue
+		}
+		directories = append(directories, directory)
+		targets = append(targets, directoryTargets...)
+		for configPath, comment := range directoryComments {
+			comments[configPath] = comment
+		}
+	}
+	if len(directories) == 0 {
+		return errors.New("you need to choose at least one directory")
+	}
+
+	err = os.MkdirAll(filepath.Dir(outputPath), 0755)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	err = WriteConfigFile(outputPath, map[string]interface{}{"Directories": directories}, comments)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(out, "Wrote your configuration file to '"+outputPath+"'.")
+	for _, target := range targets {
+		err = os.MkdirAll(target, 0755)
+		if err != nil {
+			return errors.New(err.Error())
+		}
+	}
+	return
+}
+
+// initDirectory scans a single directory for the init command and asks which of the matching RuleSets should be used
+// for it. It returns the directory's configuration tree, which is found at configPath, the comments for it and the
+// target directories of its rules, which aren't created until the configuration file has been written.
+func initDirectory(prompter *initPrompter, directoryPath string, configPath string) (directory map[string]interface{}, comments map[string][]string, targets []string, err error) {
+	expanded, err := ExpandPath(directoryPath)
+	if err != nil {
+		return
+	}
+	err = (&Directory{path: expanded}).CheckPath()
+	if err != nil {
+		return
+	}
+	counts, found, err := ScanDirectory(expanded)
+	if err != nil {
+		return
+	}
+
+	if len(counts) == 0 {
+		return nil, nil, nil, errors.New("dirculese doesn't have any rules to suggest for the files in " + expanded)
+	}
+
+	var rules []interface{}
+	comments = make(map[string][]string)
+	for _, ruleSet := range RuleSets {
+		if counts[ruleSet.Name] == 0 {
+			continue
+		}
+		target, targetErr := ExpandPath(ruleSet.Target)
+		if targetErr != nil || !filepath.IsAbs(target) {
+			target = filepath.Join(expanded, strings.ToUpper(ruleSet.Name[:1])+ruleSet.Name[1:])
+		}
+		description := strconv.Itoa(counts[ruleSet.Name]) + " " + ruleSet.Name
+		if len(ruleSet.Extensions) > 0 {
+			description += " (" + strings.Join(found[ruleSet.Name], ", ") + ")"
+		}
+		answer := prompter.ask("Found "+description+". Move them to "+target+"? (yes, no or another directory)", "yes")
+		switch strings.ToLower(answer) {
+		case "n", "no":
+			continue
+		case "y", "yes":
+		default:
+			target, err = ExpandPath(answer)
+			if err == nil {
+				target, err = filepath.Abs(target)
+			}
+			if err != nil {
+				return
+			}
+		}
+		targets = append(targets, target)
+
+		rule := map[string]interface{}{"Name": ruleSet.Name, "Target": abbreviateHome(target)}
+		if len(ruleSet.Prefixes) > 0 {
+			// only use the prefixes that were found, since they match anywhere in a file's name (and a file whose name
+			// has one further in is moved into a subdirectory named after the part before it)
+			rule["Handler"] = "PrefixHandler"
+			rule["PrefixDelimiters"] = toInterfaces(found[ruleSet.Name])
+		} else {
+			rule["Handler"] = "ExtensionHandler"
+			rule["Extensions"] = toInterfaces(ruleSet.Extensions)
+			rule["IgnoreCase"] = true
+		}
+		comments[indexConfigPath(joinConfigPath(configPath, "Rules"), len(rules))] = []string{"Move " + ruleSet.Name + " (" + strconv.Itoa(counts[ruleSet.Name]) + " found when this file was written)."}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return nil, nil, nil, errors.New("you didn't choose any rules for " + expanded)
+	}
+	return map[string]interface{}{"Path": abbreviateHome(expanded), "Rules": rules}, comments, targets, nil
+}
+
+// abbreviateHome replaces the user's home directory at the start of path with ~, so that the configuration file can be
+// shared with other machines.
+func abbreviateHome(path string) string {
+	home, err := GetUserHome()
+	if err != nil || home == "" || home == string(os.PathSeparator) {
+		return path
+	}
+	if path == home || strings.HasPrefix(path, home+string(os.PathSeparator)) {
+		return "~" + path[len(home):]
+	}
+	return path
+}
+
+// toInterfaces converts a list of strings into a list that can be used in a configuration tree.
+func toInterfaces(values []string) (list []interface{}) {
+	for _, value := range values {
+		list = append(list, value)
+	}
+	return
+}
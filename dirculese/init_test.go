@@ -0,0 +1,97 @@
+package dirculese
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanDirectory(t *testing.T) {
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+	for _, name := range []string{"a.png", "b.JPG", "Screenshot from 2020-01-01.png", "c.tar.gz", ".hidden.pdf", "notes"} {
+		ioutil.WriteFile(filepath.Join(tempDirectory, name), []byte{}, 0644)
+	}
+	os.Mkdir(filepath.Join(tempDirectory, "folder.zip"), 0755)
+
+	counts, found, err := ScanDirectory(tempDirectory)
+	if err != nil {
+		t.Fatalf("Couldn't scan the directory. Got '%v'", err)
+	}
+	wantCounts := map[string]int{"screenshots": 1, "images": 3, "archives": 1}
+	if !reflect.DeepEqual(counts, wantCounts) {
+		t.Errorf("Mismatch in counts. Got '%v', want '%v'", counts, wantCounts)
+	}
+	if strings.Join(found["images"], ",") != "jpg,png" || strings.Join(found["archives"], ",") != "tar.gz" {
+		t.Errorf("Mismatch in found extensions. Got '%v'", found)
+	}
+}
+
+func TestInit(t *testing.T) {
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+	source := filepath.Join(tempDirectory, "Downloads")
+	os.Mkdir(source, 0755)
+	for _, name := range []string{"a.png", "b.pdf", "c.deb", "Screenshot_1.png"} {
+		ioutil.WriteFile(filepath.Join(source, name), []byte{}, 0644)
+	}
+
+	// keep the suggested targets inside the temporary directory
+	for variable, directory := range map[string]string{"XDG_PICTURES_DIR": "Pictures", "XDG_DOCUMENTS_DIR": "Documents"} {
+		defer os.Setenv(variable, os.Getenv(variable))
+		os.Setenv(variable, filepath.Join(tempDirectory, directory))
+	}
+
+	// nothing is created if the configuration file can't be written
+	answers := source + "\n\n\nno\n" + filepath.Join(tempDirectory, "Installers") + "\n\n"
+	ioutil.WriteFile(filepath.Join(tempDirectory, "config"), []byte{}, 0644)
+	var output bytes.Buffer
+	if err = Init(strings.NewReader(answers), &output, filepath.Join(tempDirectory, "config", "dirculese.yaml")); err == nil {
+		t.Fatal("Init didn't return an error for a configuration file it couldn't write")
+	}
+	if _, statErr := os.Stat(filepath.Join(tempDirectory, "Installers")); !os.IsNotExist(statErr) {
+		t.Errorf("Init created a target directory without writing the configuration file. Got '%v'", statErr)
+	}
+	os.Remove(filepath.Join(tempDirectory, "config"))
+
+	// accept the screenshots and images, skip the documents and put the installers somewhere else
+	outputPath := filepath.Join(tempDirectory, "config", "dirculese.yaml")
+	err = Init(strings.NewReader(answers), &output, outputPath)
+	if err != nil {
+		t.Fatalf("Init returned an error. Got '%v' (output '%v')", err, output.String())
+	}
+
+	conf, err := GetConfigStruct(outputPath, "")
+	if err != nil {
+		t.Fatalf("Init wrote an invalid configuration file. Got '%v'", err)
+	}
+	rules := conf.Directories[0].Rules
+	if len(rules) != 3 || rules[1].Name != "images" || rules[1].Target != filepath.Join(tempDirectory, "Pictures") || rules[2].Target != filepath.Join(tempDirectory, "Installers") {
+		t.Errorf("Mismatch in rules. Got '%v'", rules)
+	}
+	// only the screenshot prefixes that were found are used
+	if rules[0].Handler != "PrefixHandler" || strings.Join(rules[0].PrefixDelimiters, ",") != "Screenshot_" {
+		t.Errorf("Mismatch in the screenshots rule. Got '%v'", rules[0])
+	}
+	if _, statErr := os.Stat(filepath.Join(tempDirectory, "Installers")); statErr != nil {
+		t.Errorf("Init didn't create the target directory. Got '%v'", statErr)
+	}
+	contents, _ := ioutil.ReadFile(outputPath)
+	if !strings.Contains(string(contents), "# Move images (2 found when this file was written).") {
+		t.Errorf("Configuration file doesn't have comments. Got '%v'", string(contents))
+	}
+
+	if err = Init(strings.NewReader(source+"\n\n"), &output, outputPath); err == nil {
+		t.Error("Init overwrote an existing file")
+	}
+}
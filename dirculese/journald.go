@@ -0,0 +1,108 @@
+package dirculese
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// JournaldSocketPath is the Unix socket that systemd's journal listens on for its native protocol.
+const JournaldSocketPath = "/run/systemd/journal/socket"
+
+// JournaldLogger is an EntryLogger that sends the entries of the given level and above to systemd's journal with its
+// native protocol, so that their fields can be searched with journalctl (e.g. journalctl
+// DIRCULESE_RULE=Downloads/images). The message is sent as MESSAGE, the level as PRIORITY, and the fields of the entry
+// as DIRCULESE_RUN_ID, DIRCULESE_DIRECTORY, DIRCULESE_RULE, DIRCULESE_ACTION, DIRCULESE_SOURCE, DIRCULESE_DESTINATION
+// and DIRCULESE_ERROR. Each entry is sent in a single datagram, so entries that are too large for the socket are
+// dropped. It's safe to use from several goroutines at once.
+type JournaldLogger struct {
+	mutex      sync.Mutex
+	address    string
+	conn       net.Conn
+	identifier string
+	level      Level
+}
+
+// NewJournaldLogger connects to the journal listening on the Unix socket at address (or JournaldSocketPath, if address
+// is empty) and returns a JournaldLogger whose entries have identifier as their SYSLOG_IDENTIFIER.
+func NewJournaldLogger(address string, identifier string, level Level) (logger *JournaldLogger, err error) {
+	if address == "" {
+		address = JournaldSocketPath
+	}
+	logger = &JournaldLogger{address: address, identifier: identifier, level: level}
+	if err = logger.connect(); err != nil {
+		return nil, errors.New("couldn't connect to journald: " + err.Error())
+	}
+	return
+}
+
+// connect (re)connects to the journal.
+func (l *JournaldLogger) connect() (err error) {
+	if l.conn != nil {
+		l.conn.Close()
+		l.conn = nil
+	}
+	l.conn, err = net.Dial("unixgram", l.address)
+	return
+}
+
+// Log sends an entry to the journal if its level is at least the logger's, reconnecting once if the connection was lost
+// (e.g. because the journal was restarted). Entries that can't be sent are dropped.
+func (l *JournaldLogger) Log(entry LogEntry) {
+	if entry.Level < l.level {
+		return
+	}
+	var datagram bytes.Buffer
+	field := func(name string, value string) {
+		if value == "" {
+			return
+		}
+		// values with newlines are sent as their length followed by the raw value, the others as NAME=value
+		if !strings.Contains(value, "\n") {
+			datagram.WriteString(name + "=" + value + "\n")
+			return
+		}
+		datagram.WriteString(name + "\n")
+		binary.Write(&datagram, binary.LittleEndian, uint64(len(value)))
+		datagram.WriteString(value + "\n")
+	}
+	field("MESSAGE", entry.Message)
+	field("PRIORITY", strconv.Itoa(syslogSeverity(entry.Level)))
+	field("SYSLOG_IDENTIFIER", l.identifier)
+	field("DIRCULESE_RUN_ID", entry.RunID)
+	field("DIRCULESE_DIRECTORY", entry.Directory)
+	field("DIRCULESE_RULE", entry.Rule)
+	field("DIRCULESE_ACTION", entry.Action)
+	field("DIRCULESE_SOURCE", entry.Source)
+	field("DIRCULESE_DESTINATION", entry.Destination)
+	if entry.Err != nil {
+		field("DIRCULESE_ERROR", entry.Err.Error())
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.conn != nil {
+		if _, err := l.conn.Write(datagram.Bytes()); err == nil {
+			return
+		}
+	}
+	if l.connect() == nil {
+		l.conn.Write(datagram.Bytes())
+	}
+}
+
+// Close closes the connection to the journal.
+func (l *JournaldLogger) Close() (err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.conn == nil {
+		return
+	}
+	err = l.conn.Close()
+	l.conn = nil
+	return
+}
@@ -0,0 +1,29 @@
+package dirculese
+
+import (
+	"testing"
+)
+
+func TestJournaldLogger(t *testing.T) {
+	conn, path, cleanup := listenUnixgram(t, "socket")
+	defer cleanup()
+
+	logger, err := NewJournaldLogger(path, "dirculese", LevelInfo)
+	if err != nil {
+		t.Fatalf("NewJournaldLogger returned an error. Got '%v'", err)
+	}
+	defer logger.Close()
+
+	logger.Log(LogEntry{Level: LevelDebug, Message: "Skipped the rule because it isn't enabled."})
+	logger.Log(LogEntry{Level: LevelInfo, Message: "Ran the command.\nOutput: done", RunID: "1f", Rule: "downloads/images", Action: ActionCommand})
+	got := readDatagram(t, conn)
+	want := "MESSAGE\n\x1d\x00\x00\x00\x00\x00\x00\x00Ran the command.\nOutput: done\n" +
+		"PRIORITY=6\n" +
+		"SYSLOG_IDENTIFIER=dirculese\n" +
+		"DIRCULESE_RUN_ID=1f\n" +
+		"DIRCULESE_RULE=downloads/images\n" +
+		"DIRCULESE_ACTION=command\n"
+	if got != want {
+		t.Errorf("Mismatch in the journal entry. Got '%q', want '%q'", got, want)
+	}
+}
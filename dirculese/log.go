@@ -0,0 +1,408 @@
+package dirculese
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is how important a log message is. Messages below a LogWriter's level are discarded.
+type Level int
+
+// LevelDebug, LevelInfo, LevelWarn and LevelError are the levels of log messages, from the least to the most important.
+// Debug messages are about things that were left alone on purpose (like disabled rules), info messages are about what
+// was done, warnings are about problems that didn't stop anything (like a failed hook), and errors stopped a rule.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// LogFormatText and LogFormatJSON are the formats that a LogWriter can write. LogFormatText writes the time, level and
+// message followed by the fields as key=value pairs, and LogFormatJSON writes a JSON object per line.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// LogDestinationFile, LogDestinationStderr, LogDestinationSyslog and LogDestinationJournald are the places that the log
+// can be written to (see OpenLogDestinations): a file that is rotated (see RotatingFile), standard error, the local
+// syslog daemon (see SyslogLogger) and systemd's journal (see JournaldLogger).
+const (
+	LogDestinationFile     = "File"
+	LogDestinationStderr   = "Stderr"
+	LogDestinationSyslog   = "Syslog"
+	LogDestinationJournald = "Journald"
+)
+
+// DefaultLogMaxSize is the size in megabytes that log files are rotated at, and DefaultLogMaxBackups is how many of
+// the rotated files are kept, unless a LogDestinationConfig says otherwise.
+const (
+	DefaultLogMaxSize    = 10
+	DefaultLogMaxBackups = 5
+)
+
+// ActionMove, ActionDelete, ActionCommand, ActionSkip, ActionFail, ActionStop and ActionWebhook are the actions that
+// log entries describe: a file was moved, deleted or handed to a command, something was skipped, a rule failed, a run
+// stopped early, or a webhook was sent.
+const (
+	ActionMove    = "move"
+	ActionDelete  = "delete"
+	ActionCommand = "command"
+	ActionSkip    = "skip"
+	ActionFail    = "fail"
+	ActionStop    = "stop"
+	ActionWebhook = "webhook"
+)
+
+// String returns the name of a level (debug, info, warn or error).
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return "level(" + strconv.Itoa(int(l)) + ")"
+}
+
+// ParseLevel returns the level with the given name (debug, info, warn or warning, or error, in any case).
+func ParseLevel(name string) (level Level, err error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, errors.New("unrecognized log level \"" + name + "\" (use debug, info, warn or error)")
+}
+
+// LogEntry is a log message along with the fields that say what it's about: the run it happened in (see
+// RunStarted.RunID), the labels of the directory and rule, the action, the paths of the file before and after it and
+// the error, if any. Fields that don't apply are left empty.
+type LogEntry struct {
+	Time        time.Time
+	Level       Level
+	Message     string
+	RunID       string
+	Directory   string
+	Rule        string
+	Action      string
+	Source      string
+	Destination string
+	Err         error
+}
+
+// text returns the entry as the prose message that plain Loggers get, prefixed with the label of its rule (or of its
+// directory, if it isn't about a rule) like "[Downloads/images] Moved the file ...".
+func (e LogEntry) text() (text string) {
+	text = e.Message
+	if e.Err != nil {
+		text = strings.TrimSuffix(text, ".") + ": " + e.Err.Error()
+	}
+	if e.Rule != "" {
+		return "[" + e.Rule + "] " + text
+	}
+	if e.Directory != "" {
+		return "[" + e.Directory + "] " + text
+	}
+	return
+}
+
+// EntryLogger is implemented by loggers that take log entries along with their levels and fields. The engine gives
+// entries to the loggers that implement it, and only gives the text of the entries to the other ones.
+type EntryLogger interface {
+	Log(entry LogEntry)
+}
+
+// LogWriter is a Logger and an EntryLogger that writes the entries of the given level and above to an io.Writer, one
+// per line, in LogFormatText or LogFormatJSON. It's safe to use from several goroutines at once.
+type LogWriter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	closer io.Closer
+	format string
+	level  Level
+}
+
+// NewLogWriter creates a LogWriter that writes the entries of level and above to writer in the given format, which is
+// LogFormatText if it's empty (the format's case doesn't matter).
+func NewLogWriter(writer io.Writer, format string, level Level) (logWriter *LogWriter, err error) {
+	format = strings.ToLower(format)
+	switch format {
+	case "":
+		format = LogFormatText
+	case LogFormatText, LogFormatJSON:
+	default:
+		return nil, errors.New("unrecognized log format \"" + format + "\" (use " + LogFormatText + " or " + LogFormatJSON + ")")
+	}
+	return &LogWriter{writer: writer, format: format, level: level}, nil
+}
+
+// Println logs its arguments, which are formatted like fmt.Sprint does, as an info message.
+func (w *LogWriter) Println(v ...interface{}) {
+	w.Log(LogEntry{Level: LevelInfo, Message: fmt.Sprint(v...)})
+}
+
+// Fatalln logs its arguments as an error message, like LogWriter.Println does, and exits with status 1.
+func (w *LogWriter) Fatalln(v ...interface{}) {
+	w.Log(LogEntry{Level: LevelError, Message: fmt.Sprint(v...)})
+	os.Exit(1)
+}
+
+// Log writes an entry if its level is at least the writer's. Entries without a time are given the current time.
+func (w *LogWriter) Log(entry LogEntry) {
+	if entry.Level < w.level {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	var line []byte
+	if w.format == LogFormatJSON {
+		line = jsonLogLine(entry)
+	} else {
+		line = textLogLine(entry)
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.writer.Write(line)
+}
+
+// Close closes the file that the writer writes to, if it was opened by OpenLogDestinations.
+func (w *LogWriter) Close() (err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closer != nil {
+		err = w.closer.Close()
+	}
+	return
+}
+
+// logTimeFormat is how LogWriter writes the time of an entry.
+const logTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// jsonLogLine formats an entry as a JSON object followed by a newline. Fields that are empty are left out.
+func jsonLogLine(entry LogEntry) []byte {
+	object := struct {
+		Time        string `json:"time"`
+		Level       string `json:"level"`
+		Message     string `json:"msg"`
+		RunID       string `json:"run_id,omitempty"`
+		Directory   string `json:"directory,omitempty"`
+		Rule        string `json:"rule,omitempty"`
+		Action      string `json:"action,omitempty"`
+		Source      string `json:"source,omitempty"`
+		Destination string `json:"destination,omitempty"`
+		Error       string `json:"error,omitempty"`
+	}{
+		Time:        entry.Time.Format(logTimeFormat),
+		Level:       entry.Level.String(),
+		Message:     entry.Message,
+		RunID:       entry.RunID,
+		Directory:   entry.Directory,
+		Rule:        entry.Rule,
+		Action:      entry.Action,
+		Source:      entry.Source,
+		Destination: entry.Destination,
+	}
+	if entry.Err != nil {
+		object.Error = entry.Err.Error()
+	}
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(object)
+	return buffer.Bytes()
+}
+
+// textLogLine formats an entry as its time, level and message followed by its fields (see textLogMessage) and a
+// newline.
+func textLogLine(entry LogEntry) []byte {
+	return []byte(entry.Time.Format(logTimeFormat) + " " + strings.ToUpper(entry.Level.String()) + " " + textLogMessage(entry) + "\n")
+}
+
+// textLogMessage formats an entry as its message followed by its fields as key=value pairs. Values that contain spaces,
+// quotes or equals signs are quoted, and fields that are empty are left out.
+func textLogMessage(entry LogEntry) string {
+	var buffer bytes.Buffer
+	buffer.WriteString(entry.Message)
+	field := func(key string, value string) {
+		if value == "" {
+			return
+		}
+		if strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		buffer.WriteString(" " + key + "=" + value)
+	}
+	field("run", entry.RunID)
+	field("directory", entry.Directory)
+	field("rule", entry.Rule)
+	field("action", entry.Action)
+	field("source", entry.Source)
+	field("destination", entry.Destination)
+	if entry.Err != nil {
+		field("error", entry.Err.Error())
+	}
+	return buffer.String()
+}
+
+// LogDestinationType returns the destination type (e.g. LogDestinationSyslog) called name, in any case.
+func LogDestinationType(name string) (destinationType string, ok bool) {
+	for _, destinationType = range []string{LogDestinationFile, LogDestinationStderr, LogDestinationSyslog, LogDestinationJournald} {
+		if strings.EqualFold(name, destinationType) {
+			return destinationType, true
+		}
+	}
+	return "", false
+}
+
+// MultiLogger is a Logger and an EntryLogger that gives every entry to several EntryLoggers. It's created by
+// OpenLogDestinations, which makes it responsible for closing its destinations, or by NewMultiLogger. A MultiLogger
+// without any loggers discards everything.
+type MultiLogger struct {
+	loggers []EntryLogger
+	closers []io.Closer
+}
+
+// NewMultiLogger creates a MultiLogger that gives every entry to loggers.
+func NewMultiLogger(loggers ...EntryLogger) *MultiLogger {
+	return &MultiLogger{loggers: loggers}
+}
+
+// With returns a MultiLogger that gives every entry to m's loggers and to loggers as well. Closing it doesn't close m's
+// destinations.
+func (m *MultiLogger) With(loggers ...EntryLogger) *MultiLogger {
+	return NewMultiLogger(append(append([]EntryLogger{}, m.loggers...), loggers...)...)
+}
+
+// Log gives an entry to every logger.
+func (m *MultiLogger) Log(entry LogEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	for _, logger := range m.loggers {
+		logger.Log(entry)
+	}
+}
+
+// Println logs its arguments, which are formatted like fmt.Sprint does, as an info message.
+func (m *MultiLogger) Println(v ...interface{}) {
+	m.Log(LogEntry{Level: LevelInfo, Message: fmt.Sprint(v...)})
+}
+
+// Fatalln logs its arguments as an error message, like MultiLogger.Println does, closes the destinations and exits with
+// status 1.
+func (m *MultiLogger) Fatalln(v ...interface{}) {
+	m.Log(LogEntry{Level: LevelError, Message: fmt.Sprint(v...)})
+	m.Close()
+	os.Exit(1)
+}
+
+// Close closes the destinations that were opened by OpenLogDestinations, returning the first error.
+func (m *MultiLogger) Close() (err error) {
+	for _, closer := range m.closers {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	m.closers = nil
+	return
+}
+
+// OpenLogDestinations opens every destination of a LoggingConfig (or the log file, see GetLogFilePath, if it doesn't
+// have any) and returns a MultiLogger that writes the entries of the configured level and above to all of them. Files
+// and standard error are written to in the configured format, while syslog and the journal get the entries' fields in
+// their own way. The destinations are closed again if any of them can't be opened.
+func OpenLogDestinations(config LoggingConfig) (logger *MultiLogger, err error) {
+	level := LevelInfo
+	if config.Level != "" {
+		if level, err = ParseLevel(config.Level); err != nil {
+			return
+		}
+	}
+	destinations := config.Destinations
+	if len(destinations) == 0 {
+		destinations = []LogDestinationConfig{{Type: LogDestinationFile}}
+	}
+
+	logger = NewMultiLogger()
+	for _, destinationConf := range destinations {
+		var entryLogger EntryLogger
+		entryLogger, err = openLogDestination(destinationConf, config.Format, level)
+		if err != nil {
+			logger.Close()
+			return nil, err
+		}
+		logger.loggers = append(logger.loggers, entryLogger)
+		if closer, ok := entryLogger.(io.Closer); ok {
+			logger.closers = append(logger.closers, closer)
+		}
+	}
+	return
+}
+
+// openLogDestination opens a single log destination, which writes the entries of level and above in the given format
+// (if it's a file or standard error).
+func openLogDestination(destinationConf LogDestinationConfig, format string, level Level) (logger EntryLogger, err error) {
+	destinationType, ok := LogDestinationType(destinationConf.Type)
+	if !ok {
+		return nil, errors.New("unrecognized log destination \"" + destinationConf.Type + "\"")
+	}
+	switch destinationType {
+	case LogDestinationStderr:
+		return NewLogWriter(os.Stderr, format, level)
+	case LogDestinationSyslog:
+		return NewSyslogLogger(destinationConf.Path, "dirculese", level)
+	case LogDestinationJournald:
+		return NewJournaldLogger(destinationConf.Path, "dirculese", level)
+	}
+
+	path := destinationConf.Path
+	if path == "" {
+		if path, err = GetLogFilePath(); err != nil {
+			return
+		}
+	}
+	rotation := Rotation{
+		MaxSize:      int64(DefaultLogMaxSize) << 20,
+		Interval:     time.Duration(destinationConf.Interval) * time.Hour,
+		MaxBackups:   DefaultLogMaxBackups,
+		MaxBackupAge: time.Duration(destinationConf.MaxBackupAge) * 24 * time.Hour,
+		Compress:     destinationConf.Compress,
+	}
+	if destinationConf.MaxSize > 0 {
+		rotation.MaxSize = int64(destinationConf.MaxSize) << 20
+	}
+	if destinationConf.MaxBackups != 0 {
+		rotation.MaxBackups = destinationConf.MaxBackups
+	}
+	file, err := OpenRotatingFile(path, rotation)
+	if err != nil {
+		return nil, errors.New("failed to open log file '" + path + "': " + err.Error())
+	}
+	logWriter, err := NewLogWriter(file, format, level)
+	if err != nil {
+		file.Close()
+		return
+	}
+	logWriter.closer = file
+	return logWriter, nil
+}
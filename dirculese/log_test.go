@@ -0,0 +1,190 @@
+package dirculese
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// entryRecorder is an EntryLogger that keeps the entries it's given.
+type entryRecorder struct {
+	entries []LogEntry
+}
+
+func (r *entryRecorder) Println(v ...interface{}) {}
+
+func (r *entryRecorder) Log(entry LogEntry) {
+	r.entries = append(r.entries, entry)
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]Level{"debug": LevelDebug, "INFO": LevelInfo, "warn": LevelWarn, "Warning": LevelWarn, "error": LevelError}
+	for name, want := range tests {
+		if got, err := ParseLevel(name); got != want || err != nil {
+			t.Errorf("Mismatch in the level called %v. Got '%v' (%v), want '%v'", name, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("ParseLevel accepted an unrecognized level")
+	}
+}
+
+func TestLogWriter(t *testing.T) {
+	if _, err := NewLogWriter(ioutil.Discard, "xml", LevelInfo); err == nil {
+		t.Error("NewLogWriter accepted an unrecognized format")
+	}
+
+	moment := time.Date(2020, 5, 17, 9, 30, 0, 0, time.UTC)
+	entries := []LogEntry{
+		{Time: moment, Level: LevelDebug, Message: "Skipped the rule because it isn't enabled."},
+		{Time: moment, Level: LevelInfo, Message: "Moved the file a b.png.", RunID: "1f", Directory: "downloads", Rule: "downloads/images", Action: ActionMove, Source: "/downloads/a b.png", Destination: "/images/a b.png"},
+		{Time: moment, Level: LevelError, Message: "Stopped the rule because of an error.", Rule: "downloads/images", Action: ActionFail, Err: errors.New("permission denied")},
+	}
+
+	var text bytes.Buffer
+	writer, err := NewLogWriter(&text, "", LevelInfo)
+	if err != nil {
+		t.Fatalf("NewLogWriter returned an error. Got '%v'", err)
+	}
+	for _, entry := range entries {
+		writer.Log(entry)
+	}
+	want := `2020-05-17T09:30:00.000Z INFO Moved the file a b.png. run=1f directory=downloads rule=downloads/images action=move source="/downloads/a b.png" destination="/images/a b.png"
+2020-05-17T09:30:00.000Z ERROR Stopped the rule because of an error. rule=downloads/images action=fail error="permission denied"
+`
+	if text.String() != want {
+		t.Errorf("Mismatch in the text log. Got '%v', want '%v'", text.String(), want)
+	}
+
+	var lines bytes.Buffer
+	writer, err = NewLogWriter(&lines, LogFormatJSON, LevelDebug)
+	if err != nil {
+		t.Fatalf("NewLogWriter returned an error. Got '%v'", err)
+	}
+	for _, entry := range entries {
+		writer.Log(entry)
+	}
+	var got []map[string]string
+	for _, line := range strings.Split(strings.TrimSpace(lines.String()), "\n") {
+		var object map[string]string
+		if err = json.Unmarshal([]byte(line), &object); err != nil {
+			t.Fatalf("The JSON log has a line that isn't a JSON object. Got '%v'", line)
+		}
+		got = append(got, object)
+	}
+	if len(got) != 3 {
+		t.Fatalf("Mismatch in the number of JSON log lines. Got '%v', want '3'", len(got))
+	}
+	if got[0]["level"] != "debug" || got[0]["rule"] != "" {
+		t.Errorf("Mismatch in the first JSON log line. Got '%v'", got[0])
+	}
+	if got[1]["run_id"] != "1f" || got[1]["action"] != "move" || got[1]["destination"] != "/images/a b.png" || got[1]["time"] != "2020-05-17T09:30:00.000Z" {
+		t.Errorf("Mismatch in the second JSON log line. Got '%v'", got[1])
+	}
+	if got[2]["level"] != "error" || got[2]["error"] != "permission denied" {
+		t.Errorf("Mismatch in the third JSON log line. Got '%v'", got[2])
+	}
+}
+
+func TestEngine_LogEntries(t *testing.T) {
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+	target := filepath.Join(tempDirectory, "images")
+	os.Mkdir(target, 0755)
+	ioutil.WriteFile(filepath.Join(tempDirectory, "a.png"), []byte{}, 0644)
+
+	config := DirectoriesConfig{Directories: []DirectoryConfig{{
+		Path: tempDirectory,
+		Name: "downloads",
+		Rules: []RuleConfig{
+			{Name: "images", Handler: "ExtensionHandler", Extensions: []string{"png"}, Target: target},
+			{Name: "off", Handler: "ExtensionHandler", Extensions: []string{"txt"}, Delete: true, Enabled: new(bool)},
+		},
+	}}}
+	logger := &entryRecorder{}
+	engine, err := New(config, Options{Logger: logger})
+	if err != nil {
+		t.Fatalf("New returned an error. Got '%v'", err)
+	}
+	var runID string
+	engine.Subscribe(func(event Event) {
+		if started, ok := event.(RunStarted); ok {
+			runID = started.RunID
+		}
+	})
+	if err = engine.Run(context.Background()); err != nil {
+		t.Fatalf("Run returned an error. Got '%v'", err)
+	}
+
+	want := []LogEntry{
+		{Level: LevelInfo, RunID: runID, Directory: "downloads", Rule: "downloads/images", Action: ActionMove, Source: filepath.Join(tempDirectory, "a.png"), Destination: filepath.Join(target, "a.png")},
+		{Level: LevelDebug, RunID: runID, Directory: "downloads", Rule: "downloads/off", Action: ActionSkip},
+	}
+	if runID == "" || len(logger.entries) != len(want) {
+		t.Fatalf("Mismatch in the log entries of run '%v'. Got '%v', want '%v'", runID, logger.entries, want)
+	}
+	for i, entry := range logger.entries {
+		if entry.Time.IsZero() || entry.Message == "" {
+			t.Errorf("The log entry %v doesn't have a time or a message. Got '%v'", i, entry)
+		}
+		entry.Time, entry.Message = time.Time{}, ""
+		if entry != want[i] {
+			t.Errorf("Mismatch in log entry %v. Got '%v', want '%v'", i, entry, want[i])
+		}
+	}
+}
+
+func TestOpenLogDestinations(t *testing.T) {
+	conn, socketPath, cleanup := listenUnixgram(t, "log")
+	defer cleanup()
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+	logPath := filepath.Join(tempDirectory, "logs", "dirculese.log")
+
+	if _, err = OpenLogDestinations(LoggingConfig{Destinations: []LogDestinationConfig{{Type: "Email"}}}); err == nil {
+		t.Error("OpenLogDestinations accepted an unrecognized destination")
+	}
+
+	logger, err := OpenLogDestinations(LoggingConfig{
+		Level:  "warn",
+		Format: "JSON",
+		Destinations: []LogDestinationConfig{
+			{Type: "file", Path: logPath, MaxSize: 1, Compress: true},
+			{Type: LogDestinationSyslog, Path: socketPath},
+		},
+	})
+	if err != nil {
+		t.Fatalf("OpenLogDestinations returned an error. Got '%v'", err)
+	}
+	var extra entryRecorder
+	logger.With(&extra).Log(LogEntry{Level: LevelInfo, Message: "Moved the file a.png."})
+	logger.Log(LogEntry{Level: LevelError, Message: "Stopped the rule because of an error.", Rule: "downloads/images"})
+	if err = logger.Close(); err != nil {
+		t.Errorf("Close returned an error. Got '%v'", err)
+	}
+
+	if len(extra.entries) != 1 {
+		t.Errorf("The extra logger didn't get the entry. Got '%v'", extra.entries)
+	}
+	content, err := ioutil.ReadFile(logPath)
+	var object map[string]string
+	if err != nil || json.Unmarshal(content, &object) != nil || object["rule"] != "downloads/images" {
+		t.Errorf("Mismatch in the log file. Got '%v' (%v)", string(content), err)
+	}
+	if got := readDatagram(t, conn); !strings.HasPrefix(got, "<11>") || !strings.HasSuffix(got, "Stopped the rule because of an error. rule=downloads/images") {
+		t.Errorf("Mismatch in the syslog message. Got '%v'", got)
+	}
+}
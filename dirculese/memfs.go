@@ -0,0 +1,307 @@
+package dirculese
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSymlinkHops is how many symlinks MemFS follows while resolving a path before giving up.
+const maxSymlinkHops = 40
+
+// MemFS is an FS that keeps every file in memory, for tests and for simulating what a configuration would do. It only
+// stores the metadata of files (and the targets of symlinks), not their contents. Paths are cleaned with
+// filepath.Clean, and a new MemFS only contains its root directory. It's safe to use from several goroutines at once.
+type MemFS struct {
+	mutex sync.Mutex
+	files map[string]*memFile
+}
+
+// memFile is a file, directory or symlink in a MemFS. memFile.target is where a symlink points to.
+type memFile struct {
+	mode    os.FileMode
+	size    int64
+	modTime time.Time
+	target  string
+}
+
+// memFileInfo is the os.FileInfo of a memFile.
+type memFileInfo struct {
+	name string
+	file memFile
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.file.size }
+func (i memFileInfo) Mode() os.FileMode  { return i.file.mode }
+func (i memFileInfo) ModTime() time.Time { return i.file.modTime }
+func (i memFileInfo) IsDir() bool        { return i.file.mode.IsDir() }
+func (i memFileInfo) Sys() interface{}   { return nil }
+
+// NewMemFS creates an empty MemFS.
+func NewMemFS() *MemFS {
+	root := string(os.PathSeparator)
+	return &MemFS{files: map[string]*memFile{root: {mode: os.ModeDir | 0755, modTime: time.Now()}}}
+}
+
+// WriteFile creates a regular file of size bytes called name, or replaces the one that's already there. Its directory
+// has to exist.
+func (m *MemFS) WriteFile(name string, size int64, perm os.FileMode) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	resolved, err := m.resolve(name, true)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	if existing, ok := m.files[resolved]; ok && existing.mode.IsDir() {
+		return &os.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	}
+	if err = m.checkParent(resolved); err != nil {
+		return &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	m.files[resolved] = &memFile{mode: perm & os.ModePerm, size: size, modTime: time.Now()}
+	return
+}
+
+// Chtimes changes the modification time of the file called name.
+func (m *MemFS) Chtimes(name string, modTime time.Time) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	_, file, err := m.lookup(name, true)
+	if err != nil {
+		return &os.PathError{Op: "chtimes", Path: name, Err: err}
+	}
+	file.modTime = modTime
+	return
+}
+
+// Stat returns the file info of the file called name, following symlinks.
+func (m *MemFS) Stat(name string) (os.FileInfo, error) {
+	return m.stat("stat", name, true)
+}
+
+// Lstat returns the file info of the file called name, without following it if it's a symlink.
+func (m *MemFS) Lstat(name string) (os.FileInfo, error) {
+	return m.stat("lstat", name, false)
+}
+
+// stat returns the file info of the file called name, following it if it's a symlink and follow is true.
+func (m *MemFS) stat(op string, name string, follow bool) (os.FileInfo, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	resolved, file, err := m.lookup(name, follow)
+	if err != nil {
+		return nil, &os.PathError{Op: op, Path: name, Err: err}
+	}
+	return memFileInfo{name: filepath.Base(resolved), file: *file}, nil
+}
+
+// ReadDir returns the file info of every entry in the directory called name.
+func (m *MemFS) ReadDir(name string) (files []os.FileInfo, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	resolved, file, err := m.lookup(name, true)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	if !file.mode.IsDir() {
+		return nil, &os.PathError{Op: "readdirent", Path: name, Err: errors.New("not a directory")}
+	}
+	files = []os.FileInfo{}
+	for path, child := range m.files {
+		if path != resolved && filepath.Dir(path) == resolved {
+			files = append(files, memFileInfo{name: filepath.Base(path), file: *child})
+		}
+	}
+	return
+}
+
+// Readlink returns the target of the symlink called name.
+func (m *MemFS) Readlink(name string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	_, file, err := m.lookup(name, false)
+	if err == nil && file.mode&os.ModeSymlink == 0 {
+		err = errors.New("invalid argument")
+	}
+	if err != nil {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return file.target, nil
+}
+
+// EvalSymlinks returns the path that path refers to once every symlink in it has been followed. The file has to
+// exist.
+func (m *MemFS) EvalSymlinks(path string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	resolved, _, err := m.lookup(path, true)
+	if err != nil {
+		return "", &os.PathError{Op: "lstat", Path: path, Err: err}
+	}
+	return resolved, nil
+}
+
+// MkdirAll creates the directory called path along with any of its parents that don't exist yet.
+func (m *MemFS) MkdirAll(path string, perm os.FileMode) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	resolved, err := m.resolve(path, true)
+	if err != nil {
+		return &os.PathError{Op: "mkdir", Path: path, Err: err}
+	}
+	var missing []string
+	for directory := resolved; ; directory = filepath.Dir(directory) {
+		if file, ok := m.files[directory]; ok {
+			if !file.mode.IsDir() {
+				return &os.PathError{Op: "mkdir", Path: directory, Err: errors.New("not a directory")}
+			}
+			break
+		}
+		missing = append(missing, directory)
+		if filepath.Dir(directory) == directory {
+			break
+		}
+	}
+	for _, directory := range missing {
+		m.files[directory] = &memFile{mode: os.ModeDir | perm&os.ModePerm, modTime: time.Now()}
+	}
+	return
+}
+
+// Rename moves the file (or directory, along with everything in it) called oldpath to newpath, replacing the file
+// that's already there, if any.
+func (m *MemFS) Rename(oldpath string, newpath string) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	linkError := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	from, file, err := m.lookup(oldpath, false)
+	if err != nil {
+		return linkError(err)
+	}
+	to, err := m.resolve(newpath, false)
+	if err != nil {
+		return linkError(err)
+	}
+	if err = m.checkParent(to); err != nil {
+		return linkError(err)
+	}
+	if existing, ok := m.files[to]; ok && existing.mode.IsDir() {
+		return linkError(errors.New("file exists"))
+	}
+	if file.mode.IsDir() && strings.HasPrefix(to, from+string(os.PathSeparator)) {
+		return linkError(errors.New("invalid argument"))
+	}
+	for path, child := range m.files {
+		if strings.HasPrefix(path, from+string(os.PathSeparator)) {
+			delete(m.files, path)
+			m.files[to+path[len(from):]] = child
+		}
+	}
+	delete(m.files, from)
+	m.files[to] = file
+	return
+}
+
+// Remove removes the file or empty directory called name.
+func (m *MemFS) Remove(name string) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	resolved, file, err := m.lookup(name, false)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if file.mode.IsDir() {
+		for path := range m.files {
+			if path != resolved && filepath.Dir(path) == resolved {
+				return &os.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+			}
+		}
+	}
+	delete(m.files, resolved)
+	return
+}
+
+// Symlink creates a symlink called newname that points to oldname.
+func (m *MemFS) Symlink(oldname string, newname string) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	linkError := func(err error) error {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	resolved, err := m.resolve(newname, false)
+	if err != nil {
+		return linkError(err)
+	}
+	if _, ok := m.files[resolved]; ok {
+		return linkError(errors.New("file exists"))
+	}
+	if err = m.checkParent(resolved); err != nil {
+		return linkError(err)
+	}
+	m.files[resolved] = &memFile{mode: os.ModeSymlink | 0777, size: int64(len(oldname)), modTime: time.Now(), target: oldname}
+	return
+}
+
+// lookup resolves name (see MemFS.resolve) and returns the file it refers to, or os.ErrNotExist if there isn't one.
+func (m *MemFS) lookup(name string, follow bool) (resolved string, file *memFile, err error) {
+	resolved, err = m.resolve(name, follow)
+	if err != nil {
+		return
+	}
+	file, ok := m.files[resolved]
+	if !ok {
+		return "", nil, os.ErrNotExist
+	}
+	return
+}
+
+// checkParent makes sure the directory that the file at the resolved path would be in exists.
+func (m *MemFS) checkParent(resolved string) error {
+	parent, ok := m.files[filepath.Dir(resolved)]
+	if !ok {
+		return os.ErrNotExist
+	}
+	if !parent.mode.IsDir() {
+		return errors.New("not a directory")
+	}
+	return nil
+}
+
+// resolve follows every symlink among the directories in name (and the last element of name too, if follow is true)
+// and returns the absolute path that's left. Relative names are resolved from the root directory, and the elements of
+// name don't have to exist.
+func (m *MemFS) resolve(name string, follow bool) (resolved string, err error) {
+	separator := string(os.PathSeparator)
+	resolved = separator
+	pending := strings.Split(filepath.Clean(name), separator)
+	for hops := 0; len(pending) > 0; {
+		element := pending[0]
+		pending = pending[1:]
+		switch element {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		next := filepath.Join(resolved, element)
+		if file, ok := m.files[next]; ok && file.mode&os.ModeSymlink != 0 && (follow || len(pending) > 0) {
+			if hops++; hops > maxSymlinkHops {
+				return "", errors.New("too many levels of symbolic links")
+			}
+			if filepath.IsAbs(file.target) {
+				resolved = separator
+			}
+			pending = append(strings.Split(filepath.Clean(file.target), separator), pending...)
+			continue
+		}
+		resolved = next
+	}
+	return
+}
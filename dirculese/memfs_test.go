@@ -0,0 +1,78 @@
+package dirculese
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemFS(t *testing.T) {
+	fs := NewMemFS()
+	if err := fs.MkdirAll("/home/user/downloads", 0755); err != nil {
+		t.Fatalf("MkdirAll returned an error. Got '%v'", err)
+	}
+	if err := fs.WriteFile("/home/user/downloads/a.png", 10, 0644); err != nil {
+		t.Fatalf("WriteFile returned an error. Got '%v'", err)
+	}
+	if err := fs.WriteFile("/missing/a.png", 10, 0644); !os.IsNotExist(err) {
+		t.Errorf("WriteFile created a file in a directory that doesn't exist. Got '%v'", err)
+	}
+	info, err := fs.Stat("/home/user/downloads/../downloads/a.png")
+	if err != nil || info.Name() != "a.png" || info.Size() != 10 || info.IsDir() {
+		t.Errorf("Mismatch in file info. Got '%v' (%v)", info, err)
+	}
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	fs.Chtimes("/home/user/downloads/a.png", modTime)
+	if info, _ = fs.Stat("/home/user/downloads/a.png"); !info.ModTime().Equal(modTime) {
+		t.Errorf("Mismatch in modification time. Got '%v', want '%v'", info.ModTime(), modTime)
+	}
+
+	// symlinks are followed by Stat, and relative ones are relative to their directory
+	fs.Symlink("a.png", "/home/user/downloads/link")
+	fs.Symlink("/home/user/downloads", "/home/user/shortcut")
+	fs.Symlink("gone.png", "/home/user/downloads/broken")
+	if info, err = fs.Lstat("/home/user/downloads/link"); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Lstat followed the symlink. Got '%v' (%v)", info, err)
+	}
+	if info, err = fs.Stat("/home/user/shortcut/link"); err != nil || info.Name() != "a.png" {
+		t.Errorf("Stat didn't follow the symlinks. Got '%v' (%v)", info, err)
+	}
+	if target, err := fs.EvalSymlinks("/home/user/shortcut/link"); target != "/home/user/downloads/a.png" || err != nil {
+		t.Errorf("Mismatch in resolved path. Got '%v' (%v)", target, err)
+	}
+	if target, err := fs.Readlink("/home/user/downloads/link"); target != "a.png" || err != nil {
+		t.Errorf("Mismatch in symlink target. Got '%v' (%v)", target, err)
+	}
+	if _, err = fs.Stat("/home/user/downloads/broken"); !os.IsNotExist(err) || !isBrokenSymlink(fs, "/home/user/downloads/broken") {
+		t.Errorf("Broken symlink wasn't reported as missing. Got '%v'", err)
+	}
+
+	files, err := fs.ReadDir("/home/user/downloads")
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "a.png,broken,link" || err != nil {
+		t.Errorf("Mismatch in directory contents. Got '%v' (%v)", names, err)
+	}
+
+	// renaming a directory takes everything in it along
+	if err = fs.Rename("/home/user/downloads", "/home/user/old"); err != nil {
+		t.Fatalf("Rename returned an error. Got '%v'", err)
+	}
+	if _, err = fs.Stat("/home/user/old/link"); err != nil {
+		t.Errorf("The contents of a renamed directory weren't moved. Got '%v'", err)
+	}
+	if err = fs.Remove("/home/user/old"); err == nil {
+		t.Error("Remove removed a directory that isn't empty")
+	}
+	if err = fs.Remove("/home/user/old/a.png"); err != nil {
+		t.Errorf("Remove returned an error. Got '%v'", err)
+	}
+	if _, err = fs.Lstat("/home/user/old/a.png"); !os.IsNotExist(err) {
+		t.Errorf("A removed file still exists. Got '%v'", err)
+	}
+}
@@ -0,0 +1,211 @@
+package dirculese
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsContentType is the content type of Prometheus' text exposition format, which Metrics are written in.
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// The results that runs are counted by in the dirculese_runs_total metric.
+const (
+	RunResultSuccess     = "success"
+	RunResultFailure     = "failure"
+	RunResultInterrupted = "interrupted"
+)
+
+// ruleMetrics are the counters that Metrics keeps for a single rule.
+type ruleMetrics struct {
+	matched      int64
+	moved        int64
+	movedBytes   int64
+	deleted      int64
+	deletedBytes int64
+	conflicts    int64
+	failures     int64
+}
+
+// Metrics collects Prometheus metrics from the events of engines' runs (see Metrics.Subscribe) and writes them in
+// Prometheus' text exposition format. It's an http.Handler, so it can be served for Prometheus to scrape, and it's safe
+// to use from several goroutines at once. The metrics are:
+//
+//	dirculese_files_matched_total{directory,rule}    files that a rule's handler matched
+//	dirculese_files_moved_total{directory,rule}      files that a rule moved
+//	dirculese_moved_bytes_total{directory,rule}      bytes that a rule moved
+//	dirculese_files_deleted_total{directory,rule}    files that a rule deleted
+//	dirculese_deleted_bytes_total{directory,rule}    bytes that a rule deleted
+//	dirculese_conflicts_total{directory,rule}        files whose name was already taken in their destination
+//	dirculese_rule_failures_total{directory,rule}    times a rule stopped because of an error
+//	dirculese_runs_total{result}                     runs by result (success, failure or interrupted)
+//	dirculese_run_duration_seconds                   a summary of how long runs took
+//	dirculese_last_success_timestamp_seconds         when the last successful run finished (0 if there wasn't one)
+type Metrics struct {
+	mutex         sync.Mutex
+	rules         map[ruleKey]*ruleMetrics
+	runs          map[string]int64
+	durationSum   time.Duration
+	durationCount int64
+	lastSuccess   time.Time
+}
+
+// NewMetrics returns Metrics without any runs.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		rules: make(map[ruleKey]*ruleMetrics),
+		runs:  map[string]int64{RunResultSuccess: 0, RunResultFailure: 0, RunResultInterrupted: 0},
+	}
+}
+
+// Subscribe collects the metrics of engine's runs from now on. Dry runs are left out, since nothing happens in them.
+func (m *Metrics) Subscribe(engine *Engine) {
+	dryRun := false
+	engine.Subscribe(func(event Event) {
+		if started, ok := event.(RunStarted); ok {
+			dryRun = started.DryRun
+		}
+		if !dryRun {
+			m.Observe(event)
+		}
+	})
+}
+
+// Observe adds an event to the metrics.
+func (m *Metrics) Observe(event Event) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	switch e := event.(type) {
+	case FileMatched:
+		m.rule(e.Directory, e.Rule).matched++
+	case FileMoved:
+		rule := m.rule(e.Directory, e.Rule)
+		rule.moved++
+		rule.movedBytes += e.Size
+	case FileDeleted:
+		rule := m.rule(e.Directory, e.Rule)
+		rule.deleted++
+		rule.deletedBytes += e.Size
+	case ConflictResolved:
+		m.rule(e.Directory, e.Rule).conflicts++
+	case RuleFailed:
+		m.rule(e.Directory, e.Rule).failures++
+	case RunFinished:
+		m.durationSum += e.Duration
+		m.durationCount++
+		switch {
+		case e.Interrupted:
+			m.runs[RunResultInterrupted]++
+		case e.Err != nil:
+			m.runs[RunResultFailure]++
+		default:
+			m.runs[RunResultSuccess]++
+			m.lastSuccess = e.Time
+		}
+	}
+}
+
+// rule returns the counters of the rule with the given name in the directory with the given label.
+func (m *Metrics) rule(directory string, rule string) *ruleMetrics {
+	key := ruleKey{directory: directory, rule: rule}
+	if m.rules[key] == nil {
+		m.rules[key] = &ruleMetrics{}
+	}
+	return m.rules[key]
+}
+
+// WriteTo writes the metrics to w in Prometheus' text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (n int64, err error) {
+	var text bytes.Buffer
+	m.mutex.Lock()
+	keys := make([]ruleKey, 0, len(m.rules))
+	for key := range m.rules {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i int, j int) bool {
+		if keys[i].directory != keys[j].directory {
+			return keys[i].directory < keys[j].directory
+		}
+		return keys[i].rule < keys[j].rule
+	})
+	header := func(name string, metricType string, help string) {
+		text.WriteString("# HELP " + name + " " + help + "\n# TYPE " + name + " " + metricType + "\n")
+	}
+	ruleCounter := func(name string, help string, value func(rule *ruleMetrics) int64) {
+		header(name, "counter", help)
+		for _, key := range keys {
+			text.WriteString(name + "{directory=\"" + escapeMetricLabel(key.directory) + "\",rule=\"" +
+				escapeMetricLabel(key.rule) + "\"} " + strconv.FormatInt(value(m.rules[key]), 10) + "\n")
+		}
+	}
+	ruleCounter("dirculese_files_matched_total", "Files that a rule's handler matched.", func(rule *ruleMetrics) int64 { return rule.matched })
+	ruleCounter("dirculese_files_moved_total", "Files that a rule moved.", func(rule *ruleMetrics) int64 { return rule.moved })
+	ruleCounter("dirculese_moved_bytes_total", "Bytes that a rule moved.", func(rule *ruleMetrics) int64 { return rule.movedBytes })
+	ruleCounter("dirculese_files_deleted_total", "Files that a rule deleted.", func(rule *ruleMetrics) int64 { return rule.deleted })
+	ruleCounter("dirculese_deleted_bytes_total", "Bytes that a rule deleted.", func(rule *ruleMetrics) int64 { return rule.deletedBytes })
+	ruleCounter("dirculese_conflicts_total", "Files whose name was already taken in their destination.", func(rule *ruleMetrics) int64 { return rule.conflicts })
+	ruleCounter("dirculese_rule_failures_total", "Times a rule stopped because of an error.", func(rule *ruleMetrics) int64 { return rule.failures })
+
+	header("dirculese_runs_total", "counter", "Runs by their result.")
+	for _, result := range []string{RunResultSuccess, RunResultFailure, RunResultInterrupted} {
+		text.WriteString("dirculese_runs_total{result=\"" + result + "\"} " + strconv.FormatInt(m.runs[result], 10) + "\n")
+	}
+	header("dirculese_run_duration_seconds", "summary", "How long runs took.")
+	text.WriteString("dirculese_run_duration_seconds_sum " + strconv.FormatFloat(m.durationSum.Seconds(), 'g', -1, 64) + "\n")
+	text.WriteString("dirculese_run_duration_seconds_count " + strconv.FormatInt(m.durationCount, 10) + "\n")
+	header("dirculese_last_success_timestamp_seconds", "gauge", "When the last successful run finished, in seconds since the Unix epoch.")
+	lastSuccess := 0.0
+	if !m.lastSuccess.IsZero() {
+		lastSuccess = float64(m.lastSuccess.UnixNano()) / float64(time.Second)
+	}
+	text.WriteString("dirculese_last_success_timestamp_seconds " + strconv.FormatFloat(lastSuccess, 'f', -1, 64) + "\n")
+	m.mutex.Unlock()
+
+	written, err := w.Write(text.Bytes())
+	return int64(written), err
+}
+
+// ServeHTTP writes the metrics in response to a request (usually Prometheus scraping them).
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", MetricsContentType)
+	m.WriteTo(w)
+}
+
+// WriteFile writes the metrics to the file at path, which can be read by the textfile collector of Prometheus' node
+// exporter. The metrics are written to a temporary file that replaces the one at path once it's complete, so the
+// collector never reads a partial file.
+func (m *Metrics) WriteFile(path string) (err error) {
+	temp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	defer os.Remove(temp.Name())
+	_, err = m.WriteTo(temp)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	return
+}
+
+// escapeMetricLabel escapes the backslashes, double quotes and newlines in the value of a metric's label.
+func escapeMetricLabel(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(value)
+}
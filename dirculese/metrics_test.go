@@ -0,0 +1,116 @@
+package dirculese
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	fs := NewMemFS()
+	fs.MkdirAll("/downloads", 0755)
+	fs.MkdirAll("/images", 0755)
+	fs.MkdirAll("/documents", 0755)
+	fs.WriteFile("/downloads/a.png", 100, 0644)
+	fs.WriteFile("/downloads/b.png", 20, 0644)
+	fs.WriteFile("/downloads/c.txt", 5, 0644)
+	fs.WriteFile("/downloads/d.pdf", 1, 0644)
+	fs.WriteFile("/images/a.png", 1, 0644)
+
+	config := DirectoriesConfig{Directories: []DirectoryConfig{{
+		Path: "/downloads",
+		Name: "downloads",
+		Rules: []RuleConfig{
+			{Name: "images", Handler: "ExtensionHandler", Extensions: []string{"png"}, Target: "/images"},
+			{Name: "text", Handler: "ExtensionHandler", Extensions: []string{"txt"}, Delete: true},
+			{Name: "documents", Handler: "ExtensionHandler", Extensions: []string{"pdf"}, Target: "/documents"},
+		},
+	}}}
+	metrics := NewMetrics()
+
+	// dry runs aren't counted
+	engine, err := New(config, Options{FS: fs, DryRun: true})
+	if err != nil {
+		t.Fatalf("New returned an error. Got '%v'", err)
+	}
+	metrics.Subscribe(engine)
+	if err = engine.Run(context.Background()); err != nil {
+		t.Fatalf("Run returned an error during the dry run. Got '%v'", err)
+	}
+
+	finished := time.Date(2020, 5, 17, 9, 30, 0, 0, time.UTC)
+	engine, err = New(config, Options{FS: fs, Clock: func() time.Time { return finished }})
+	if err != nil {
+		t.Fatalf("New returned an error. Got '%v'", err)
+	}
+	metrics.Subscribe(engine)
+	if err = engine.Run(context.Background()); err != nil {
+		t.Fatalf("Run returned an error. Got '%v'", err)
+	}
+
+	// the documents directory disappears after the configuration was checked, so its rule fails
+	fs.Remove("/documents/d.pdf")
+	fs.Remove("/documents")
+	fs.WriteFile("/downloads/e.pdf", 1, 0644)
+	if err = engine.Run(context.Background()); err == nil {
+		t.Fatal("Run didn't return the error of the failed rule")
+	}
+
+	server := httptest.NewServer(metrics)
+	defer server.Close()
+	response, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatalf("Couldn't get the metrics. Got '%v'", err)
+	}
+	defer response.Body.Close()
+	if contentType := response.Header.Get("Content-Type"); contentType != MetricsContentType {
+		t.Errorf("Mismatch in the content type. Got '%v', want '%v'", contentType, MetricsContentType)
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	for _, want := range []string{
+		"# TYPE dirculese_files_moved_total counter\n",
+		`dirculese_files_matched_total{directory="downloads",rule="images"} 2`,
+		`dirculese_files_matched_total{directory="downloads",rule="documents"} 1`,
+		`dirculese_files_moved_total{directory="downloads",rule="images"} 2`,
+		`dirculese_moved_bytes_total{directory="downloads",rule="images"} 120`,
+		`dirculese_files_deleted_total{directory="downloads",rule="text"} 1`,
+		`dirculese_deleted_bytes_total{directory="downloads",rule="text"} 5`,
+		`dirculese_conflicts_total{directory="downloads",rule="images"} 1`,
+		`dirculese_rule_failures_total{directory="downloads",rule="documents"} 1`,
+		`dirculese_runs_total{result="success"} 1`,
+		`dirculese_runs_total{result="failure"} 1`,
+		"dirculese_run_duration_seconds_count 2\n",
+		"dirculese_last_success_timestamp_seconds 1589707800\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("The metrics are missing '%v'. Got '%v'", want, string(body))
+		}
+	}
+
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+	path := filepath.Join(tempDirectory, "dirculese.prom")
+	if err = metrics.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile returned an error. Got '%v'", err)
+	}
+	if content, _ := ioutil.ReadFile(path); string(content) != string(body) {
+		t.Errorf("Mismatch in the metrics file. Got '%v', want '%v'", string(content), string(body))
+	}
+	if files, _ := ioutil.ReadDir(tempDirectory); len(files) != 1 {
+		t.Errorf("WriteFile left its temporary file behind. Got '%v' files", len(files))
+	}
+}
+
+func TestEscapeMetricLabel(t *testing.T) {
+	if got := escapeMetricLabel("C:\\Users\\\"you\"\n"); got != `C:\\Users\\\"you\"\n` {
+		t.Errorf("Mismatch in the escaped label. Got '%v'", got)
+	}
+}
@@ -0,0 +1,260 @@
+package dirculese
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// sequencer hands out turns in index order to work that runs concurrently, so that the parts of the work that have to
+// happen in a fixed order (like picking a free name in a target directory) do, while everything else runs in parallel.
+// Every index has to be marked as done exactly once (marking it more than once is harmless).
+type sequencer struct {
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	next     int
+	finished map[int]bool
+}
+
+// newSequencer creates a sequencer whose first turn is index 0.
+func newSequencer() *sequencer {
+	s := &sequencer{finished: make(map[int]bool)}
+	s.cond = sync.NewCond(&s.mutex)
+	return s
+}
+
+// wait blocks until every index before index is done.
+func (s *sequencer) wait(index int) {
+	s.mutex.Lock()
+	for s.next < index {
+		s.cond.Wait()
+	}
+	s.mutex.Unlock()
+}
+
+// done marks index as done, which lets the indexes after it have their turn once all the indexes before them are done
+// too.
+func (s *sequencer) done(index int) {
+	s.mutex.Lock()
+	s.finished[index] = true
+	for s.finished[s.next] {
+		delete(s.finished, s.next)
+		s.next++
+	}
+	s.cond.Broadcast()
+	s.mutex.Unlock()
+}
+
+// turn is a single index of a sequencer, which is given to a copy of a Rule that handles one file concurrently with
+// others (see Rule.move).
+type turn struct {
+	sequencer *sequencer
+	index     int
+}
+
+// wait blocks until it's this turn.
+func (t *turn) wait() {
+	t.sequencer.wait(t.index)
+}
+
+// done ends this turn.
+func (t *turn) done() {
+	t.sequencer.done(t.index)
+}
+
+// handleConcurrently performs a rule's action on every item that the named handler matched, using up to workers
+// goroutines. Pre hooks, commands and post hooks run in parallel, but moves take turns in the order of the items (see
+// Rule.move), so files are renamed the same way they would be if they were handled one by one. Once an item fails (or
+// ctx is done), no new items are started, and the error of the first item that failed (or ctx.Err()) is returned. The
+// items that were already started are always finished.
+func (r *Rule) handleConcurrently(ctx context.Context, handler string, items []os.FileInfo, destinations []string, workers int) (err error) {
+	order := newSequencer()
+	errs := make([]error, len(items))
+	var failed bool
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	indexes := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				// every worker handles the file with its own copy of the rule, which knows the file's turn
+				worker := *r
+				worker.turn = &turn{sequencer: order, index: i}
+				errs[i] = worker.handle(ctx, handler, items[i], destinations[i])
+				worker.turn.done()
+				if errs[i] != nil {
+					mutex.Lock()
+					failed = true
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range items {
+		mutex.Lock()
+		stop := failed || ctx.Err() != nil
+		mutex.Unlock()
+		if stop {
+			// the items that won't be started still have to take their turn
+			order.done(i)
+			continue
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for _, itemErr := range errs {
+		if itemErr != nil {
+			return errors.New(itemErr.Error())
+		}
+	}
+	return ctx.Err()
+}
+
+// RunDirectories runs the rules of every enabled directory (see Directory.Ruler), using up to workers goroutines.
+// Directories are only run at the same time as each other if they're independent, which means none of their paths or
+// rule targets are the same as (or inside) one of the other's, so files from two directories are never moved into the
+// same place at the same time. Directories that aren't independent run one after another, in the order they're
+// configured. Every directory is run even if another one fails, and the errors are returned in the same order. Once ctx
+// is done, the directories stop after the file they're handling (see Directory.Ruler), the ones that haven't started
+// are skipped, and the error says that the run was interrupted. The workers are split between the directories that run
+// at the same time and the files that each of them handles at once (see Directory.workers), so no more than workers
+// files are handled at the same time overall.
+func RunDirectories(ctx context.Context, directories []Directory, workers int) (err error) {
+	if workers < 1 {
+		workers = 1
+	}
+	groups := independentGroups(directories)
+	errs := make([]error, len(directories))
+	var wg sync.WaitGroup
+
+	directoryWorkers := maxInt(minInt(workers, len(groups)), 1)
+	for i := range directories {
+		directories[i].workers = workers / directoryWorkers
+	}
+	indexes := make(chan int)
+	for w := 0; w < directoryWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for g := range indexes {
+				for _, i := range groups[g] {
+					if ctx.Err() != nil {
+						break
+					}
+					if directories[i].disabled {
+						directories[i].log(LogEntry{Level: LevelDebug, Action: ActionSkip, Message: "Skipped the directory because it isn't enabled."})
+						continue
+					}
+					errs[i] = directories[i].Ruler(ctx)
+				}
+			}
+		}()
+	}
+	for g := range groups {
+		indexes <- g
+	}
+	close(indexes)
+	wg.Wait()
+
+	var messages []string
+	for _, directoryErr := range errs {
+		if directoryErr != nil && directoryErr != ctx.Err() {
+			messages = append(messages, directoryErr.Error())
+		}
+	}
+	if ctx.Err() != nil {
+		messages = append(messages, "the run was interrupted: "+ctx.Err().Error())
+	}
+	if len(messages) > 0 {
+		return errors.New(strings.Join(messages, "\n"))
+	}
+	return
+}
+
+// independentGroups splits directories into groups that can run at the same time as each other: two directories are in
+// the same group if any of their paths (the directory's own path and its rules' targets) overlap. Each group lists the
+// indexes of its directories in order, and the groups are ordered by their first directory.
+func independentGroups(directories []Directory) (groups [][]int) {
+	paths := make([][]string, len(directories))
+	for i := range directories {
+		paths[i] = append(paths[i], directories[i].path)
+		for _, r := range directories[i].rules {
+			if target := r.TargetPath(); target != "" {
+				paths[i] = append(paths[i], target)
+			}
+		}
+	}
+
+	// every directory starts in a group of its own, and the groups of overlapping directories are merged, keeping the
+	// earliest directory of each group as its root
+	root := make([]int, len(directories))
+	find := func(i int) int {
+		for root[i] != i {
+			i = root[i]
+		}
+		return i
+	}
+	for i := range directories {
+		root[i] = i
+		for j := 0; j < i; j++ {
+			if a, b := find(i), find(j); a != b && overlapping(paths[i], paths[j]) {
+				root[maxInt(a, b)] = minInt(a, b)
+			}
+		}
+	}
+
+	index := make(map[int]int)
+	for i := range directories {
+		g, ok := index[find(i)]
+		if !ok {
+			g = len(groups)
+			index[find(i)] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return
+}
+
+// overlapping reports whether any of the paths in a are the same as (or inside) any of the paths in b, or the other
+// way around.
+func overlapping(a []string, b []string) bool {
+	for _, pathA := range a {
+		for _, pathB := range b {
+			if insidePath(pathA, pathB) || insidePath(pathB, pathA) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// minInt returns the smaller of two ints.
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// maxInt returns the larger of two ints.
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// insidePath reports whether path is the same as parent or inside it.
+func insidePath(path string, parent string) bool {
+	path, parent = filepath.Clean(path), filepath.Clean(parent)
+	return path == parent || strings.HasPrefix(path, strings.TrimSuffix(parent, string(os.PathSeparator))+string(os.PathSeparator))
+}
@@ -0,0 +1,144 @@
+package dirculese
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRule_handleConcurrently(t *testing.T) {
+	// moves files whose names collide with each other and with a file in the target, one by one or with several workers,
+	// and returns which file ended up with which name
+	organize := func(workers int) (moved map[string]string, count int) {
+		tempDirectory, err := ioutil.TempDir("", "dirculese")
+		if err != nil {
+			t.Fatal("Couldn't create a temporary directory: " + err.Error())
+		}
+		defer os.RemoveAll(tempDirectory)
+		target := filepath.Join(tempDirectory, "target")
+		os.Mkdir(target, 0755)
+		ioutil.WriteFile(filepath.Join(target, "a.txt"), []byte("existing"), 0644)
+		for i := 0; i < 30; i++ {
+			for _, name := range []string{"a" + fmt.Sprint(i) + ".txt", "a" + fmt.Sprint(i) + "0.txt"} {
+				ioutil.WriteFile(filepath.Join(tempDirectory, name), []byte(name), 0644)
+			}
+		}
+		ioutil.WriteFile(filepath.Join(tempDirectory, "a.txt"), []byte("a.txt"), 0644)
+		// the target directory is counted in place of the file that's already in it
+		files, _ := ioutil.ReadDir(tempDirectory)
+		count = len(files)
+
+		testDirectory := Directory{path: tempDirectory, workers: workers}
+		testDirectory.rules = []Rule{{source: &testDirectory, target: &Directory{path: target}, handler: "ExtensionHandler", extensions: []string{"txt"}}}
+		if err = testDirectory.Ruler(context.Background()); err != nil {
+			t.Fatalf("Ruler returned an error with %v workers. Got '%v'", workers, err)
+		}
+
+		moved = make(map[string]string)
+		files, _ = ioutil.ReadDir(target)
+		for _, f := range files {
+			contents, _ := ioutil.ReadFile(filepath.Join(target, f.Name()))
+			moved[f.Name()] = string(contents)
+		}
+		return
+	}
+
+	want, count := organize(1)
+	if len(want) != count {
+		t.Fatalf("Files were lost when moving them one by one. Got %v files, want %v", len(want), count)
+	}
+	for i := 0; i < 5; i++ {
+		if got, _ := organize(8); !reflect.DeepEqual(got, want) {
+			t.Errorf("Files were renamed differently with several workers. Got '%v', want '%v'", got, want)
+		}
+	}
+}
+
+func TestRule_handleConcurrently_SymlinksFollow(t *testing.T) {
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+	target := filepath.Join(tempDirectory, "target")
+	os.Mkdir(target, 0755)
+	// every file has a link right before it, which is handled by following it to the file while the file itself may be
+	// handled by another worker
+	for i := 0; i < 20; i++ {
+		name := "file" + fmt.Sprint(i) + ".txt"
+		ioutil.WriteFile(filepath.Join(tempDirectory, name), []byte(name), 0644)
+		if err = os.Symlink(name, filepath.Join(tempDirectory, "file"+fmt.Sprint(i)+"-link.txt")); err != nil {
+			t.Skip("this test needs symlinks: " + err.Error())
+		}
+	}
+
+	testDirectory := Directory{path: tempDirectory, workers: 4}
+	testDirectory.rules = []Rule{{source: &testDirectory, target: &Directory{path: target}, handler: "ExtensionHandler", extensions: []string{"txt"}, symlinks: SymlinksFollow}}
+	if err = testDirectory.Ruler(context.Background()); err != nil {
+		t.Fatalf("Ruler returned an error. Got '%v'", err)
+	}
+	if files, _ := ioutil.ReadDir(target); len(files) != 20 {
+		t.Errorf("Mismatch in the number of moved files. Got %v, want 20", len(files))
+	}
+}
+
+func TestIndependentGroups(t *testing.T) {
+	rule := func(target string) []Rule {
+		return []Rule{{target: &Directory{path: target}}}
+	}
+	directories := []Directory{
+		{path: "/a", rules: rule("/x")},
+		{path: "/b", rules: rule("/y")},
+		{path: "/c", rules: rule("/x/sub")},
+		{path: "/y"},
+		{path: "/d", rules: rule("/xy")},
+		{path: "/e", rules: rule("/b")},
+	}
+	want := [][]int{{0, 2}, {1, 3, 5}, {4}}
+	if got := independentGroups(directories); !reflect.DeepEqual(got, want) {
+		t.Errorf("Mismatch in groups. Got '%v', want '%v'", got, want)
+	}
+}
+
+func TestRunDirectories(t *testing.T) {
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+
+	directories := make([]Directory, 4)
+	for i := range directories {
+		path := filepath.Join(tempDirectory, fmt.Sprint(i))
+		os.MkdirAll(filepath.Join(path, "target"), 0755)
+		ioutil.WriteFile(filepath.Join(path, "file.txt"), []byte{}, 0644)
+		directories[i].path = path
+		directories[i].rules = []Rule{{source: &directories[i], target: &Directory{path: filepath.Join(path, "target")}, handler: "ExtensionHandler", extensions: []string{"txt"}}}
+	}
+	directories[1].disabled = true
+	directories[2].rules[0].handler = "UnknownHandler"
+
+	err = RunDirectories(context.Background(), directories, 3)
+	if err == nil || err.Error() != "["+directories[2].path+"/] unrecognized handler" {
+		t.Errorf("The failing directory wasn't reported. Got '%v'", err)
+	}
+	for i, moved := range []bool{true, false, false, true} {
+		if _, statErr := os.Stat(filepath.Join(directories[i].path, "target", "file.txt")); (statErr == nil) != moved {
+			t.Errorf("Mismatch in whether the file in directory %v was moved. Got '%v', want '%v'", i, statErr == nil, moved)
+		}
+	}
+
+	// the workers are split between the directories and their files, so they don't multiply
+	RunDirectories(context.Background(), directories, 8)
+	if directories[0].workers != 2 {
+		t.Errorf("Mismatch in the workers of each directory with 4 independent directories. Got '%v', want '2'", directories[0].workers)
+	}
+	RunDirectories(context.Background(), directories[:1], 8)
+	if directories[0].workers != 8 {
+		t.Errorf("Mismatch in the workers of a single directory. Got '%v', want '8'", directories[0].workers)
+	}
+}
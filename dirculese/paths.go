@@ -0,0 +1,63 @@
+package dirculese
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// SystemConfigDirectory is the directory that holds the system-wide configuration file, which is used when a user
+// doesn't have one of their own.
+const SystemConfigDirectory = "/etc/dirculese"
+
+// ConfigExtensions is the list of extensions that dirculese looks for (in order) when it searches a directory for a
+// config file, one for each of the ConfigFormats.
+var ConfigExtensions = []string{".json", ".yaml", ".yml", ".toml"}
+
+// XDGDirectory returns the directory named by an XDG base directory environment variable (e.g. XDG_CONFIG_HOME). If the
+// variable isn't set, or isn't an absolute path (which the XDG specification says to ignore), fallback is used instead,
+// relative to the user's home directory.
+func XDGDirectory(variable string, fallback string) (directory string, err error) {
+	directory = os.Getenv(variable)
+	if filepath.IsAbs(directory) {
+		return
+	}
+	home, err := GetUserHome()
+	if err != nil {
+		return
+	}
+	return filepath.Join(home, fallback), nil
+}
+
+// ConfigSearchPaths returns the configuration files that dirculese looks for when it isn't told where its configuration
+// file is, in the order it looks for them: config.* in $XDG_CONFIG_HOME/dirculese (~/.config/dirculese by default),
+// then the ConfigFileNames in the user's home directory, then config.* in the SystemConfigDirectory.
+func ConfigSearchPaths() (paths []string, err error) {
+	configHome, err := XDGDirectory("XDG_CONFIG_HOME", ".config")
+	if err != nil {
+		return
+	}
+	home, err := GetUserHome()
+	if err != nil {
+		return
+	}
+	for _, extension := range ConfigExtensions {
+		paths = append(paths, filepath.Join(configHome, "dirculese", "config"+extension))
+	}
+	for _, name := range ConfigFileNames {
+		paths = append(paths, filepath.Join(home, name))
+	}
+	for _, extension := range ConfigExtensions {
+		paths = append(paths, filepath.Join(SystemConfigDirectory, "config"+extension))
+	}
+	return
+}
+
+// GetLogFilePath returns the full path to the file that dirculese logs to, which is DefaultLogFile in
+// $XDG_STATE_HOME/dirculese (~/.local/state/dirculese by default).
+func GetLogFilePath() (path string, err error) {
+	stateHome, err := XDGDirectory("XDG_STATE_HOME", filepath.Join(".local", "state"))
+	if err != nil {
+		return
+	}
+	return filepath.Join(stateHome, "dirculese", DefaultLogFile), nil
+}
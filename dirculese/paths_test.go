@@ -0,0 +1,42 @@
+package dirculese
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigSearchPaths(t *testing.T) {
+	userHome, err := GetUserHome()
+	if err != nil {
+		t.Skip("this test needs a home directory")
+	}
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+
+	// relative XDG directories are ignored
+	for configHome, want := range map[string]string{"/xdg/config": "/xdg/config", "relative": filepath.Join(userHome, ".config")} {
+		os.Setenv("XDG_CONFIG_HOME", configHome)
+		got, err := ConfigSearchPaths()
+		if err != nil || len(got) != 2*len(ConfigExtensions)+len(ConfigFileNames) {
+			t.Fatalf("Mismatch in search paths. Got '%v' (%v)", got, err)
+		}
+		if got[0] != filepath.Join(want, "dirculese", "config.json") {
+			t.Errorf("Mismatch in first search path. Got '%v', want '%v'", got[0], filepath.Join(want, "dirculese", "config.json"))
+		}
+		if got[len(ConfigExtensions)] != filepath.Join(userHome, DefaultConfigFile) {
+			t.Errorf("Mismatch in home search path. Got '%v', want '%v'", got[len(ConfigExtensions)], filepath.Join(userHome, DefaultConfigFile))
+		}
+		if got[len(got)-1] != filepath.Join(SystemConfigDirectory, "config.toml") {
+			t.Errorf("Mismatch in last search path. Got '%v', want '%v'", got[len(got)-1], filepath.Join(SystemConfigDirectory, "config.toml"))
+		}
+	}
+}
+
+func TestGetLogFilePath(t *testing.T) {
+	defer os.Setenv("XDG_STATE_HOME", os.Getenv("XDG_STATE_HOME"))
+	os.Setenv("XDG_STATE_HOME", "/xdg/state")
+	want := filepath.Join("/xdg/state", "dirculese", DefaultLogFile)
+	if got, err := GetLogFilePath(); got != want || err != nil {
+		t.Errorf("Mismatch in log file path. Got '%v' (%v), want '%v'", got, err, want)
+	}
+}
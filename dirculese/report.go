@@ -0,0 +1,439 @@
+package dirculese
+
+import (
+	"encoding/json"
+	"errors"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// ReportVersion is the version of the JSON form of a Report. It only changes when a field is removed or its meaning
+// changes, so scripts can rely on it; new fields can be added without changing it.
+const ReportVersion = 1
+
+// The formats that a Report can be written in (see Report.Write).
+const (
+	ReportFormatMarkdown = "markdown"
+	ReportFormatHTML     = "html"
+	ReportFormatJSON     = "json"
+)
+
+// Report summarizes a run of an Engine: what each of its directories and rules did, how much space was reclaimed, and
+// the files that were left where they were because of conflicts or skipped on purpose, along with the errors that
+// stopped rules. During a dry run, it describes what would have happened. Reports are built by a Reporter.
+type Report struct {
+	Version         int               `json:"version"`
+	RunID           string            `json:"run_id"`
+	Started         time.Time         `json:"started"`
+	Finished        time.Time         `json:"finished"`
+	DurationSeconds float64           `json:"duration_seconds"`
+	DryRun          bool              `json:"dry_run"`
+	Result          string            `json:"result"`
+	Error           string            `json:"error,omitempty"`
+	Totals          ReportTotals      `json:"totals"`
+	Directories     []DirectoryReport `json:"directories"`
+}
+
+// ReportTotals are the counts of a run, directory or rule in a Report. ReclaimedBytes is the size of the files that
+// were deleted, and MovedBytes the size of the ones that were moved.
+type ReportTotals struct {
+	Matched        int   `json:"matched"`
+	Moved          int   `json:"moved"`
+	MovedBytes     int64 `json:"moved_bytes"`
+	Deleted        int   `json:"deleted"`
+	ReclaimedBytes int64 `json:"reclaimed_bytes"`
+	Conflicts      int   `json:"conflicts"`
+	Skipped        int   `json:"skipped"`
+	Errors         int   `json:"errors"`
+}
+
+// DirectoryReport is what a directory did during a run. Its Name is its label (its name, or its path if it doesn't have
+// one), and Skipped has the files that the directory itself skipped (see FileSkipped), while its rules' are in Rules.
+type DirectoryReport struct {
+	Name    string       `json:"name"`
+	Path    string       `json:"path"`
+	Entries int          `json:"entries"`
+	Totals  ReportTotals `json:"totals"`
+	Skipped []ReportFile `json:"skipped"`
+	Rules   []RuleReport `json:"rules"`
+}
+
+// RuleReport is what a rule did during a run. Its Name is the rule's own name, without its directory's.
+type RuleReport struct {
+	Name      string           `json:"name"`
+	Totals    ReportTotals     `json:"totals"`
+	Actions   []ReportAction   `json:"actions"`
+	Conflicts []ReportConflict `json:"conflicts"`
+	Skipped   []ReportFile     `json:"skipped"`
+	Errors    []string         `json:"errors"`
+}
+
+// ReportAction is a file that a rule moved (Action is ActionMove) or deleted (ActionDelete), with its size in bytes.
+type ReportAction struct {
+	Action      string `json:"action"`
+	Source      string `json:"source"`
+	Destination string `json:"destination,omitempty"`
+	Size        int64  `json:"size"`
+}
+
+// ReportConflict is a file whose name was already taken in its Destination directory. NewName is the name it was moved
+// under instead, or empty if it was left where it was.
+type ReportConflict struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	NewName     string `json:"new_name,omitempty"`
+}
+
+// ReportFile is a file that was skipped, and why.
+type ReportFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// Reporter builds a Report of each of an engine's runs from its events. It's safe to use from several goroutines at
+// once.
+type Reporter struct {
+	mutex       sync.Mutex
+	engine      *Engine
+	report      *Report
+	directories map[string]int
+	rules       map[ruleKey][2]int
+}
+
+// NewReporter returns a Reporter that reports on engine's runs from now on.
+func NewReporter(engine *Engine) (reporter *Reporter) {
+	reporter = &Reporter{engine: engine}
+	engine.Subscribe(reporter.observe)
+	return
+}
+
+// Report returns the report of the engine's last run, or nil if it hasn't run yet. The report is only complete once
+// Engine.Run has returned, and it's replaced by a new one when the engine runs again.
+func (r *Reporter) Report() *Report {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.report
+}
+
+// observe adds an event to the report of the current run, starting a new report when a run starts.
+func (r *Reporter) observe(event Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if started, ok := event.(RunStarted); ok {
+		r.start(started)
+		return
+	}
+	if r.report == nil {
+		return
+	}
+	switch e := event.(type) {
+	case DirectoryScanned:
+		if d := r.directory(e.Directory); d != nil {
+			d.Entries = e.Entries
+		}
+	case FileMatched:
+		r.count(e.Directory, e.Rule, func(totals *ReportTotals) { totals.Matched++ })
+	case FileMoved:
+		r.count(e.Directory, e.Rule, func(totals *ReportTotals) { totals.Moved++; totals.MovedBytes += e.Size })
+		if rule := r.rule(e.Directory, e.Rule); rule != nil {
+			rule.Actions = append(rule.Actions, ReportAction{Action: ActionMove, Source: e.From, Destination: e.To, Size: e.Size})
+		}
+	case FileDeleted:
+		r.count(e.Directory, e.Rule, func(totals *ReportTotals) { totals.Deleted++; totals.ReclaimedBytes += e.Size })
+		if rule := r.rule(e.Directory, e.Rule); rule != nil {
+			rule.Actions = append(rule.Actions, ReportAction{Action: ActionDelete, Source: e.Path, Size: e.Size})
+		}
+	case ConflictResolved:
+		r.count(e.Directory, e.Rule, func(totals *ReportTotals) { totals.Conflicts++ })
+		if rule := r.rule(e.Directory, e.Rule); rule != nil {
+			rule.Conflicts = append(rule.Conflicts, ReportConflict{Source: e.Path, Destination: e.Destination, NewName: e.NewName})
+		}
+	case FileSkipped:
+		r.skip(e)
+	case RuleFailed:
+		r.count(e.Directory, e.Rule, func(totals *ReportTotals) { totals.Errors++ })
+		if rule := r.rule(e.Directory, e.Rule); rule != nil {
+			rule.Errors = append(rule.Errors, e.Err.Error())
+		}
+	case RunFinished:
+		r.finish(e)
+	}
+}
+
+// start starts the report of a run with every directory and rule that's going to run, in the order they run in, so
+// that the ones that didn't do anything are in the report too.
+func (r *Reporter) start(started RunStarted) {
+	r.report = &Report{Version: ReportVersion, RunID: started.RunID, Started: started.Time, DryRun: started.DryRun, Directories: []DirectoryReport{}}
+	r.directories = make(map[string]int)
+	r.rules = make(map[ruleKey][2]int)
+	for _, d := range r.engine.directories {
+		if d.disabled {
+			continue
+		}
+		directoryReport := DirectoryReport{Name: d.label(), Path: d.path, Skipped: []ReportFile{}, Rules: []RuleReport{}}
+		r.directories[d.label()] = len(r.report.Directories)
+		for _, rule := range d.rules {
+			if rule.disabled {
+				continue
+			}
+			r.rules[ruleKey{directory: d.label(), rule: rule.name}] = [2]int{len(r.report.Directories), len(directoryReport.Rules)}
+			directoryReport.Rules = append(directoryReport.Rules, RuleReport{
+				Name:      rule.name,
+				Actions:   []ReportAction{},
+				Conflicts: []ReportConflict{},
+				Skipped:   []ReportFile{},
+				Errors:    []string{},
+			})
+		}
+		r.report.Directories = append(r.report.Directories, directoryReport)
+	}
+}
+
+// finish records how a run ended.
+func (r *Reporter) finish(finished RunFinished) {
+	r.report.Finished = finished.Time
+	r.report.DurationSeconds = finished.Duration.Seconds()
+	switch {
+	case finished.Interrupted:
+		r.report.Result = RunResultInterrupted
+	case finished.Err != nil:
+		r.report.Result = RunResultFailure
+	default:
+		r.report.Result = RunResultSuccess
+	}
+	if finished.Err != nil {
+		r.report.Error = finished.Err.Error()
+	}
+}
+
+// directory returns the report of the directory with the given label, or nil if it isn't in the run.
+func (r *Reporter) directory(label string) *DirectoryReport {
+	i, ok := r.directories[label]
+	if !ok {
+		return nil
+	}
+	return &r.report.Directories[i]
+}
+
+// rule returns the report of the rule with the given name in the directory with the given label, or nil if it isn't in
+// the run.
+func (r *Reporter) rule(directory string, rule string) *RuleReport {
+	i, ok := r.rules[ruleKey{directory: directory, rule: rule}]
+	if !ok {
+		return nil
+	}
+	return &r.report.Directories[i[0]].Rules[i[1]]
+}
+
+// count updates the totals of the rule with the given name in the directory with the given label, of its directory and
+// of the whole run.
+func (r *Reporter) count(directory string, rule string, update func(totals *ReportTotals)) {
+	update(&r.report.Totals)
+	if i, ok := r.rules[ruleKey{directory: directory, rule: rule}]; ok {
+		update(&r.report.Directories[i[0]].Totals)
+		update(&r.report.Directories[i[0]].Rules[i[1]].Totals)
+	}
+}
+
+// skip adds a skipped file to the report of the rule that skipped it, or of its directory.
+func (r *Reporter) skip(skipped FileSkipped) {
+	file := ReportFile{Path: skipped.Path, Reason: skipped.Reason}
+	if skipped.Rule != "" {
+		r.count(skipped.Directory, skipped.Rule, func(totals *ReportTotals) { totals.Skipped++ })
+		if rule := r.rule(skipped.Directory, skipped.Rule); rule != nil {
+			rule.Skipped = append(rule.Skipped, file)
+		}
+		return
+	}
+	r.report.Totals.Skipped++
+	if d := r.directory(skipped.Directory); d != nil {
+		d.Totals.Skipped++
+		d.Skipped = append(d.Skipped, file)
+	}
+}
+
+// ReportFormat returns the format of a report that's written to path, which is told from its extension (.md or
+// .markdown, .html or .htm, and .json). It returns an empty string if the extension isn't one of them.
+func ReportFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		return ReportFormatMarkdown
+	case ".html", ".htm":
+		return ReportFormatHTML
+	case ".json":
+		return ReportFormatJSON
+	}
+	return ""
+}
+
+// Write writes the report to w in the given format (ReportFormatMarkdown, ReportFormatHTML or ReportFormatJSON). The
+// JSON form is indented, and its fields are described by the tags of Report and the types it's made of.
+func (report *Report) Write(w io.Writer, format string) (err error) {
+	switch strings.ToLower(format) {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	case ReportFormatMarkdown:
+		err = markdownReportTemplate.Execute(w, report)
+	case ReportFormatHTML:
+		err = htmlReportTemplate.Execute(w, report)
+	default:
+		return errors.New("unrecognized report format \"" + format + "\"")
+	}
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	return
+}
+
+// WriteFile writes the report to the file at path, in the format told from its extension (see ReportFormat), creating
+// the directories it's in if they don't exist.
+func (report *Report) WriteFile(path string) (err error) {
+	format := ReportFormat(path)
+	if format == "" {
+		return errors.New("can't tell the format of the report '" + path + "' from its extension (use .md, .html or .json)")
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.New(err.Error())
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	err = report.Write(file, format)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = errors.New(closeErr.Error())
+	}
+	return
+}
+
+// FormatBytes formats a number of bytes for people to read, in binary units (e.g. 1.5 MB is 1.5 * 1024 * 1024 bytes).
+func FormatBytes(bytes int64) string {
+	if bytes < 1024 {
+		return strconv.FormatInt(bytes, 10) + " B"
+	}
+	value := float64(bytes)
+	unit := 0
+	for value >= 1024 && unit < 4 {
+		value /= 1024
+		unit++
+	}
+	return strconv.FormatFloat(value, 'f', 1, 64) + " " + []string{"B", "KB", "MB", "GB", "TB"}[unit]
+}
+
+// reportFunctions are the functions that the report templates use.
+var reportFunctions = map[string]interface{}{
+	"bytes": FormatBytes,
+	"time": func(t time.Time) string {
+		return t.Format("2006-01-02 15:04:05 MST")
+	},
+	"seconds": func(seconds float64) string {
+		return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond).String()
+	},
+	"base": filepath.Base,
+	// code quotes text as inline code in Markdown, with a fence long enough for the backticks in it
+	"code": func(text string) string {
+		fence := "`"
+		for strings.Contains(text, fence) {
+			fence += "`"
+		}
+		return fence + " " + text + " " + fence
+	},
+	// cell escapes text for a cell of a Markdown table
+	"cell": func(text string) string {
+		return strings.NewReplacer("|", "\\|", "\n", " ").Replace(text)
+	},
+}
+
+// markdownReportTemplate is the Markdown form of a Report.
+var markdownReportTemplate = template.Must(template.New("report").Funcs(reportFunctions).Parse(`# dirculese run {{.RunID}}
+{{if .DryRun}}
+This was a dry run: the report shows what would have happened, but nothing was moved or deleted.
+{{end}}
+- **Started:** {{time .Started}}
+- **Took:** {{seconds .DurationSeconds}}
+- **Result:** {{.Result}}{{if .Error}} ({{.Error}}){{end}}
+- **Moved:** {{.Totals.Moved}} file(s), {{bytes .Totals.MovedBytes}}
+- **Deleted:** {{.Totals.Deleted}} file(s), {{bytes .Totals.ReclaimedBytes}} reclaimed
+- **Conflicts:** {{.Totals.Conflicts}}
+- **Skipped:** {{.Totals.Skipped}}
+- **Errors:** {{.Totals.Errors}}
+
+| Directory | Matched | Moved | Deleted | Reclaimed | Conflicts | Skipped | Errors |
+| --- | ---: | ---: | ---: | ---: | ---: | ---: | ---: |
+{{range .Directories}}| {{cell .Name}} | {{.Totals.Matched}} | {{.Totals.Moved}} | {{.Totals.Deleted}} | {{bytes .Totals.ReclaimedBytes}} | {{.Totals.Conflicts}} | {{.Totals.Skipped}} | {{.Totals.Errors}} |
+{{end}}{{range .Directories}}
+## {{.Name}}
+
+{{code .Path}}, {{.Entries}} entries
+{{if .Skipped}}
+Skipped:
+{{range .Skipped}}
+- {{code (base .Path)}}: {{.Reason}}{{end}}
+{{end}}
+| Rule | Matched | Moved | Deleted | Reclaimed | Conflicts | Skipped | Errors |
+| --- | ---: | ---: | ---: | ---: | ---: | ---: | ---: |
+{{range .Rules}}| {{cell .Name}} | {{.Totals.Matched}} | {{.Totals.Moved}} | {{.Totals.Deleted}} | {{bytes .Totals.ReclaimedBytes}} | {{.Totals.Conflicts}} | {{.Totals.Skipped}} | {{.Totals.Errors}} |
+{{end}}{{$directory := .Name}}{{range .Rules}}{{if or .Actions .Conflicts .Skipped .Errors}}
+### {{$directory}}/{{.Name}}
+{{range .Errors}}
+- **Error:** {{.}}{{end}}{{range .Actions}}
+- {{if eq .Action "move"}}Moved {{code (base .Source)}} to {{code .Destination}}{{else}}Deleted {{code .Source}}{{end}} ({{bytes .Size}}){{end}}{{range .Conflicts}}
+- {{if .NewName}}Renamed {{code (base .Source)}} to {{code .NewName}}{{else}}Left {{code (base .Source)}} where it was{{end}} because its name was taken in {{code .Destination}}{{end}}{{range .Skipped}}
+- Skipped {{code (base .Path)}}: {{.Reason}}{{end}}
+{{end}}{{end}}{{end}}`))
+
+// htmlReportTemplate is the HTML form of a Report.
+var htmlReportTemplate = htmltemplate.Must(htmltemplate.New("report").Funcs(reportFunctions).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>dirculese run {{.RunID}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 60em; padding: 0 1em; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.7em; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+th { background: #f3f3f3; }
+.note { background: #fff6d5; padding: 0.5em 1em; }
+.error { color: #b00020; }
+code { background: #f3f3f3; padding: 0 0.2em; }
+</style>
+</head>
+<body>
+<h1>dirculese run {{.RunID}}</h1>
+{{if .DryRun}}<p class="note">This was a dry run: the report shows what would have happened, but nothing was moved or deleted.</p>
+{{end}}<p>Started {{time .Started}} and took {{seconds .DurationSeconds}}. The run {{if eq .Result "success"}}finished successfully{{else if eq .Result "interrupted"}}was interrupted{{else}}failed{{end}}{{if .Error}}: <span class="error">{{.Error}}</span>{{end}}.</p>
+<p>{{.Totals.Moved}} file(s) moved ({{bytes .Totals.MovedBytes}}), {{.Totals.Deleted}} deleted ({{bytes .Totals.ReclaimedBytes}} reclaimed), {{.Totals.Conflicts}} conflict(s), {{.Totals.Skipped}} skipped and {{.Totals.Errors}} error(s).</p>
+<table>
+<tr><th>Directory</th><th>Matched</th><th>Moved</th><th>Deleted</th><th>Reclaimed</th><th>Conflicts</th><th>Skipped</th><th>Errors</th></tr>
+{{range .Directories}}<tr><td>{{.Name}}</td><td>{{.Totals.Matched}}</td><td>{{.Totals.Moved}}</td><td>{{.Totals.Deleted}}</td><td>{{bytes .Totals.ReclaimedBytes}}</td><td>{{.Totals.Conflicts}}</td><td>{{.Totals.Skipped}}</td><td>{{.Totals.Errors}}</td></tr>
+{{end}}</table>
+{{range .Directories}}<h2>{{.Name}}</h2>
+<p><code>{{.Path}}</code>, {{.Entries}} entries</p>
+{{if .Skipped}}<p>Skipped:</p>
+<ul>
+{{range .Skipped}}<li><code>{{base .Path}}</code>: {{.Reason}}</li>
+{{end}}</ul>
+{{end}}<table>
+<tr><th>Rule</th><th>Matched</th><th>Moved</th><th>Deleted</th><th>Reclaimed</th><th>Conflicts</th><th>Skipped</th><th>Errors</th></tr>
+{{range .Rules}}<tr><td>{{.Name}}</td><td>{{.Totals.Matched}}</td><td>{{.Totals.Moved}}</td><td>{{.Totals.Deleted}}</td><td>{{bytes .Totals.ReclaimedBytes}}</td><td>{{.Totals.Conflicts}}</td><td>{{.Totals.Skipped}}</td><td>{{.Totals.Errors}}</td></tr>
+{{end}}</table>
+{{$directory := .Name}}{{range .Rules}}{{if or .Actions .Conflicts .Skipped .Errors}}<h3>{{$directory}}/{{.Name}}</h3>
+<ul>
+{{range .Errors}}<li class="error">Error: {{.}}</li>
+{{end}}{{range .Actions}}<li>{{if eq .Action "move"}}Moved <code>{{base .Source}}</code> to <code>{{.Destination}}</code>{{else}}Deleted <code>{{.Source}}</code>{{end}} ({{bytes .Size}})</li>
+{{end}}{{range .Conflicts}}<li>{{if .NewName}}Renamed <code>{{base .Source}}</code> to <code>{{.NewName}}</code>{{else}}Left <code>{{base .Source}}</code> where it was{{end}} because its name was taken in <code>{{.Destination}}</code></li>
+{{end}}{{range .Skipped}}<li>Skipped <code>{{base .Path}}</code>: {{.Reason}}</li>
+{{end}}</ul>
+{{end}}{{end}}{{end}}</body>
+</html>
+`))
@@ -0,0 +1,205 @@
+package dirculese
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runReport runs an engine with a few rules that move, rename, delete, skip and fail, and returns its report.
+func runReport(t *testing.T) *Report {
+	fs := NewMemFS()
+	for _, name := range []string{"/downloads", "/images", "/documents", "/desktop", "/notes"} {
+		fs.MkdirAll(name, 0755)
+	}
+	fs.WriteFile("/downloads/a.png", 100, 0644)
+	fs.WriteFile("/downloads/b.png", 2048, 0644)
+	fs.WriteFile("/downloads/c.txt", 5, 0644)
+	fs.WriteFile("/downloads/d.pdf", 1, 0644)
+	fs.WriteFile("/images/a.png", 1, 0644)
+	fs.WriteFile("/desktop/todo.md", 1, 0644)
+	fs.WriteFile("/desktop/song.mp3", 1, 0644)
+
+	config := DirectoriesConfig{Directories: []DirectoryConfig{
+		{
+			Path: "/downloads",
+			Name: "downloads",
+			Rules: []RuleConfig{
+				{Name: "images", Handler: "ExtensionHandler", Extensions: []string{"png"}, Target: "/images"},
+				{Name: "text", Handler: "ExtensionHandler", Extensions: []string{"txt"}, Delete: true},
+				{Name: "documents", Handler: "ExtensionHandler", Extensions: []string{"pdf"}, Target: "/documents"},
+			},
+		},
+		{
+			Path:       "/desktop",
+			Name:       "desktop",
+			Evaluation: EvaluationFirstMatch,
+			Rules:      []RuleConfig{{Name: "notes", Handler: "ExtensionHandler", Extensions: []string{"md"}, Target: "/notes"}},
+		},
+	}}
+	engine, err := New(config, Options{FS: fs})
+	if err != nil {
+		t.Fatalf("New returned an error. Got '%v'", err)
+	}
+	reporter := NewReporter(engine)
+	if reporter.Report() != nil {
+		t.Error("The reporter has a report before the engine ran")
+	}
+
+	// the documents directory disappears after the configuration was checked, so its rule fails
+	fs.Remove("/documents")
+	if err = engine.Run(context.Background()); err == nil {
+		t.Fatal("Run didn't return the error of the failed rule")
+	}
+	return reporter.Report()
+}
+
+func TestReporter(t *testing.T) {
+	report := runReport(t)
+	if report == nil {
+		t.Fatal("The reporter doesn't have a report after the run")
+	}
+	if report.Version != ReportVersion || report.RunID == "" || report.Result != RunResultFailure || report.Error == "" {
+		t.Errorf("Mismatch in the report's run. Got '%+v'", report)
+	}
+	want := ReportTotals{Matched: 4, Moved: 3, MovedBytes: 2149, Deleted: 1, ReclaimedBytes: 5, Conflicts: 1, Skipped: 1, Errors: 1}
+	if report.Totals != want {
+		t.Errorf("Mismatch in the report's totals. Got '%+v', want '%+v'", report.Totals, want)
+	}
+
+	if len(report.Directories) != 2 || report.Directories[0].Name != "downloads" || len(report.Directories[0].Rules) != 3 {
+		t.Fatalf("Mismatch in the report's directories. Got '%+v'", report.Directories)
+	}
+	images := report.Directories[0].Rules[0]
+	if images.Name != "images" || len(images.Actions) != 2 || images.Actions[0].Destination != "/images/a0.png" || images.Actions[1].Size != 2048 {
+		t.Errorf("Mismatch in the report of the images rule. Got '%+v'", images)
+	}
+	if len(images.Conflicts) != 1 || images.Conflicts[0].NewName != "a0.png" {
+		t.Errorf("Mismatch in the conflicts of the images rule. Got '%+v'", images.Conflicts)
+	}
+	if documents := report.Directories[0].Rules[2]; len(documents.Errors) != 1 || documents.Totals.Errors != 1 {
+		t.Errorf("Mismatch in the errors of the documents rule. Got '%+v'", documents)
+	}
+	if desktop := report.Directories[1]; desktop.Totals.Skipped != 1 || desktop.Totals.Moved != 1 {
+		t.Errorf("Mismatch in the report of the desktop directory. Got '%+v'", desktop)
+	}
+}
+
+func TestReporter_Skipped(t *testing.T) {
+	fs := NewMemFS()
+	fs.MkdirAll("/desktop", 0755)
+	fs.MkdirAll("/notes", 0755)
+	fs.WriteFile("/desktop/todo.md", 1, 0644)
+	fs.WriteFile("/desktop/song.mp3", 1, 0644)
+	config := DirectoriesConfig{Directories: []DirectoryConfig{{
+		Path:       "/desktop",
+		Evaluation: EvaluationFirstMatch,
+		Rules:      []RuleConfig{{Handler: "ExtensionHandler", Extensions: []string{"md"}, Target: "/notes"}},
+	}}}
+	engine, err := New(config, Options{FS: fs, DryRun: true})
+	if err != nil {
+		t.Fatalf("New returned an error. Got '%v'", err)
+	}
+	reporter := NewReporter(engine)
+	if err = engine.Run(context.Background()); err != nil {
+		t.Fatalf("Run returned an error. Got '%v'", err)
+	}
+
+	report := reporter.Report()
+	if !report.DryRun || report.Result != RunResultSuccess || report.Totals.Skipped != 1 || report.Totals.Moved != 1 {
+		t.Errorf("Mismatch in the report of the dry run. Got '%+v'", report)
+	}
+	desktop := report.Directories[0]
+	if desktop.Name != "/desktop" || desktop.Entries != 2 || len(desktop.Skipped) != 1 || desktop.Skipped[0].Path != "/desktop/song.mp3" {
+		t.Errorf("Mismatch in the report of the desktop directory. Got '%+v'", desktop)
+	}
+	if desktop.Skipped[0].Reason != "no rule matched it" || desktop.Rules[0].Name != "rule 1" {
+		t.Errorf("Mismatch in the skipped file or the rule. Got '%+v'", desktop)
+	}
+}
+
+func TestReport_Write(t *testing.T) {
+	report := runReport(t)
+
+	var out bytes.Buffer
+	if err := report.Write(&out, ReportFormatJSON); err != nil {
+		t.Fatalf("Write returned an error for JSON. Got '%v'", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("The JSON report isn't valid JSON. Got '%v'", err)
+	}
+	totals, _ := decoded["totals"].(map[string]interface{})
+	if decoded["version"] != float64(1) || decoded["result"] != "failure" || totals["reclaimed_bytes"] != float64(5) {
+		t.Errorf("Mismatch in the JSON report. Got '%v'", decoded)
+	}
+	// empty lists are written as empty arrays rather than null, so scripts don't have to check for both
+	if !strings.Contains(out.String(), `"skipped": []`) || strings.Contains(out.String(), "null") {
+		t.Errorf("The JSON report has null lists. Got '%v'", out.String())
+	}
+
+	out.Reset()
+	if err := report.Write(&out, ReportFormatMarkdown); err != nil {
+		t.Fatalf("Write returned an error for Markdown. Got '%v'", err)
+	}
+	for _, want := range []string{
+		"# dirculese run " + report.RunID,
+		"| downloads | 3 | 2 | 1 | 5 B | 1 | 0 | 1 |",
+		"### downloads/images",
+		"- Moved ` b.png ` to ` /images/b.png ` (2.0 KB)",
+		"- Renamed ` a.png ` to ` a0.png ` because its name was taken in ` /images `",
+		"- Deleted ` /downloads/c.txt ` (5 B)",
+		"- **Error:** ",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("The Markdown report is missing '%v'. Got '%v'", want, out.String())
+		}
+	}
+
+	out.Reset()
+	report.Directories[0].Rules[0].Actions[0].Destination = "/images/<script>.png"
+	if err := report.Write(&out, ReportFormatHTML); err != nil {
+		t.Fatalf("Write returned an error for HTML. Got '%v'", err)
+	}
+	if !strings.Contains(out.String(), "<td>downloads</td><td>3</td>") || !strings.Contains(out.String(), "&lt;script&gt;") {
+		t.Errorf("Mismatch in the HTML report. Got '%v'", out.String())
+	}
+
+	if err := report.Write(&out, "pdf"); err == nil {
+		t.Error("Write accepted an unrecognized format")
+	}
+}
+
+func TestReport_WriteFile(t *testing.T) {
+	report := runReport(t)
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+
+	path := filepath.Join(tempDirectory, "reports", "run.HTML")
+	if err = report.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile returned an error. Got '%v'", err)
+	}
+	if content, _ := ioutil.ReadFile(path); !strings.HasPrefix(string(content), "<!DOCTYPE html>") {
+		t.Errorf("The report wasn't written as HTML. Got '%v'", string(content))
+	}
+	if err = report.WriteFile(filepath.Join(tempDirectory, "run.txt")); err == nil {
+		t.Error("WriteFile accepted a file whose format can't be told from its extension")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{0: "0 B", 1023: "1023 B", 1024: "1.0 KB", 1536: "1.5 KB", 5 << 20: "5.0 MB", 3 << 40: "3.0 TB"}
+	for bytes, want := range tests {
+		if got := FormatBytes(bytes); got != want {
+			t.Errorf("Mismatch in the formatted size of %v bytes. Got '%v', want '%v'", bytes, got, want)
+		}
+	}
+}
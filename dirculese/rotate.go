@@ -0,0 +1,271 @@
+package dirculese
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the time format in the names of rotated log files (see RotatingFile.parseBackup).
+const backupTimeFormat = "20060102T150405.000"
+
+// Rotation is when a RotatingFile is rotated and how many of its old files are kept. Rotation.MaxSize is the size in
+// bytes the file can grow to, and Rotation.Interval is how often it's rotated regardless of its size: the file is
+// rotated when a write would happen in a later interval than the file's last write, counting from midnight UTC (so an
+// interval of 24 hours rotates it every day at midnight UTC). Either of them can be zero, in which case it doesn't
+// apply. Rotated files are compressed with gzip if Rotation.Compress is set, and the oldest of them are removed once
+// there are more than Rotation.MaxBackups of them or they're older than Rotation.MaxBackupAge (zero or less keeps
+// them).
+type Rotation struct {
+	MaxSize      int64
+	Interval     time.Duration
+	MaxBackups   int
+	MaxBackupAge time.Duration
+	Compress     bool
+}
+
+// RotatingFile is an io.WriteCloser that appends to a log file and rotates it according to a Rotation: the file is
+// renamed to a backup named after the time it was rotated (dirculese.log becomes dirculese-20200517T093000.000.log, or
+// dirculese-20200517T093000.000.log.gz if it's compressed) and a new file is started. A write is never split across two
+// files. It's safe to use from several goroutines at once.
+type RotatingFile struct {
+	mutex     sync.Mutex
+	path      string
+	rotation  Rotation
+	file      *os.File
+	size      int64
+	lastWrite time.Time
+	now       func() time.Time
+}
+
+// OpenRotatingFile opens the log file at path for appending, creating it and the directories it's in if they don't
+// exist, and rotates it according to rotation from then on.
+func OpenRotatingFile(path string, rotation Rotation) (rotatingFile *RotatingFile, err error) {
+	rotatingFile = &RotatingFile{path: path, rotation: rotation, now: time.Now}
+	if err = rotatingFile.open(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// open opens the log file for appending, picking up its size and the time it was last written to.
+func (f *RotatingFile) open() (err error) {
+	err = os.MkdirAll(filepath.Dir(f.path), 0755)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	f.file, err = os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	info, err := f.file.Stat()
+	if err != nil {
+		f.file.Close()
+		f.file = nil
+		return errors.New(err.Error())
+	}
+	f.size = info.Size()
+	f.lastWrite = info.ModTime()
+	return
+}
+
+// Write appends p to the log file, rotating it first if p wouldn't fit in it or belongs to a later interval (see
+// Rotation).
+func (f *RotatingFile) Write(p []byte) (n int, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.file == nil {
+		return 0, errors.New("the log file " + f.path + " is closed")
+	}
+	now := f.now()
+	if f.due(now, int64(len(p))) {
+		// a backup that couldn't be compressed or removed doesn't stop the write, as long as there's a file to write to
+		if rotateErr := f.rotate(now); f.file == nil {
+			return 0, rotateErr
+		}
+	}
+	n, err = f.file.Write(p)
+	f.size += int64(n)
+	f.lastWrite = now
+	return
+}
+
+// due reports whether the log file has to be rotated before size more bytes are written to it at the time now. Empty
+// files are never rotated.
+func (f *RotatingFile) due(now time.Time, size int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.rotation.MaxSize > 0 && f.size+size > f.rotation.MaxSize {
+		return true
+	}
+	interval := f.rotation.Interval
+	return interval > 0 && now.UTC().Truncate(interval).After(f.lastWrite.UTC().Truncate(interval))
+}
+
+// rotate renames the log file to a backup, opens a new log file, compresses the backup if the rotation says so and
+// removes the backups that aren't kept anymore.
+func (f *RotatingFile) rotate(now time.Time) (err error) {
+	if err = f.file.Close(); err != nil {
+		return errors.New(err.Error())
+	}
+	f.file = nil
+
+	// backups that are rotated at the same time are numbered after the newest of them, even if older ones were pruned
+	extension := filepath.Ext(f.path)
+	stamp := now.UTC().Format(backupTimeFormat)
+	next := 0
+	backups, _ := f.Backups()
+	for _, existing := range backups {
+		if rotated, index, _ := f.parseBackup(filepath.Base(existing)); rotated.Format(backupTimeFormat) == stamp && index >= next {
+			next = index + 1
+		}
+	}
+	backup := strings.TrimSuffix(f.path, extension) + "-" + stamp + extension
+	if next > 0 {
+		backup = strings.TrimSuffix(f.path, extension) + "-" + stamp + "." + strconv.Itoa(next) + extension
+	}
+	if err = os.Rename(f.path, backup); err != nil {
+		f.open()
+		return errors.New(err.Error())
+	}
+	if err = f.open(); err != nil {
+		return
+	}
+
+	// the new file is already open, so problems with the backups don't stop the log
+	if f.rotation.Compress {
+		if err = compressFile(backup); err != nil {
+			return errors.New(err.Error())
+		}
+	}
+	if err = f.prune(now); err != nil {
+		return errors.New(err.Error())
+	}
+	return
+}
+
+// prune removes the oldest backups of the log file once there are more than Rotation.MaxBackups of them, and the ones
+// that were rotated longer than Rotation.MaxBackupAge before now.
+func (f *RotatingFile) prune(now time.Time) (err error) {
+	backups, err := f.Backups()
+	if err != nil {
+		return
+	}
+	for i, backup := range backups {
+		expired := false
+		if f.rotation.MaxBackupAge > 0 {
+			rotated, _, _ := f.parseBackup(filepath.Base(backup))
+			expired = now.Sub(rotated) > f.rotation.MaxBackupAge
+		}
+		if (f.rotation.MaxBackups > 0 && i < len(backups)-f.rotation.MaxBackups) || expired {
+			if err = os.Remove(backup); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Backups returns the paths of the rotated backups of the log file, from the oldest to the newest. Backups are ordered
+// by the time in their names, and backups that were rotated at the same time by the number that was added to the names
+// of the later ones (see RotatingFile.rotate).
+func (f *RotatingFile) Backups() (backups []string, err error) {
+	files, err := ReadDirectory(filepath.Dir(f.path))
+	if err != nil {
+		return nil, errors.New(err.Error())
+	}
+	type backup struct {
+		path    string
+		rotated time.Time
+		index   int
+	}
+	var found []backup
+	for _, file := range files {
+		if rotated, index, ok := f.parseBackup(file.Name()); ok && file.Mode().IsRegular() {
+			found = append(found, backup{path: filepath.Join(filepath.Dir(f.path), file.Name()), rotated: rotated, index: index})
+		}
+	}
+	sort.Slice(found, func(i int, j int) bool {
+		if !found[i].rotated.Equal(found[j].rotated) {
+			return found[i].rotated.Before(found[j].rotated)
+		}
+		return found[i].index < found[j].index
+	})
+	for _, b := range found {
+		backups = append(backups, b.path)
+	}
+	return
+}
+
+// parseBackup reports whether the file called name is a backup of the log file, and if it is, when it was rotated and
+// the number that was added to its name because another backup was rotated at the same time (0 if there isn't one).
+// Names look like dirculese-20200517T093000.000.log or dirculese-20200517T093000.000.1.log, optionally with .gz.
+func (f *RotatingFile) parseBackup(name string) (rotated time.Time, index int, ok bool) {
+	extension := filepath.Ext(f.path)
+	prefix := filepath.Base(strings.TrimSuffix(f.path, extension)) + "-"
+	name = strings.TrimSuffix(name, ".gz")
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, extension) {
+		return
+	}
+	stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), extension)
+	if len(stamp) < len(backupTimeFormat) {
+		return
+	}
+	rotated, err := time.Parse(backupTimeFormat, stamp[:len(backupTimeFormat)])
+	if err != nil {
+		return
+	}
+	if suffix := stamp[len(backupTimeFormat):]; suffix != "" {
+		index, err = strconv.Atoi(strings.TrimPrefix(suffix, "."))
+		if err != nil || !strings.HasPrefix(suffix, ".") || index < 1 {
+			return time.Time{}, 0, false
+		}
+	}
+	return rotated, index, true
+}
+
+// Close closes the log file.
+func (f *RotatingFile) Close() (err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.file == nil {
+		return
+	}
+	err = f.file.Close()
+	f.file = nil
+	return
+}
+
+// compressFile compresses the file at path into path.gz with gzip and removes the original.
+func compressFile(path string) (err error) {
+	source, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer source.Close()
+	destination, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return
+	}
+	writer := gzip.NewWriter(destination)
+	if _, err = io.Copy(writer, source); err == nil {
+		err = writer.Close()
+	}
+	if closeErr := destination.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return
+	}
+	source.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,161 @@
+package dirculese
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+	path := filepath.Join(tempDirectory, "logs", "dirculese.log")
+
+	file, err := OpenRotatingFile(path, Rotation{MaxSize: 10, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatalf("OpenRotatingFile returned an error. Got '%v'", err)
+	}
+	defer file.Close()
+	clock := time.Date(2020, 5, 17, 9, 30, 0, 0, time.UTC)
+	file.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	// every line but the first one makes the file bigger than 10 bytes, so it's rotated before each of them
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err = file.Write([]byte(line)); err != nil {
+			t.Fatalf("Write returned an error. Got '%v'", err)
+		}
+	}
+	if content, _ := ioutil.ReadFile(path); string(content) != "fourth\n" {
+		t.Errorf("Mismatch in the content of the log file. Got '%v', want 'fourth\\n'", string(content))
+	}
+
+	// only the two newest backups are kept, and they're compressed
+	backups, err := file.Backups()
+	if err != nil {
+		t.Fatalf("Backups returned an error. Got '%v'", err)
+	}
+	want := []string{"dirculese-20200517T093003.000.log.gz", "dirculese-20200517T093004.000.log.gz"}
+	var got []string
+	for _, backup := range backups {
+		got = append(got, filepath.Base(backup))
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("Mismatch in the backups. Got '%v', want '%v'", got, want)
+	}
+	compressed, err := os.Open(backups[1])
+	if err != nil {
+		t.Fatalf("Couldn't open the newest backup. Got '%v'", err)
+	}
+	defer compressed.Close()
+	reader, err := gzip.NewReader(compressed)
+	if err != nil {
+		t.Fatalf("The newest backup isn't compressed. Got '%v'", err)
+	}
+	if content, _ := ioutil.ReadAll(reader); string(content) != "third\n" {
+		t.Errorf("Mismatch in the content of the newest backup. Got '%v', want 'third\\n'", string(content))
+	}
+}
+
+func TestRotatingFile_Backups(t *testing.T) {
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+	path := filepath.Join(tempDirectory, "dirculese.log")
+
+	file, err := OpenRotatingFile(path, Rotation{MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("OpenRotatingFile returned an error. Got '%v'", err)
+	}
+	defer file.Close()
+	// every backup is rotated at the same time, so they're told apart by the numbers added to their names
+	file.now = func() time.Time {
+		return time.Date(2020, 5, 17, 9, 30, 0, 0, time.UTC)
+	}
+	for i := 0; i < 12; i++ {
+		if _, err = file.Write([]byte(fmt.Sprintf("line %02d\n", i))); err != nil {
+			t.Fatalf("Write returned an error. Got '%v'", err)
+		}
+	}
+
+	// the numbers are compared as numbers, so the newest backups are the ones that are kept
+	backups, err := file.Backups()
+	if err != nil {
+		t.Fatalf("Backups returned an error. Got '%v'", err)
+	}
+	want := []string{"dirculese-20200517T093000.000.9.log", "dirculese-20200517T093000.000.10.log"}
+	var got []string
+	for _, backup := range backups {
+		got = append(got, filepath.Base(backup))
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("Mismatch in the backups. Got '%v', want '%v'", got, want)
+	}
+	if content, _ := ioutil.ReadFile(backups[1]); string(content) != "line 10\n" {
+		t.Errorf("Mismatch in the content of the newest backup. Got '%v', want 'line 10\\n'", string(content))
+	}
+
+	// a negative MaxBackups keeps all of them
+	file.rotation.MaxBackups = -1
+	for i := 12; i < 16; i++ {
+		if _, err = file.Write([]byte(fmt.Sprintf("line %02d\n", i))); err != nil {
+			t.Fatalf("Write returned an error. Got '%v'", err)
+		}
+	}
+	if backups, _ = file.Backups(); len(backups) != 6 {
+		t.Errorf("Mismatch in the number of backups. Got '%v', want 6", len(backups))
+	}
+}
+
+func TestRotatingFile_Interval(t *testing.T) {
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+	path := filepath.Join(tempDirectory, "dirculese.log")
+
+	// a backup from a week ago is removed once the file is rotated, because backups are only kept for three days
+	old := filepath.Join(tempDirectory, "dirculese-20200510T000000.000.log")
+	ioutil.WriteFile(old, []byte("old\n"), 0644)
+
+	file, err := OpenRotatingFile(path, Rotation{Interval: 24 * time.Hour, MaxBackupAge: 3 * 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("OpenRotatingFile returned an error. Got '%v'", err)
+	}
+	defer file.Close()
+	clock := time.Date(2020, 5, 17, 23, 0, 0, 0, time.UTC)
+	file.now = func() time.Time { return clock }
+
+	file.Write([]byte("evening\n"))
+	clock = clock.Add(30 * time.Minute)
+	file.Write([]byte("late evening\n"))
+	if backups, _ := file.Backups(); len(backups) != 1 || backups[0] != old {
+		t.Errorf("The file was rotated before the day was over. Got '%v'", backups)
+	}
+
+	clock = clock.Add(time.Hour)
+	file.Write([]byte("morning\n"))
+	backups, _ := file.Backups()
+	if len(backups) != 1 || filepath.Base(backups[0]) != "dirculese-20200518T003000.000.log" {
+		t.Fatalf("Mismatch in the backups after midnight. Got '%v'", backups)
+	}
+	if content, _ := ioutil.ReadFile(backups[0]); string(content) != "evening\nlate evening\n" {
+		t.Errorf("Mismatch in the content of the backup. Got '%v'", string(content))
+	}
+	if content, _ := ioutil.ReadFile(path); string(content) != "morning\n" {
+		t.Errorf("Mismatch in the content of the log file. Got '%v'", string(content))
+	}
+}
@@ -0,0 +1,54 @@
+package dirculese
+
+import (
+	"errors"
+	"os"
+)
+
+// ReadDirectory returns the metadata of every entry in the directory at path, in the order the filesystem lists them
+// (unlike ioutil.ReadDir, it doesn't sort them, which is left to callers that need an order, like Directory.Contents).
+// Entries that disappear between being listed and being stat'ed are left out.
+func ReadDirectory(path string) (files []os.FileInfo, err error) {
+	directory, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New(err.Error())
+	}
+	defer directory.Close()
+
+	entries, err := directory.ReadDir(-1)
+	if err != nil {
+		return nil, errors.New(err.Error())
+	}
+	files = make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, infoErr := entry.Info()
+		if infoErr != nil {
+			continue
+		}
+		files = append(files, info)
+	}
+	return files, nil
+}
+
+// consume checks whether the item called name is still in the directory after a rule has handled it, and if it isn't
+// (because it was moved or deleted), leaves it out of the d.entries that Directory.Contents returns for the rest of the
+// run. It reports whether the item was consumed.
+func (d *Directory) consume(name string) (consumed bool) {
+	if d.consumed[name] {
+		return true
+	}
+	if _, err := d.options.fileSystem().Lstat(d.path + string(os.PathSeparator) + name); os.IsNotExist(err) {
+		d.markConsumed(name)
+		return true
+	}
+	return false
+}
+
+// markConsumed leaves the item called name out of the d.entries that Directory.Contents returns for the rest of the
+// run.
+func (d *Directory) markConsumed(name string) {
+	if d.consumed == nil {
+		d.consumed = make(map[string]bool)
+	}
+	d.consumed[name] = true
+}
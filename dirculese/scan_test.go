@@ -0,0 +1,94 @@
+package dirculese
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestReadDirectory(t *testing.T) {
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+	want := []string{"a.txt", "b.txt", "c.txt", "d", "e.txt"}
+	for _, name := range want {
+		ioutil.WriteFile(filepath.Join(tempDirectory, name), []byte{}, 0644)
+	}
+
+	files, err := ReadDirectory(tempDirectory)
+	if err != nil {
+		t.Fatalf("ReadDirectory returned an error. Got '%v'", err)
+	}
+	var got []string
+	for _, f := range files {
+		got = append(got, f.Name())
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Mismatch in entries. Got '%v', want '%v'", got, want)
+	}
+
+	if _, err = ReadDirectory(filepath.Join(tempDirectory, "PATH-DOES-NOT-EXIST")); err == nil {
+		t.Error("ReadDirectory didn't return an error for a directory that doesn't exist")
+	}
+}
+
+func TestDirectory_Contents_Snapshot(t *testing.T) {
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	defer os.RemoveAll(tempDirectory)
+	for _, name := range []string{"a.png", "b.png", "c.txt"} {
+		ioutil.WriteFile(filepath.Join(tempDirectory, name), []byte{}, 0644)
+	}
+	os.Mkdir(filepath.Join(tempDirectory, "images"), 0755)
+
+	testDirectory := Directory{path: tempDirectory}
+	names := func() string {
+		files, contentsErr := testDirectory.Contents(context.Background())
+		if contentsErr != nil {
+			t.Fatalf("Contents returned an error. Got '%v'", contentsErr)
+		}
+		var got []string
+		for _, f := range files {
+			got = append(got, f.Name())
+		}
+		return strings.Join(got, ",")
+	}
+
+	// the directory is only read once, so files added later aren't seen until the next run
+	if got := names(); got != "a.png,b.png,c.txt,images" {
+		t.Errorf("Mismatch in contents. Got '%v'", got)
+	}
+	ioutil.WriteFile(filepath.Join(tempDirectory, "d.png"), []byte{}, 0644)
+	os.Rename(filepath.Join(tempDirectory, "a.png"), filepath.Join(tempDirectory, "images", "a.png"))
+	if !testDirectory.consume("a.png") || testDirectory.consume("b.png") {
+		t.Error("Mismatch in consumed files")
+	}
+	if got := names(); got != "b.png,c.txt,images" {
+		t.Errorf("Mismatch in contents after consuming a file. Got '%v'", got)
+	}
+
+	// every rule of a run shares the same snapshot, and each run starts with a new one
+	testDirectory.rules = []Rule{
+		{source: &testDirectory, target: &Directory{path: filepath.Join(tempDirectory, "images")}, handler: "ExtensionHandler", extensions: []string{"png"}},
+		{source: &testDirectory, target: &Directory{path: filepath.Join(tempDirectory, "images")}, handler: "ExtensionHandler", extensions: []string{"txt", "png"}},
+	}
+	if err = testDirectory.Ruler(context.Background()); err != nil {
+		t.Fatalf("Ruler returned an error. Got '%v'", err)
+	}
+	if got := names(); got != "images" {
+		t.Errorf("Mismatch in contents after a run. Got '%v'", got)
+	}
+	moved, _ := ioutil.ReadDir(filepath.Join(tempDirectory, "images"))
+	if len(moved) != 4 {
+		t.Errorf("Mismatch in moved files. Got '%v', want 4", len(moved))
+	}
+}
@@ -0,0 +1,174 @@
+package dirculese
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultPartialPatterns are the file name patterns that browsers and download managers use for files that are still
+// being downloaded. Files matching these patterns are never touched, and neither are files that have a sibling matching
+// one of them (e.g. movie.mkv while movie.mkv.part exists).
+var DefaultPartialPatterns = []string{
+	"*.crdownload",
+	"*.part",
+	"*.partial",
+	"*.download",
+	"*.opdownload",
+	"*.aria2",
+	"*.!ut",
+	"*.!qB",
+	".~lock.*#",
+}
+
+// Stability decides whether the files in a managed directory are ready to be organized. Files matching one of
+// DefaultPartialPatterns or Stability.partialPatterns are always skipped. If Stability.settleTime is set, a file's size
+// and modification time must stay the same for that long before it is handled, and if Stability.skipOpen is set, files
+// that are held open by any process are skipped too.
+type Stability struct {
+	partialPatterns []string
+	settleTime      time.Duration
+	skipOpen        bool
+}
+
+// GetStability creates a Stability based on the contents of a StabilityConfig struct.
+func GetStability(config StabilityConfig) Stability {
+	return Stability{
+		partialPatterns: config.PartialPatterns,
+		settleTime:      time.Duration(config.SettleTime) * time.Second,
+		skipOpen:        config.SkipOpen,
+	}
+}
+
+// Unstable returns the names of all the files in the directory at path that aren't ready to be organized yet, along
+// with the reason each of them should be skipped. If ctx is done before the files have settled, every file that was
+// modified recently is considered unstable.
+func (s *Stability) Unstable(ctx context.Context, path string) (unstable map[string]string, err error) {
+	files, err := ReadDirectory(path)
+	if err != nil {
+		return nil, errors.New(err.Error())
+	}
+	return s.unstableFiles(ctx, OSFS{}, path, files, time.Now()), nil
+}
+
+// unstableFiles returns the names of the files that aren't ready to be organized yet, along with the reason each of
+// them should be skipped, from files that were already read from the directory at path. now is the current time, which
+// decides which files were modified recently.
+func (s *Stability) unstableFiles(ctx context.Context, fs FS, path string, files []os.FileInfo, now time.Time) (unstable map[string]string) {
+	unstable = make(map[string]string)
+
+	skip := func(name string, reason string) {
+		if _, skipped := unstable[name]; !skipped {
+			unstable[name] = reason
+		}
+	}
+
+	patterns := append(append([]string{}, DefaultPartialPatterns...), s.partialPatterns...)
+	names := make(map[string]bool)
+	for _, f := range files {
+		names[f.Name()] = true
+	}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		for _, pattern := range patterns {
+			if matched, _ := filepath.Match(pattern, f.Name()); matched {
+				skip(f.Name(), "it looks like a partial download")
+				break
+			}
+			// patterns like *.part also tell us that the file without the extension is still being written
+			if strings.HasPrefix(pattern, "*.") && names[f.Name()+pattern[1:]] {
+				skip(f.Name(), "it is still being downloaded to "+f.Name()+pattern[1:])
+				break
+			}
+		}
+	}
+
+	if s.skipOpen {
+		for name := range OpenFiles(path) {
+			skip(name, "it is open in another process")
+		}
+	}
+
+	if s.settleTime > 0 {
+		for _, name := range s.unsettled(ctx, fs, path, files, now) {
+			skip(name, "it changed in the last "+s.settleTime.String())
+		}
+	}
+	return
+}
+
+// unsettled returns the names of files whose size or modification time changed within the settle time. Files that were
+// last modified longer ago than the settle time are already considered settled, so the check only waits if there is at
+// least one recently modified file, and it stops waiting if ctx is done (every recently modified file is unsettled
+// then).
+func (s *Stability) unsettled(ctx context.Context, fs FS, path string, files []os.FileInfo, now time.Time) (names []string) {
+	recent := make(map[string]os.FileInfo)
+	for _, f := range files {
+		if !f.IsDir() && now.Sub(f.ModTime()) < s.settleTime {
+			recent[f.Name()] = f
+		}
+	}
+	if len(recent) == 0 {
+		return
+	}
+
+	select {
+	case <-time.After(s.settleTime):
+	case <-ctx.Done():
+		for name := range recent {
+			names = append(names, name)
+		}
+		return
+	}
+
+	for name, before := range recent {
+		after, err := fs.Lstat(path + string(os.PathSeparator) + name)
+		if err != nil || after.Size() != before.Size() || !after.ModTime().Equal(before.ModTime()) {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// OpenFiles returns the names of the files directly inside the directory at path that are held open by any process. It
+// works by scanning the file descriptors listed in /proc/*/fd, so it only finds something on systems that have a
+// Linux-style /proc and only for processes the current user is allowed to inspect. The file descriptors always point to
+// fully resolved paths, so any symlinks in path are resolved before they're compared.
+func OpenFiles(path string) (names map[string]bool) {
+	names = make(map[string]bool)
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return
+	}
+	processes, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return
+	}
+	for _, process := range processes {
+		if strings.Trim(process.Name(), "0123456789") != "" {
+			continue
+		}
+		fdPath := "/proc/" + process.Name() + "/fd"
+		descriptors, err := ioutil.ReadDir(fdPath)
+		if err != nil {
+			continue
+		}
+		for _, descriptor := range descriptors {
+			target, err := os.Readlink(fdPath + "/" + descriptor.Name())
+			if err == nil && filepath.Dir(target) == path {
+				names[filepath.Base(target)] = true
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,122 @@
+package dirculese
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetStability(t *testing.T) {
+	got := GetStability(StabilityConfig{PartialPatterns: []string{"*.tmp"}, SettleTime: 3, SkipOpen: true})
+	if got.partialPatterns[0] != "*.tmp" {
+		t.Errorf("Mismatch in partialPatterns[0]. Got '%v', want '%v'", got.partialPatterns[0], "*.tmp")
+	}
+	if got.settleTime != 3*time.Second {
+		t.Errorf("Mismatch in settleTime. Got '%v', want '%v'", got.settleTime, 3*time.Second)
+	}
+	if !got.skipOpen {
+		t.Errorf("Mismatch in skipOpen. Got '%v', want '%v'", got.skipOpen, true)
+	}
+}
+
+func TestStability_Unstable(t *testing.T) {
+	// get path to the directory the test is running in
+	_, dir, _, _ := runtime.Caller(0)
+	dir = filepath.FromSlash(strings.TrimRight(dir, "stability_tes.go"))
+
+	// create mock files inside the testdata directory, backdating the ones that should be considered settled
+	mockFiles := []string{"movie.mkv", "movie.mkv.part", "setup.exe.crdownload", "notes.tmp", "old.txt", "growing.txt"}
+	for _, mockFile := range mockFiles {
+		f, err := os.OpenFile(dir+"testdata"+string(os.PathSeparator)+mockFile, os.O_RDONLY|os.O_CREATE, 0777)
+		if err != nil {
+			t.Error("Error while creating mock files for this test: " + err.Error())
+		} else {
+			f.Close()
+		}
+		if mockFile != "growing.txt" {
+			old := time.Now().Add(-time.Hour)
+			os.Chtimes(dir+"testdata"+string(os.PathSeparator)+mockFile, old, old)
+		}
+	}
+	defer func() {
+		for _, mockFile := range mockFiles {
+			os.Remove(dir + "testdata" + string(os.PathSeparator) + mockFile)
+		}
+	}()
+
+	// keep writing to growing.txt while the settle check is waiting
+	done := make(chan bool)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		f, err := os.OpenFile(dir+"testdata"+string(os.PathSeparator)+"growing.txt", os.O_WRONLY|os.O_APPEND, 0777)
+		if err == nil {
+			f.WriteString("more data")
+			f.Close()
+		}
+		done <- true
+	}()
+
+	stability := Stability{partialPatterns: []string{"*.tmp"}, settleTime: 300 * time.Millisecond}
+	got, err := stability.Unstable(context.Background(), dir+"testdata")
+	<-done
+	if err != nil {
+		t.Errorf("Unstable returned an error. Got '%v'", err)
+	}
+
+	want := map[string]bool{
+		"movie.mkv":            true,
+		"movie.mkv.part":       true,
+		"setup.exe.crdownload": true,
+		"notes.tmp":            true,
+		"growing.txt":          true,
+		"old.txt":              false,
+		"dirculese.test.json":  false,
+	}
+	for name, unstable := range want {
+		if reason, skipped := got[name]; skipped != unstable {
+			t.Errorf("Wrong stability for %v. Got '%v' (%v), want '%v'", name, skipped, reason, unstable)
+		}
+	}
+	if got["movie.mkv"] != "it is still being downloaded to movie.mkv.part" {
+		t.Errorf("Wrong reason for movie.mkv. Got '%v'", got["movie.mkv"])
+	}
+}
+
+func TestOpenFiles(t *testing.T) {
+	if _, err := os.Stat("/proc/self/fd"); err != nil {
+		t.Skip("this test needs a Linux-style /proc")
+	}
+
+	// get path to the directory the test is running in
+	_, dir, _, _ := runtime.Caller(0)
+	dir = filepath.FromSlash(strings.TrimRight(dir, "stability_tes.go"))
+
+	f, err := os.OpenFile(dir+"testdata"+string(os.PathSeparator)+"open.txt", os.O_RDONLY|os.O_CREATE, 0777)
+	if err != nil {
+		t.Fatal("Error while creating mock files for this test: " + err.Error())
+	}
+	defer os.Remove(dir + "testdata" + string(os.PathSeparator) + "open.txt")
+
+	if got := OpenFiles(dir + "testdata"); !got["open.txt"] {
+		t.Errorf("Open file wasn't found. Got '%v'", got)
+	}
+
+	// the directory may be reached through a symlink, like a symlinked ~/Downloads
+	link := dir + "testdata" + string(os.PathSeparator) + "open-link"
+	if err = os.Symlink(dir+"testdata", link); err != nil {
+		t.Fatal("Error while creating mock files for this test: " + err.Error())
+	}
+	defer os.Remove(link)
+	if got := OpenFiles(link); !got["open.txt"] {
+		t.Errorf("Open file wasn't found through a symlinked directory. Got '%v'", got)
+	}
+
+	f.Close()
+	if got := OpenFiles(dir + "testdata"); got["open.txt"] {
+		t.Errorf("Closed file was still reported as open. Got '%v'", got)
+	}
+}
@@ -0,0 +1,94 @@
+package dirculese
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// SymlinksSkip, SymlinksMove, SymlinksFollow and SymlinksClean are the policies a rule can have for symlinks that it
+// matches. By default symlinks are skipped, but they can also be handled like files (moving the link itself), resolved
+// so that the rule acts on the file they point to, or deleted if they're broken.
+const (
+	SymlinksSkip   = "Skip"
+	SymlinksMove   = "Move"
+	SymlinksFollow = "Follow"
+	SymlinksClean  = "Clean"
+)
+
+// IsBrokenSymlink reports whether the file at path is a symlink that points to something which doesn't exist.
+func IsBrokenSymlink(path string) bool {
+	return isBrokenSymlink(OSFS{}, path)
+}
+
+// isBrokenSymlink is IsBrokenSymlink on the filesystem fs.
+func isBrokenSymlink(fs FS, path string) bool {
+	linkInfo, err := fs.Lstat(path)
+	if err != nil || linkInfo.Mode()&os.ModeSymlink == 0 {
+		return false
+	}
+	_, err = fs.Stat(path)
+	return os.IsNotExist(err)
+}
+
+// FollowSymlink resolves the symlink at path (and any further symlinks along the way) and returns the full path and
+// file info of the file it points to.
+func FollowSymlink(path string) (targetPath string, target os.FileInfo, err error) {
+	return followSymlink(OSFS{}, path)
+}
+
+// followSymlink is FollowSymlink on the filesystem fs.
+func followSymlink(fs FS, path string) (targetPath string, target os.FileInfo, err error) {
+	targetPath, err = fs.EvalSymlinks(path)
+	if err != nil {
+		return "", nil, errors.New(err.Error())
+	}
+	targetPath, err = filepath.Abs(targetPath)
+	if err != nil {
+		return "", nil, errors.New(err.Error())
+	}
+	target, err = fs.Stat(targetPath)
+	if err != nil {
+		return "", nil, errors.New(err.Error())
+	}
+	return
+}
+
+// Relink updates the symlink at path, which was just moved out of the directory previousDirectory, so that it points to
+// the same place it did before. Absolute symlinks don't need to change, but relative ones are rewritten relative to
+// their new directory.
+func Relink(path string, previousDirectory string) (err error) {
+	return relink(OSFS{}, path, previousDirectory)
+}
+
+// relink is Relink on the filesystem fs.
+func relink(fs FS, path string, previousDirectory string) (err error) {
+	target, err := fs.Readlink(path)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	if filepath.IsAbs(target) || filepath.Dir(path) == previousDirectory {
+		return
+	}
+	directory, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	absoluteTarget, err := filepath.Abs(filepath.Join(previousDirectory, target))
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	newTarget, err := filepath.Rel(directory, absoluteTarget)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	err = fs.Remove(path)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	err = fs.Symlink(newTarget, path)
+	if err != nil {
+		return errors.New(err.Error())
+	}
+	return
+}
@@ -0,0 +1,181 @@
+package dirculese
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// createSymlinkFixtures creates a testdata/links directory with a real file in testdata/links/real, a relative symlink
+// to it, an absolute symlink to it and a broken symlink, and returns the path of the links directory.
+func createSymlinkFixtures(t *testing.T, dir string) string {
+	links := dir + "testdata" + string(os.PathSeparator) + "links"
+	os.RemoveAll(links)
+	os.MkdirAll(links+string(os.PathSeparator)+"real", 0777)
+	os.MkdirAll(links+string(os.PathSeparator)+"target", 0777)
+	err := ioutil.WriteFile(links+string(os.PathSeparator)+"real"+string(os.PathSeparator)+"file.txt", []byte("data"), 0666)
+	if err != nil {
+		t.Fatal("Error while creating mock files for this test: " + err.Error())
+	}
+	os.Symlink("real"+string(os.PathSeparator)+"file.txt", links+string(os.PathSeparator)+"relative.txt")
+	os.Symlink(links+string(os.PathSeparator)+"real"+string(os.PathSeparator)+"file.txt", links+string(os.PathSeparator)+"absolute.txt")
+	os.Symlink("real"+string(os.PathSeparator)+"missing.txt", links+string(os.PathSeparator)+"broken.txt")
+	return links
+}
+
+func TestIsBrokenSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("this test needs symlinks")
+	}
+	_, dir, _, _ := runtime.Caller(0)
+	dir = filepath.FromSlash(strings.TrimRight(dir, "symlink_tes.go"))
+	links := createSymlinkFixtures(t, dir)
+	defer os.RemoveAll(links)
+
+	want := map[string]bool{
+		"relative.txt":  false,
+		"absolute.txt":  false,
+		"broken.txt":    true,
+		"real/file.txt": false,
+		"missing.txt":   false,
+	}
+	for name, broken := range want {
+		if got := IsBrokenSymlink(links + string(os.PathSeparator) + filepath.FromSlash(name)); got != broken {
+			t.Errorf("Wrong result for %v. Got '%v', want '%v'", name, got, broken)
+		}
+	}
+}
+
+func TestRule_Symlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("this test needs symlinks")
+	}
+	_, dir, _, _ := runtime.Caller(0)
+	dir = filepath.FromSlash(strings.TrimRight(dir, "symlink_tes.go"))
+
+	type symlinkTest struct {
+		policy string
+		want   string
+	}
+	symlinkTestTable := []symlinkTest{
+		{policy: "", want: "absolute.txt,broken.txt,relative.txt|"},
+		{policy: SymlinksSkip, want: "absolute.txt,broken.txt,relative.txt|"},
+		{policy: SymlinksMove, want: "|absolute.txt,broken.txt,relative.txt"},
+		{policy: SymlinksClean, want: "absolute.txt,relative.txt|"},
+		// both working links point to the same file, so once it has been moved the second link is broken and skipped
+		{policy: SymlinksFollow, want: "broken.txt,relative.txt|file.txt"},
+	}
+	for _, s := range symlinkTestTable {
+		links := createSymlinkFixtures(t, dir)
+		testDirectory := Directory{path: links}
+		testDirectory.rules = []Rule{{
+			source:     &testDirectory,
+			target:     &Directory{path: links + string(os.PathSeparator) + "target"},
+			handler:    "ExtensionHandler",
+			extensions: []string{"txt"},
+			symlinks:   s.policy,
+		}}
+		if err := testDirectory.Ruler(context.Background()); err != nil {
+			t.Errorf("Ruler returned an error for the policy '%v'. Got '%v'", s.policy, err)
+		}
+
+		var got []string
+		for _, d := range []string{links, links + string(os.PathSeparator) + "target"} {
+			var names []string
+			fileInfos, _ := ioutil.ReadDir(d)
+			for _, fileInfo := range fileInfos {
+				if !fileInfo.IsDir() {
+					names = append(names, fileInfo.Name())
+				}
+			}
+			got = append(got, strings.Join(names, ","))
+		}
+		if strings.Join(got, "|") != s.want {
+			t.Errorf("Incorrect filelist for the policy '%v'. Got '%v', want '%v'", s.policy, strings.Join(got, "|"), s.want)
+		}
+
+		// moved relative links should still point to the same file
+		if s.policy == SymlinksMove {
+			contents, err := ioutil.ReadFile(links + string(os.PathSeparator) + "target" + string(os.PathSeparator) + "relative.txt")
+			if string(contents) != "data" {
+				t.Errorf("Relative symlink was broken by the move. Got '%v' (%v)", string(contents), err)
+			}
+		}
+		os.RemoveAll(links)
+	}
+}
+
+func TestRule_BrokenSymlinkHandler(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("this test needs symlinks")
+	}
+	_, dir, _, _ := runtime.Caller(0)
+	dir = filepath.FromSlash(strings.TrimRight(dir, "symlink_tes.go"))
+	links := createSymlinkFixtures(t, dir)
+	defer os.RemoveAll(links)
+
+	testDirectory := Directory{path: links}
+	testDirectory.rules = []Rule{{source: &testDirectory, handler: "BrokenSymlinkHandler", delete: true}}
+	if err := testDirectory.Ruler(context.Background()); err != nil {
+		t.Errorf("BrokenSymlinkHandler returned an error. Got '%v'", err)
+	}
+
+	if _, err := os.Lstat(links + string(os.PathSeparator) + "broken.txt"); !os.IsNotExist(err) {
+		t.Errorf("Broken symlink wasn't deleted. Got '%v'", err)
+	}
+	for _, name := range []string{"relative.txt", "absolute.txt"} {
+		if _, err := os.Lstat(links + string(os.PathSeparator) + name); err != nil {
+			t.Errorf("Working symlink %v was deleted. Got '%v'", name, err)
+		}
+	}
+}
+
+func TestRule_SymlinksInSource(t *testing.T) {
+	type symlinkTest struct {
+		policy string
+		dryRun bool
+		want   string
+	}
+	symlinkTestTable := []symlinkTest{
+		// a.txt sorts before the file it points to, which is gone (or pretended to be) by the time its turn comes
+		{policy: SymlinksFollow, want: "FileMoved /src/b.txt,FileDeleted /src/a.txt,FileSkipped /src/b.txt"},
+		{policy: SymlinksFollow, dryRun: true, want: "FileMoved /src/b.txt,FileDeleted /src/a.txt"},
+		{policy: SymlinksClean, want: "FileSkipped /src/a.txt,FileMoved /src/b.txt"},
+	}
+	for _, s := range symlinkTestTable {
+		fs := NewMemFS()
+		fs.MkdirAll("/src", 0755)
+		fs.MkdirAll("/dst", 0755)
+		fs.WriteFile("/src/b.txt", 1, 0644)
+		fs.Symlink("b.txt", "/src/a.txt")
+		config := DirectoriesConfig{Directories: []DirectoryConfig{{
+			Path:  "/src",
+			Rules: []RuleConfig{{Handler: "ExtensionHandler", Extensions: []string{"txt"}, Target: "/dst", Symlinks: s.policy}},
+		}}}
+		engine, err := New(config, Options{FS: fs, DryRun: s.dryRun})
+		if err != nil {
+			t.Fatalf("New returned an error. Got '%v'", err)
+		}
+		var got []string
+		engine.Subscribe(func(event Event) {
+			switch e := event.(type) {
+			case FileMoved:
+				got = append(got, "FileMoved "+e.From)
+			case FileDeleted:
+				got = append(got, "FileDeleted "+e.Path)
+			case FileSkipped:
+				got = append(got, "FileSkipped "+e.Path)
+			}
+		})
+		if err = engine.Run(context.Background()); err != nil {
+			t.Errorf("Run returned an error for the policy '%v' (dry run: %v). Got '%v'", s.policy, s.dryRun, err)
+		}
+		if strings.Join(got, ",") != s.want {
+			t.Errorf("Mismatch in events for the policy '%v' (dry run: %v). Got '%v', want '%v'", s.policy, s.dryRun, strings.Join(got, ","), s.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package dirculese
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SyslogSocketPaths are the Unix sockets that the local syslog daemon usually listens on, which NewSyslogLogger tries
+// in order when it isn't given one.
+var SyslogSocketPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// syslogFacilityUser is the syslog facility of the messages that a SyslogLogger sends (user-level messages).
+const syslogFacilityUser = 1
+
+// SyslogLogger is an EntryLogger that sends the entries of the given level and above to the local syslog daemon over
+// its Unix socket, with the priority that matches their level. The message of each entry is followed by its fields,
+// like in a LogWriter's text format. It's safe to use from several goroutines at once.
+type SyslogLogger struct {
+	mutex   sync.Mutex
+	address string
+	network string
+	conn    net.Conn
+	tag     string
+	level   Level
+}
+
+// NewSyslogLogger connects to the syslog daemon listening on the Unix socket at address (or the first of
+// SyslogSocketPaths that accepts a connection, if address is empty) and returns a SyslogLogger that tags its messages
+// with tag.
+func NewSyslogLogger(address string, tag string, level Level) (logger *SyslogLogger, err error) {
+	addresses := SyslogSocketPaths
+	if address != "" {
+		addresses = []string{address}
+	}
+	logger = &SyslogLogger{tag: tag, level: level}
+	for _, address = range addresses {
+		for _, network := range []string{"unixgram", "unix"} {
+			logger.address, logger.network = address, network
+			if err = logger.connect(); err == nil {
+				return
+			}
+		}
+	}
+	return nil, errors.New("couldn't connect to syslog: " + err.Error())
+}
+
+// connect (re)connects to the syslog daemon.
+func (l *SyslogLogger) connect() (err error) {
+	if l.conn != nil {
+		l.conn.Close()
+		l.conn = nil
+	}
+	l.conn, err = net.Dial(l.network, l.address)
+	return
+}
+
+// Log sends an entry to the syslog daemon if its level is at least the logger's, reconnecting once if the connection
+// was lost (e.g. because the daemon was restarted). Entries that can't be sent are dropped.
+func (l *SyslogLogger) Log(entry LogEntry) {
+	if entry.Level < l.level {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	message := "<" + strconv.Itoa(syslogFacilityUser*8+syslogSeverity(entry.Level)) + ">" + entry.Time.Format(time.Stamp) + " " +
+		l.tag + "[" + strconv.Itoa(os.Getpid()) + "]: " + textLogMessage(entry)
+	if l.network == "unix" {
+		message += "\n"
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.conn != nil {
+		if _, err := l.conn.Write([]byte(message)); err == nil {
+			return
+		}
+	}
+	if l.connect() == nil {
+		l.conn.Write([]byte(message))
+	}
+}
+
+// Close closes the connection to the syslog daemon.
+func (l *SyslogLogger) Close() (err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.conn == nil {
+		return
+	}
+	err = l.conn.Close()
+	l.conn = nil
+	return
+}
+
+// syslogSeverity returns the syslog severity of a level (see RFC 5424).
+func syslogSeverity(level Level) int {
+	switch {
+	case level >= LevelError:
+		return 3
+	case level == LevelWarn:
+		return 4
+	case level == LevelInfo:
+		return 6
+	}
+	return 7
+}
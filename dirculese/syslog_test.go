@@ -0,0 +1,64 @@
+package dirculese
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// listenUnixgram listens on a Unix datagram socket called name in a new temporary directory, which is removed by the
+// returned function.
+func listenUnixgram(t *testing.T, name string) (conn *net.UnixConn, path string, cleanup func()) {
+	tempDirectory, err := ioutil.TempDir("", "dirculese")
+	if err != nil {
+		t.Fatal("Couldn't create a temporary directory: " + err.Error())
+	}
+	path = filepath.Join(tempDirectory, name)
+	conn, err = net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		os.RemoveAll(tempDirectory)
+		t.Skip("Couldn't listen on a Unix datagram socket: " + err.Error())
+	}
+	return conn, path, func() {
+		conn.Close()
+		os.RemoveAll(tempDirectory)
+	}
+}
+
+// readDatagram reads the next datagram from conn, failing the test if there isn't one within a second.
+func readDatagram(t *testing.T, conn *net.UnixConn) string {
+	buffer := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buffer)
+	if err != nil {
+		t.Fatalf("Didn't receive a datagram. Got '%v'", err)
+	}
+	return string(buffer[:n])
+}
+
+func TestSyslogLogger(t *testing.T) {
+	conn, path, cleanup := listenUnixgram(t, "log")
+	defer cleanup()
+
+	if _, err := NewSyslogLogger(path+"-missing", "dirculese", LevelInfo); err == nil {
+		t.Error("NewSyslogLogger connected to a socket that doesn't exist")
+	}
+	logger, err := NewSyslogLogger(path, "dirculese", LevelInfo)
+	if err != nil {
+		t.Fatalf("NewSyslogLogger returned an error. Got '%v'", err)
+	}
+	defer logger.Close()
+
+	logger.Log(LogEntry{Level: LevelDebug, Message: "Skipped the rule because it isn't enabled."})
+	logger.Log(LogEntry{Level: LevelWarn, Message: "Ran the command.", Rule: "downloads/images", Err: errors.New("exit status 1")})
+	got := readDatagram(t, conn)
+	want := regexp.MustCompile(`^<12>[A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d dirculese\[\d+\]: Ran the command\. rule=downloads/images error="exit status 1"$`)
+	if !want.MatchString(got) {
+		t.Errorf("Mismatch in the syslog message. Got '%v', want it to match '%v'", got, want)
+	}
+}
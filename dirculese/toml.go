@@ -0,0 +1,649 @@
+package dirculese
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// tomlParser builds the tree returned by ParseTOMLConfigTree from the lines of a TOML document. tomlParser.table is the
+// table that key/value pairs are currently being added to, and tomlParser.tablePath is its configuration path.
+// tomlParser.defined has the configuration paths of the tables that have been defined by a header, a dotted key or an
+// inline table, which can't be defined again, and tomlParser.inline has the ones that are inline tables, which can't be
+// added to at all.
+type tomlParser struct {
+	root      map[string]interface{}
+	table     map[string]interface{}
+	tablePath string
+	positions map[string]ConfigPosition
+	comments  map[string][]string
+	defined   map[string]bool
+	inline    map[string]bool
+}
+
+// tomlError is an error at a specific place in a line (or in the lines of a value that spans several), rather than at
+// the start of it. tomlError.at is the rest of the text that was being parsed, starting where the error is.
+type tomlError struct {
+	at      string
+	message string
+}
+
+// Error implements the error interface.
+func (e *tomlError) Error() string {
+	return e.message
+}
+
+// reanchorTOMLError makes a tomlError that was found in text[:end], which its tomlError.at is a suffix of, point into
+// the whole of text instead, so that its position can still be worked out from the rest of the line. Other errors are
+// returned as they are.
+func reanchorTOMLError(err error, text string, end int) error {
+	if e, ok := err.(*tomlError); ok {
+		return &tomlError{at: text[end-len(e.at):], message: e.message}
+	}
+	return err
+}
+
+// ParseTOMLConfigTree parses the contents of a TOML configuration file into the same kind of tree as
+// ParseJSONConfigTree, along with the position of every field and table and the comments that came right before them.
+// It understands the parts of TOML that a configuration file needs: tables, arrays of tables, dotted keys, basic and
+// literal strings (with TOML's escapes, see unescapeTOML), numbers, booleans, arrays (which may span several lines) and
+// inline tables. Tables can't be defined more than once, and inline tables can't be added to. Multi-line strings and
+// dates are not supported.
+func ParseTOMLConfigTree(data []byte) (tree interface{}, positions map[string]ConfigPosition, comments map[string][]string, err error) {
+	parser := tomlParser{root: make(map[string]interface{}), positions: make(map[string]ConfigPosition), comments: make(map[string][]string), defined: make(map[string]bool), inline: make(map[string]bool)}
+	parser.table = parser.root
+	parser.positions[""] = ConfigPosition{Line: 1, Column: 1}
+
+	lines := strings.Split(string(data), "\n")
+	var pending []string
+	for i := 0; i < len(lines); i++ {
+		number := i + 1
+		content, comment, hasComment := splitComment(strings.TrimRight(lines[i], "\r"), false)
+		trimmed := strings.TrimSpace(content)
+		column := len(content) - len(strings.TrimLeft(content, " \t")) + 1
+		columns := []int{column}
+		if trimmed == "" {
+			if hasComment {
+				pending = append(pending, comment)
+			}
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "[") {
+			err = parser.header(trimmed, ConfigPosition{Line: number, Column: column}, pending)
+		} else {
+			// arrays and inline tables can continue on the following lines
+			for unbalanced(trimmed) && i+1 < len(lines) {
+				i++
+				next, _, _ := splitComment(strings.TrimRight(lines[i], "\r"), false)
+				trimmed += "\n" + strings.TrimSpace(next)
+				columns = append(columns, len(next)-len(strings.TrimLeft(next, " \t"))+1)
+			}
+			err = parser.keyValue(trimmed, ConfigPosition{Line: number, Column: column}, pending)
+		}
+		if e, ok := err.(*tomlError); ok {
+			// find the line and column of the error among the lines that make up the value
+			before := strings.Split(trimmed[:len(trimmed)-len(e.at)], "\n")
+			line := len(before) - 1
+			return nil, nil, nil, ConfigErrors{{Line: number + line, Column: columns[line] + len(before[line]), Message: err.Error()}}
+		}
+		if err != nil {
+			return nil, nil, nil, ConfigErrors{{Line: number, Column: column, Message: err.Error()}}
+		}
+		pending = nil
+	}
+	return parser.root, parser.positions, parser.comments, nil
+}
+
+// header handles a [table] or [[array of tables]] header, which makes the table it names the current one.
+func (p *tomlParser) header(text string, position ConfigPosition, comments []string) (err error) {
+	array := strings.HasPrefix(text, "[[")
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	if !strings.HasSuffix(text, closing) {
+		return errors.New("expected \"" + closing + "\" at the end of the table header")
+	}
+	keys, err := splitTOMLKey(strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(text, "["), "["), closing))
+	if err != nil {
+		return reanchorTOMLError(err, text, len(text)-len(closing))
+	}
+
+	// walk down to the parent of the new table, using the last table of any array of tables along the way
+	table, tablePath := p.root, ""
+	for _, key := range keys[:len(keys)-1] {
+		table, tablePath, err = p.descend(table, tablePath, key)
+		if err != nil {
+			return
+		}
+	}
+
+	key := keys[len(keys)-1]
+	parentPath := tablePath
+	tablePath = joinConfigPath(tablePath, key)
+	if array {
+		list, ok := table[key].([]interface{})
+		if !ok && table[key] != nil {
+			return errors.New("\"" + key + "\" is already used for something other than an array of tables")
+		}
+		table[key] = append(list, make(map[string]interface{}))
+		tablePath = indexConfigPath(tablePath, len(list))
+		p.table = table[key].([]interface{})[len(list)].(map[string]interface{})
+	} else {
+		if _, isArray := table[key].([]interface{}); isArray || p.defined[tablePath] {
+			return errors.New("the table \"" + tablePath + "\" is defined more than once")
+		}
+		p.table, _, err = p.descend(table, parentPath, key)
+		if err != nil {
+			return
+		}
+		p.defined[tablePath] = true
+	}
+	p.tablePath = tablePath
+	p.positions[tablePath] = position
+	if len(comments) > 0 {
+		p.comments[tablePath] = comments
+	}
+	return
+}
+
+// keyValue handles a key = value line by adding the value to the current table.
+func (p *tomlParser) keyValue(text string, position ConfigPosition, comments []string) (err error) {
+	i := indexOutsideQuotes(text, '=')
+	if i < 0 {
+		return errors.New("expected a \"key = value\" pair")
+	}
+	keys, err := splitTOMLKey(text[:i])
+	if err != nil {
+		return reanchorTOMLError(err, text, i)
+	}
+	value, rest, err := parseTOMLValue(text[i+1:])
+	if err != nil {
+		return
+	}
+	if strings.TrimSpace(rest) != "" {
+		return errors.New("unexpected \"" + strings.TrimSpace(rest) + "\" after the value")
+	}
+
+	table, tablePath := p.table, p.tablePath
+	for _, key := range keys[:len(keys)-1] {
+		table, tablePath, err = p.descend(table, tablePath, key)
+		if err != nil {
+			return
+		}
+		p.defined[tablePath] = true
+	}
+	key := keys[len(keys)-1]
+	if _, duplicate := table[key]; duplicate {
+		return errors.New("the key \"" + key + "\" is used more than once")
+	}
+	table[key] = value
+	fieldPath := joinConfigPath(tablePath, key)
+	if _, ok := value.(map[string]interface{}); ok {
+		p.defined[fieldPath] = true
+		p.inline[fieldPath] = true
+	}
+	p.positions[fieldPath] = position
+	if len(comments) > 0 {
+		p.comments[fieldPath] = comments
+	}
+	return
+}
+
+// descend returns the table that key refers to inside table, which is found at tablePath (see descendTOML), unless it's
+// an inline table.
+func (p *tomlParser) descend(table map[string]interface{}, tablePath string, key string) (child map[string]interface{}, childPath string, err error) {
+	child, childPath, err = descendTOML(table, tablePath, key)
+	if err == nil && p.inline[childPath] {
+		err = errors.New("the inline table \"" + childPath + "\" can't be added to")
+	}
+	return
+}
+
+// descendTOML returns the table that key refers to inside table, creating it if it doesn't exist yet. If key refers to
+// an array of tables, its last table is returned.
+func descendTOML(table map[string]interface{}, tablePath string, key string) (child map[string]interface{}, childPath string, err error) {
+	childPath = joinConfigPath(tablePath, key)
+	switch value := table[key].(type) {
+	case nil:
+		child = make(map[string]interface{})
+		table[key] = child
+	case map[string]interface{}:
+		child = value
+	case []interface{}:
+		if len(value) > 0 {
+			if last, ok := value[len(value)-1].(map[string]interface{}); ok {
+				return last, indexConfigPath(childPath, len(value)-1), nil
+			}
+		}
+		err = errors.New("\"" + key + "\" is not a table")
+	default:
+		err = errors.New("\"" + key + "\" is not a table")
+	}
+	return
+}
+
+// splitTOMLKey splits a bare, quoted or dotted key into its parts.
+func splitTOMLKey(text string) (keys []string, err error) {
+	offset := 0
+	for _, part := range splitOutsideQuotes(text, '.') {
+		start := offset + len(part) - len(strings.TrimLeft(part, " \t"))
+		offset += len(part) + 1
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "":
+			return nil, errors.New("empty keys aren't allowed")
+		case part[0] == '"' || part[0] == '\'':
+			var value interface{}
+			value, _, err = parseTOMLValue(part)
+			if err != nil {
+				return nil, reanchorTOMLError(err, text, start+len(part))
+			}
+			keys = append(keys, value.(string))
+		case strings.Trim(part, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-") != "":
+			return nil, errors.New("the key \"" + part + "\" needs to be quoted")
+		default:
+			keys = append(keys, part)
+		}
+	}
+	return
+}
+
+// parseTOMLValue parses a single value at the start of text and returns it along with the rest of the text.
+func parseTOMLValue(text string) (value interface{}, rest string, err error) {
+	text = strings.TrimLeft(text, " \t\n")
+	if text == "" {
+		return nil, "", errors.New("missing value")
+	}
+	switch text[0] {
+	case '"', '\'':
+		return parseTOMLString(text)
+	case '[', '{':
+		return parseTOMLCollection(text)
+	}
+
+	end := strings.IndexAny(text, ",]}\n \t")
+	if end < 0 {
+		end = len(text)
+	}
+	word := text[:end]
+	if word == "" {
+		return nil, "", errors.New("missing value")
+	}
+	switch word {
+	case "true":
+		return true, text[end:], nil
+	case "false":
+		return false, text[end:], nil
+	}
+	if strings.Count(word, "-") > 1 || strings.Contains(word, ":") {
+		return nil, "", errors.New("dates aren't supported")
+	}
+	if strings.Trim(word, "+-0123456789_.eExobABCDEFabcdef") == "" && strings.ContainsAny(word[:1], "+-0123456789") {
+		value, err = parseTOMLNumber(word)
+		return value, text[end:], err
+	}
+	return nil, "", errors.New("unrecognized value \"" + word + "\" (strings need to be quoted)")
+}
+
+// parseTOMLNumber parses a TOML integer or float. Integers are decimal, or hexadecimal, octal or binary with a 0x, 0o
+// or 0b prefix, and decimal numbers can't have leading zeros. Underscores are allowed between digits.
+func parseTOMLNumber(word string) (number json.Number, err error) {
+	invalid := errors.New("invalid number \"" + word + "\"")
+	for i := 0; i < len(word); i++ {
+		if word[i] == '_' && (i == 0 || i == len(word)-1 || !isHexDigit(word[i-1]) || !isHexDigit(word[i+1])) {
+			return "", invalid
+		}
+	}
+	digits := strings.Replace(word, "_", "", -1)
+	if len(digits) > 2 && digits[0] == '0' && strings.ContainsAny(digits[1:2], "xob") {
+		base := map[byte]int{'x': 16, 'o': 8, 'b': 2}[digits[1]]
+		i, parseErr := strconv.ParseInt(digits[2:], base, 64)
+		if parseErr != nil || strings.ContainsAny(digits[2:3], "+-") {
+			return "", invalid
+		}
+		return json.Number(strconv.FormatInt(i, 10)), nil
+	}
+	unsigned := strings.TrimLeft(digits, "+-")
+	if len(unsigned) > 1 && unsigned[0] == '0' && unsigned[1] >= '0' && unsigned[1] <= '9' {
+		return "", errors.New("leading zeros aren't allowed in \"" + word + "\"")
+	}
+	if number, ok := parseNumber(digits); ok && len(digits)-len(unsigned) <= 1 {
+		return number, nil
+	}
+	return "", invalid
+}
+
+// isHexDigit reports whether c is a hexadecimal (and so also a decimal, octal or binary) digit.
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// parseTOMLString parses the basic or literal string at the start of text.
+func parseTOMLString(text string) (value interface{}, rest string, err error) {
+	if strings.HasPrefix(text, "\"\"\"") || strings.HasPrefix(text, "'''") {
+		return nil, "", errors.New("multi-line strings aren't supported")
+	}
+	if text[0] == '\'' {
+		end := strings.Index(text[1:], "'") + 1
+		if end <= 0 {
+			return nil, "", errors.New("unterminated string")
+		}
+		return text[1:end], text[end+1:], nil
+	}
+	end := closingQuote(text)
+	if end < 0 {
+		return nil, "", errors.New("unterminated string")
+	}
+	value, err = unescapeTOML(text[1:end])
+	if err != nil {
+		return nil, "", reanchorTOMLError(err, text, end)
+	}
+	return value, text[end+1:], nil
+}
+
+// unescapeTOML decodes the escapes in the body of a basic string: \b, \t, \n, \f, \r, \e, \", \\, \uXXXX and
+// \UXXXXXXXX. Any other escape, and any control character other than a tab, is a tomlError at the place it appears.
+func unescapeTOML(body string) (value string, err error) {
+	var builder strings.Builder
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c != '\\' {
+			if c < 0x20 && c != '\t' || c == 0x7f {
+				return "", &tomlError{at: body[i:], message: "control characters need to be escaped in strings"}
+			}
+			builder.WriteByte(c)
+			continue
+		}
+		if i+1 == len(body) {
+			return "", &tomlError{at: body[i:], message: "unterminated escape"}
+		}
+		switch body[i+1] {
+		case 'b':
+			builder.WriteByte('\b')
+		case 't':
+			builder.WriteByte('\t')
+		case 'n':
+			builder.WriteByte('\n')
+		case 'f':
+			builder.WriteByte('\f')
+		case 'r':
+			builder.WriteByte('\r')
+		case 'e':
+			builder.WriteByte(0x1b)
+		case '"', '\\':
+			builder.WriteByte(body[i+1])
+		case 'u', 'U':
+			digits := 4
+			if body[i+1] == 'U' {
+				digits = 8
+			}
+			invalid := &tomlError{at: body[i:], message: "the escape \"\\" + body[i+1:i+2] + "\" needs " + strconv.Itoa(digits) + " hexadecimal digits"}
+			if i+2+digits > len(body) {
+				return "", invalid
+			}
+			escape := body[i : i+2+digits]
+			code, parseErr := strconv.ParseUint(escape[2:], 16, 32)
+			if parseErr != nil || strings.ContainsAny(escape[2:3], "+-") {
+				return "", invalid
+			}
+			if !utf8.ValidRune(rune(code)) {
+				return "", &tomlError{at: body[i:], message: "the escape \"" + escape + "\" isn't a valid Unicode character"}
+			}
+			builder.WriteRune(rune(code))
+			i += digits
+		default:
+			return "", &tomlError{at: body[i:], message: "invalid escape \"" + body[i:i+2] + "\""}
+		}
+		i++
+	}
+	return builder.String(), nil
+}
+
+// parseTOMLCollection parses the array or inline table at the start of text.
+func parseTOMLCollection(text string) (value interface{}, rest string, err error) {
+	closing := byte(']')
+	if text[0] == '{' {
+		closing = '}'
+	}
+	list := make([]interface{}, 0)
+	object := make(map[string]interface{})
+	dotted := make(map[string]bool)
+	rest = strings.TrimLeft(text[1:], " \t\n")
+	for rest != "" && rest[0] != closing {
+		if closing == '}' {
+			rest, err = parseTOMLKeyValue(rest, object, dotted)
+		} else {
+			var item interface{}
+			item, rest, err = parseTOMLValue(rest)
+			list = append(list, item)
+		}
+		if err != nil {
+			return
+		}
+		rest = strings.TrimLeft(rest, " \t\n")
+		if strings.HasPrefix(rest, ",") {
+			rest = strings.TrimLeft(rest[1:], " \t\n")
+		} else if rest == "" || rest[0] != closing {
+			return nil, "", errors.New("expected \",\" or \"" + string(closing) + "\"")
+		}
+	}
+	if rest == "" {
+		return nil, "", errors.New("expected \"" + string(closing) + "\"")
+	}
+	if closing == '}' {
+		return object, rest[1:], nil
+	}
+	return list, rest[1:], nil
+}
+
+// parseTOMLKeyValue parses the key = value pair at the start of text, which is inside an inline table, and adds the
+// value to object. Dotted keys add the value to nested tables, the way they do outside of inline tables, and dotted has
+// the paths of the tables that dotted keys have created, which are the only ones that other keys can be added to.
+func parseTOMLKeyValue(text string, object map[string]interface{}, dotted map[string]bool) (rest string, err error) {
+	equals := indexOutsideQuotes(text, '=')
+	if equals < 0 {
+		return "", errors.New("expected a \"key = value\" pair inside {}")
+	}
+	keys, err := splitTOMLKey(text[:equals])
+	if err != nil {
+		return "", reanchorTOMLError(err, text, equals)
+	}
+	table, tablePath := object, ""
+	for _, key := range keys[:len(keys)-1] {
+		_, exists := table[key]
+		if exists && !dotted[joinConfigPath(tablePath, key)] {
+			return "", errors.New("\"" + joinConfigPath(tablePath, key) + "\" is already defined")
+		}
+		table, tablePath, err = descendTOML(table, tablePath, key)
+		if err != nil {
+			return
+		}
+		dotted[tablePath] = true
+	}
+	key := keys[len(keys)-1]
+	if _, duplicate := table[key]; duplicate {
+		return "", errors.New("the key \"" + key + "\" is used more than once")
+	}
+	table[key], rest, err = parseTOMLValue(text[equals+1:])
+	return
+}
+
+// unbalanced reports whether a line has more opening than closing brackets outside of strings, which means its value
+// continues on the next line.
+func unbalanced(text string) bool {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"', '\'':
+			end := closingQuote(text[i:])
+			if end < 0 {
+				return false
+			}
+			i += end
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+// indexOutsideQuotes returns the index of the first separator in text that isn't inside a quoted string, or -1 if there
+// isn't one.
+func indexOutsideQuotes(text string, separator byte) int {
+	if parts := splitOutsideQuotes(text, separator); len(parts) > 1 {
+		return len(parts[0])
+	}
+	return -1
+}
+
+// splitOutsideQuotes splits text at every separator that isn't inside a quoted string.
+func splitOutsideQuotes(text string, separator byte) (parts []string) {
+	start := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"', '\'':
+			if end := closingQuote(text[i:]); end > 0 {
+				i += end
+			}
+		case separator:
+			parts = append(parts, text[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, text[start:])
+}
+
+// WriteTOMLConfigTree writes a configuration tree to w as TOML. Fields are written in the order they're declared in the
+// Go type t, with simple values first and tables after them, and the comments (keyed by configuration path) are written
+// right before the fields and tables they belong to.
+func WriteTOMLConfigTree(w io.Writer, tree interface{}, t reflect.Type, comments map[string][]string) (err error) {
+	object, ok := tree.(map[string]interface{})
+	if !ok {
+		return errors.New("a TOML configuration needs to be a table")
+	}
+	var lines []string
+	writeComments(&lines, comments[""], "", "#")
+	writeTOMLTable(&lines, object, t, nil, "", comments)
+	_, err = io.WriteString(w, strings.TrimLeft(strings.Join(lines, "\n"), "\n")+"\n")
+	return
+}
+
+// writeTOMLTable adds the key/value pairs of a table to lines, followed by its subtables and arrays of tables.
+func writeTOMLTable(lines *[]string, object map[string]interface{}, t reflect.Type, header []string, configPath string, comments map[string][]string) {
+	keys := orderedKeys(object, t)
+	for _, key := range keys {
+		if !isTOMLTable(object[key]) && object[key] != nil {
+			writeComments(lines, comments[joinConfigPath(configPath, key)], "", "#")
+			*lines = append(*lines, tomlKey(key)+" = "+tomlValue(object[key]))
+		}
+	}
+	for _, key := range keys {
+		fieldPath := joinConfigPath(configPath, key)
+		childHeader := append(append([]string{}, header...), tomlKey(key))
+		switch value := object[key].(type) {
+		case map[string]interface{}:
+			if isTOMLTable(value) {
+				*lines = append(*lines, "")
+				writeComments(lines, comments[fieldPath], "", "#")
+				*lines = append(*lines, "["+strings.Join(childHeader, ".")+"]")
+				writeTOMLTable(lines, value, fieldType(t, key), childHeader, fieldPath, comments)
+			}
+		case []interface{}:
+			if isTOMLTable(value) {
+				*lines = append(*lines, "")
+				writeComments(lines, comments[fieldPath], "", "#")
+				for i, item := range value {
+					if i > 0 {
+						*lines = append(*lines, "")
+					}
+					writeComments(lines, comments[indexConfigPath(fieldPath, i)], "", "#")
+					*lines = append(*lines, "[["+strings.Join(childHeader, ".")+"]]")
+					writeTOMLTable(lines, item.(map[string]interface{}), fieldType(fieldType(t, key), ""), childHeader, indexConfigPath(fieldPath, i), comments)
+				}
+			}
+		}
+	}
+}
+
+// isTOMLTable reports whether a value should be written as a [table] or an [[array of tables]] rather than inline.
+func isTOMLTable(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return len(v) > 0
+	case []interface{}:
+		for _, item := range v {
+			if _, ok := item.(map[string]interface{}); !ok {
+				return false
+			}
+		}
+		return len(v) > 0
+	}
+	return false
+}
+
+// tomlKey formats a key as TOML, quoting it if it isn't a valid bare key.
+func tomlKey(key string) string {
+	if key == "" || strings.Trim(key, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-") != "" {
+		return tomlString(key)
+	}
+	return key
+}
+
+// tomlString formats a string as a TOML basic string. Control characters are written as \uXXXX escapes, because TOML
+// doesn't have Go's \x, \a and \v escapes.
+func tomlString(text string) string {
+	var builder strings.Builder
+	builder.WriteByte('"')
+	for _, r := range text {
+		switch {
+		case r == '"' || r == '\\':
+			builder.WriteByte('\\')
+			builder.WriteRune(r)
+		case r == '\n':
+			builder.WriteString("\\n")
+		case r == '\t':
+			builder.WriteString("\\t")
+		case r == '\r':
+			builder.WriteString("\\r")
+		case r < 0x20 || r == 0x7f:
+			builder.WriteString(fmt.Sprintf("\\u%04X", r))
+		default:
+			builder.WriteRune(r)
+		}
+	}
+	builder.WriteByte('"')
+	return builder.String()
+}
+
+// tomlValue formats a value from a configuration tree as TOML, using inline arrays and tables for nested values.
+func tomlValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return tomlString(v)
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, tomlValue(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		items := make([]string, 0, len(v))
+		for _, key := range sortedKeys(v) {
+			items = append(items, tomlKey(key)+" = "+tomlValue(v[key]))
+		}
+		if len(items) == 0 {
+			return "{}"
+		}
+		return "{ " + strings.Join(items, ", ") + " }"
+	}
+	return toString(value)
+}
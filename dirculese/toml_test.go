@@ -0,0 +1,169 @@
+package dirculese
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOMLConfigTree(t *testing.T) {
+	data := []byte(`# organize downloads
+[[Directories]]
+Path = "/tmp"
+Hidden = 'Include' # hidden files too
+
+# pictures
+[[Directories.Rules]]
+Handler = "ExtensionHandler"
+Extensions = [
+  "png",
+  "tar.gz", # archives
+]
+SizeMax = 1_000
+Delete = true
+Command = { Path = "/bin/echo", Args = ["{file}"] }
+
+[Stability]
+SettleTime = 5
+`)
+	tree, positions, comments, err := ParseTOMLConfigTree(data)
+	if err != nil {
+		t.Fatalf("Couldn't parse valid TOML. Got '%v'", err)
+	}
+	directory := tree.(map[string]interface{})["Directories"].([]interface{})[0].(map[string]interface{})
+	rule := directory["Rules"].([]interface{})[0].(map[string]interface{})
+	if directory["Path"] != "/tmp" || directory["Hidden"] != "Include" {
+		t.Errorf("Mismatch in directory. Got '%v'", directory)
+	}
+	want := map[string]interface{}{
+		"Handler":    "ExtensionHandler",
+		"Extensions": []interface{}{"png", "tar.gz"},
+		"SizeMax":    json.Number("1000"),
+		"Delete":     true,
+		"Command":    map[string]interface{}{"Path": "/bin/echo", "Args": []interface{}{"{file}"}},
+	}
+	if !reflect.DeepEqual(rule, want) {
+		t.Errorf("Mismatch in rule. Got '%v', want '%v'", rule, want)
+	}
+
+	wantPositions := map[string]ConfigPosition{
+		"Directories[0]":                  {Line: 2, Column: 1},
+		"Directories[0].Path":             {Line: 3, Column: 1},
+		"Directories[0].Rules[0]":         {Line: 7, Column: 1},
+		"Directories[0].Rules[0].SizeMax": {Line: 13, Column: 1},
+		"Stability.SettleTime":            {Line: 18, Column: 1},
+	}
+	for configPath, position := range wantPositions {
+		if positions[configPath] != position {
+			t.Errorf("Mismatch in the position of %v. Got '%v', want '%v'", configPath, positions[configPath], position)
+		}
+	}
+	if strings.Join(comments["Directories[0]"], ",") != "organize downloads" || strings.Join(comments["Directories[0].Rules[0]"], ",") != "pictures" {
+		t.Errorf("Mismatch in comments. Got '%v'", comments)
+	}
+
+	tree, _, _, err = ParseTOMLConfigTree([]byte("Workers = 0x1_0\n'a=b' = -1_7\nSizeMax = 0.5\nCommand = { Path = \"/bin/echo\", Env.HOME = \"/tmp\", Env.USER = \"me\" }\n"))
+	want = map[string]interface{}{
+		"Workers": json.Number("16"),
+		"a=b":     json.Number("-17"),
+		"SizeMax": json.Number("0.5"),
+		"Command": map[string]interface{}{"Path": "/bin/echo", "Env": map[string]interface{}{"HOME": "/tmp", "USER": "me"}},
+	}
+	if err != nil || !reflect.DeepEqual(tree, want) {
+		t.Errorf("Mismatch in numbers, keys and inline tables. Got '%v' (%v), want '%v'", tree, err, want)
+	}
+
+	bad := map[string]int{
+		"[Stability]\nSettleTime = 5\nSettleTime = 6\n": 3,
+		"Workers = 010\n":    1,
+		"Workers = 0x_10\n":  1,
+		"Workers = 1__000\n": 1,
+		"Command = { Env = {}, Env.HOME = \"/tmp\" }\n": 1,
+		"Path = /tmp\n":                    1,
+		"[Stability\n":                     1,
+		"Path = \"\"\"multi\nline\"\"\"\n": 1,
+		"DateMin = 2020-01-01\n":           1,
+		"[Stability]\nSettleTime = 5\n\n[Stability]\nSettleTime = 6\n": 4,
+		"Stability.SettleTime = 5\n[Stability]\n":                      2,
+		"Stability = { SettleTime = 5 }\n[Stability]\n":                2,
+		"Command = { Path = \"/bin/echo\" }\nCommand.Args = []\n":      2,
+		"[[Directories]]\nPath = \"/tmp\"\n[Directories]\n":            3,
+		"Workers = ,\n": 1,
+		"Workers = ]\n": 1,
+		"Workers = }\n": 1,
+		"Args = [,]\n":  1,
+	}
+	for document, line := range bad {
+		_, _, _, err = ParseTOMLConfigTree([]byte(document))
+		errs, ok := err.(ConfigErrors)
+		if !ok || len(errs) != 1 || errs[0].Line != line {
+			t.Errorf("Error in %q wasn't reported on line %v. Got '%v'", document, line, err)
+		}
+	}
+}
+
+func TestParseTOMLConfigTree_Escapes(t *testing.T) {
+	tree, _, _, err := ParseTOMLConfigTree([]byte(`Path = "\b\t\n\f\r\e\"\\\u00E9\U0001F600 \u0041"` + "\n"))
+	want := "\b\t\n\f\r\x1b\"\\é\U0001F600 A"
+	if err != nil || tree.(map[string]interface{})["Path"] != want {
+		t.Errorf("Mismatch in escapes. Got '%v' (%v), want %q", tree, err, want)
+	}
+
+	// escapes that TOML doesn't have are reported where they are
+	bad := map[string]ConfigPosition{
+		`Path = "a\x41"`:                       {Line: 1, Column: 10},
+		`Path = "\a"`:                          {Line: 1, Column: 9},
+		`Path = "\v"`:                          {Line: 1, Column: 9},
+		`Path = "\u12"`:                        {Line: 1, Column: 9},
+		`Path = "\uD800"`:                      {Line: 1, Column: 9},
+		"Path = \"a\tb\x01\"":                  {Line: 1, Column: 12},
+		"Args = [\n  \"a\",\n    \"b\\x\",\n]": {Line: 3, Column: 7},
+		`"a\q" = 1`:                            {Line: 1, Column: 3},
+		`[Directories."\q"]`:                   {Line: 1, Column: 15},
+		`Command = { "\q" = 1 }`:               {Line: 1, Column: 14},
+	}
+	for document, position := range bad {
+		_, _, _, err = ParseTOMLConfigTree([]byte(document + "\n"))
+		errs, ok := err.(ConfigErrors)
+		if !ok || len(errs) != 1 || errs[0].Line != position.Line || errs[0].Column != position.Column {
+			t.Errorf("Error in %q wasn't reported at %v. Got '%v'", document, position, err)
+		}
+	}
+}
+
+func TestWriteTOMLConfigTree(t *testing.T) {
+	data := []byte(`# downloads
+[[Directories]]
+Path = "/tmp"
+
+# pictures
+[[Directories.Rules]]
+Handler = "ExtensionHandler"
+Extensions = ["png", "jpg"]
+
+[Directories.Rules.Command]
+Path = "/bin/echo"
+Args = ["\u0000\u0007\u000B\"\\\t", "é"]
+
+[[Directories.Rules]]
+Delete = true
+Handler = "BrokenSymlinkHandler"
+
+[Stability]
+SettleTime = 5
+`)
+	tree, _, comments, err := ParseTOMLConfigTree(data)
+	if err != nil {
+		t.Fatalf("Couldn't parse valid TOML. Got '%v'", err)
+	}
+	var output bytes.Buffer
+	err = WriteTOMLConfigTree(&output, tree, reflect.TypeOf(DirectoriesConfig{}), comments)
+	if err != nil {
+		t.Fatalf("Couldn't write TOML. Got '%v'", err)
+	}
+	if output.String() != string(data) {
+		t.Errorf("Mismatch in output. Got '%v', want '%v'", output.String(), string(data))
+	}
+}
@@ -0,0 +1,420 @@
+package dirculese
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// DefaultWebhookTimeout is how long a webhook has to respond to each request when its configuration doesn't specify a
+// Timeout.
+const DefaultWebhookTimeout = 10 * time.Second
+
+// MaxWebhookRetries is the most times a webhook's request can be retried, which keeps the end of a run from waiting on
+// a webhook's backoff for more than half a minute (plus the time the requests themselves take).
+const MaxWebhookRetries = 5
+
+// WebhookEventsSummary and WebhookEventsFiles are what a webhook can be sent (see WebhookConfig): a summary once the
+// run is done (the default), or a request for every file that's moved or deleted.
+const (
+	WebhookEventsSummary = "Summary"
+	WebhookEventsFiles   = "Files"
+)
+
+// WebhookEventRun, WebhookEventRule and WebhookEventFile are the kinds of payloads that webhooks are sent (see
+// WebhookPayload), which are also in the WebhookEventHeader of their requests.
+const (
+	WebhookEventRun  = "run"
+	WebhookEventRule = "rule"
+	WebhookEventFile = "file"
+)
+
+// WebhookEventHeader is the HTTP header that says what kind of payload a webhook's request has, and
+// WebhookSignatureHeader is the one that has the HMAC-SHA256 of its body, keyed with the webhook's secret and encoded
+// in hex after "sha256=" (it's left out if the webhook doesn't have a secret).
+const (
+	WebhookEventHeader     = "X-Dirculese-Event"
+	WebhookSignatureHeader = "X-Dirculese-Signature"
+)
+
+// webhookConcurrency is how many webhook requests an engine sends at the same time.
+const webhookConcurrency = 4
+
+// webhookGracePeriod is how long Engine.Run keeps waiting for the webhooks that are still being sent once its context
+// is done (because the run was interrupted or used up its time budget) before it gives up on them.
+var webhookGracePeriod = 5 * time.Second
+
+// WebhookPayload is what a webhook is sent, as JSON (or, if the webhook has a body template, what the template is
+// executed with). WebhookPayload.Event says which of the other fields are set: WebhookPayload.Run has the Report of the
+// whole run for WebhookEventRun, WebhookPayload.Summary has the RuleReport of WebhookPayload.Rule for WebhookEventRule,
+// and WebhookPayload.File has the file that WebhookPayload.Rule moved or deleted for WebhookEventFile.
+type WebhookPayload struct {
+	Event     string        `json:"event"`
+	RunID     string        `json:"run_id"`
+	Time      time.Time     `json:"time"`
+	Directory string        `json:"directory,omitempty"`
+	Rule      string        `json:"rule,omitempty"`
+	Run       *Report       `json:"run,omitempty"`
+	Summary   *RuleReport   `json:"summary,omitempty"`
+	File      *ReportAction `json:"file,omitempty"`
+}
+
+// Webhook is a URL that payloads about runs, rules or files are POSTed to (see WebhookPayload). Webhook.events is what
+// it's sent (WebhookEventsSummary or WebhookEventsFiles). The body of each request is the payload as JSON, or the
+// result of executing the Webhook.body template with it, and is signed with Webhook.secret if there is one (see
+// WebhookSignatureHeader). Webhook.headers are added to every request, and may replace its Content-Type (see
+// Webhook.contentType). A request that doesn't get a response within Webhook.timeout, fails to connect, or gets a 5xx
+// or 429 response is retried up to Webhook.retries times (at most MaxWebhookRetries), waiting Webhook.backoff before
+// the first retry and twice as long before each one after it.
+type Webhook struct {
+	url     string
+	events  string
+	secret  string
+	timeout time.Duration
+	retries int
+	headers map[string]string
+	body    *template.Template
+	backoff time.Duration
+}
+
+// GetWebhook creates a Webhook based on the contents of a WebhookConfig struct. An error is returned if its Body isn't
+// a valid template.
+func GetWebhook(config WebhookConfig) (webhook *Webhook, err error) {
+	webhook = &Webhook{
+		url:     config.URL,
+		events:  config.Events,
+		secret:  config.Secret,
+		timeout: time.Duration(config.Timeout) * time.Second,
+		retries: config.Retries,
+		headers: config.Headers,
+		backoff: time.Second,
+	}
+	if webhook.events == "" {
+		webhook.events = WebhookEventsSummary
+	}
+	if webhook.timeout <= 0 {
+		webhook.timeout = DefaultWebhookTimeout
+	}
+	if webhook.retries > MaxWebhookRetries {
+		webhook.retries = MaxWebhookRetries
+	}
+	if config.Body != "" {
+		webhook.body, err = template.New("Body").Funcs(webhookFunctions).Parse(config.Body)
+		if err != nil {
+			return nil, errors.New(err.Error())
+		}
+	}
+	return
+}
+
+// GetWebhooks creates the Webhooks of a list of WebhookConfig structs (see GetWebhook), leaving out the ones whose Body
+// isn't a valid template, which ValidateConfig reports.
+func GetWebhooks(configs []WebhookConfig) (webhooks []*Webhook) {
+	for _, config := range configs {
+		if webhook, err := GetWebhook(config); err == nil {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return
+}
+
+// webhookFunctions are the functions that webhook body templates can use: json encodes a value as JSON (so that it can
+// be put in a JSON body as it is), bytes formats a number of bytes for people to read (see FormatBytes) and base
+// returns the last element of a path.
+var webhookFunctions = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+	"bytes": FormatBytes,
+	"base":  filepath.Base,
+}
+
+// Send POSTs a payload to the webhook, retrying as many times as the webhook allows (see Webhook). It returns the error
+// of the last attempt if none of them succeeded, or straight away if ctx is done.
+func (w *Webhook) Send(ctx context.Context, payload WebhookPayload) (err error) {
+	body, err := w.render(payload)
+	if err != nil {
+		return
+	}
+	wait := w.backoff
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = w.post(ctx, payload.Event, body)
+		if err == nil || !retry || attempt >= w.retries {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// render returns the body of the request for a payload.
+func (w *Webhook) render(payload WebhookPayload) (body []byte, err error) {
+	if w.body == nil {
+		body, err = json.Marshal(payload)
+		if err != nil {
+			return nil, errors.New(err.Error())
+		}
+		return
+	}
+	var buffer bytes.Buffer
+	if err = w.body.Execute(&buffer, payload); err != nil {
+		return nil, errors.New("couldn't execute the body template: " + err.Error())
+	}
+	return buffer.Bytes(), nil
+}
+
+// post sends a single request with body to the webhook, and reports whether it's worth trying again if it failed.
+func (w *Webhook) post(ctx context.Context, event string, body []byte) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.New(err.Error())
+	}
+	request.Header.Set("Content-Type", w.contentType(body))
+	request.Header.Set("User-Agent", "dirculese")
+	request.Header.Set(WebhookEventHeader, event)
+	if w.secret != "" {
+		request.Header.Set(WebhookSignatureHeader, SignWebhookBody(w.secret, body))
+	}
+	for key, value := range w.headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return true, errors.New("timed out after " + w.timeout.String())
+		}
+		return true, errors.New(err.Error())
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(response.Body, 1<<16))
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return false, nil
+	}
+	return response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests, errors.New("the server responded with " + response.Status)
+}
+
+// contentType returns the Content-Type of a request with body: application/json, unless the webhook's body template
+// produced something other than JSON, which is sent as plain text. A Content-Type in Webhook.headers replaces either.
+func (w *Webhook) contentType(body []byte) string {
+	if w.body != nil && !json.Valid(body) {
+		return "text/plain; charset=utf-8"
+	}
+	return "application/json"
+}
+
+// SignWebhookBody returns the value of the WebhookSignatureHeader for a request with body sent by a webhook with the
+// given secret, which receivers can compare with the header (in constant time, e.g. with hmac.Equal) to make sure the
+// request came from dirculese.
+func SignWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// displayURL returns the scheme and host of the webhook's URL, which is what's logged about it: the rest of webhook
+// URLs often has tokens in it.
+func (w *Webhook) displayURL() string {
+	parsed, err := url.Parse(w.url)
+	if err != nil || parsed.Host == "" {
+		return "a webhook"
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
+
+// notifier sends the webhooks of an Engine: a summary of the run to the top-level webhooks, a summary of each rule
+// that matched files or failed to the rule's webhooks, and a payload for every file that's moved or deleted to the
+// webhooks that want them (the top-level ones get the files of every rule). Payloads are queued in notifier.queue, so
+// the run never waits for a webhook, and sent in the background by up to webhookConcurrency goroutines (which are
+// counted in notifier.senders) in no particular order. Engine.Run waits for them before it returns (see
+// notifier.wait). notifier.ctx is the context that the payloads of the current run are sent with, which notifier.cancel
+// cancels. During a dry run, the payloads are logged instead of being sent.
+type notifier struct {
+	options  *Options
+	run      []*Webhook
+	rules    map[ruleKey][]*Webhook
+	reporter *Reporter
+	mutex    sync.Mutex
+	queue    []webhookDelivery
+	senders  int
+	pending  sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// webhookDelivery is a payload that's waiting to be sent to a webhook, along with the log entry about it.
+type webhookDelivery struct {
+	webhook *Webhook
+	payload WebhookPayload
+	entry   LogEntry
+}
+
+// newNotifier returns a notifier for the webhooks of engine and its rules, or nil if there aren't any.
+func newNotifier(engine *Engine) (n *notifier) {
+	n = &notifier{options: &engine.options, run: GetWebhooks(engine.config.Webhooks), rules: make(map[ruleKey][]*Webhook)}
+	for _, d := range engine.directories {
+		for _, rule := range d.rules {
+			if len(rule.webhooks) > 0 {
+				n.rules[ruleKey{directory: d.label(), rule: rule.name}] = rule.webhooks
+			}
+		}
+	}
+	if len(n.run) == 0 && len(n.rules) == 0 {
+		return nil
+	}
+	// the reporter subscribes first, so its report is complete by the time the notifier sees RunFinished
+	n.reporter = NewReporter(engine)
+	engine.Subscribe(n.observe)
+	return
+}
+
+// observe sends the payloads of an event to the webhooks that want them.
+func (n *notifier) observe(event Event) {
+	switch e := event.(type) {
+	case FileMoved:
+		n.file(e.Time, e.Directory, e.Rule, ReportAction{Action: ActionMove, Source: e.From, Destination: e.To, Size: e.Size})
+	case FileDeleted:
+		n.file(e.Time, e.Directory, e.Rule, ReportAction{Action: ActionDelete, Source: e.Path, Size: e.Size})
+	case RunFinished:
+		n.summarize(e)
+	}
+}
+
+// file sends a file that the rule with the given name in the directory with the given label moved or deleted to the
+// webhooks that want every file.
+func (n *notifier) file(moment time.Time, directory string, rule string, action ReportAction) {
+	payload := WebhookPayload{Event: WebhookEventFile, RunID: n.options.runID, Time: moment, Directory: directory, Rule: rule, File: &action}
+	for _, webhooks := range [][]*Webhook{n.run, n.rules[ruleKey{directory: directory, rule: rule}]} {
+		for _, webhook := range webhooks {
+			if webhook.events == WebhookEventsFiles {
+				n.send(webhook, payload, directory+"/"+rule)
+			}
+		}
+	}
+}
+
+// summarize sends the report of a finished run to the top-level webhooks that want summaries, and the report of each
+// rule that matched files or failed to its own.
+func (n *notifier) summarize(finished RunFinished) {
+	report := n.reporter.Report()
+	if report == nil {
+		return
+	}
+	for _, webhook := range n.run {
+		if webhook.events == WebhookEventsSummary {
+			n.send(webhook, WebhookPayload{Event: WebhookEventRun, RunID: report.RunID, Time: finished.Time, Run: report}, "")
+		}
+	}
+	for i := range report.Directories {
+		d := &report.Directories[i]
+		for j := range d.Rules {
+			rule := &d.Rules[j]
+			if rule.Totals.Matched == 0 && rule.Totals.Errors == 0 {
+				continue
+			}
+			for _, webhook := range n.rules[ruleKey{directory: d.Name, rule: rule.Name}] {
+				if webhook.events == WebhookEventsSummary {
+					n.send(webhook, WebhookPayload{Event: WebhookEventRule, RunID: report.RunID, Time: finished.Time, Directory: d.Name, Rule: rule.Name, Summary: rule}, d.Name+"/"+rule.Name)
+				}
+			}
+		}
+	}
+}
+
+// send queues a payload to be sent to a webhook in the background (see notifier.deliver), which logs how it went. label
+// is the label of the rule the payload is about, if it's about one.
+func (n *notifier) send(webhook *Webhook, payload WebhookPayload, label string) {
+	entry := LogEntry{Level: LevelInfo, Action: ActionWebhook, Directory: payload.Directory, Rule: label, Destination: webhook.displayURL()}
+	if payload.File != nil {
+		entry.Source = payload.File.Source
+	}
+	if n.options.dryRun() {
+		entry.Message = "Would send the " + payload.Event + " webhook to " + webhook.displayURL() + "."
+		n.options.log(entry)
+		return
+	}
+	n.pending.Add(1)
+	n.mutex.Lock()
+	n.queue = append(n.queue, webhookDelivery{webhook: webhook, payload: payload, entry: entry})
+	start := n.senders < webhookConcurrency
+	if start {
+		n.senders++
+	}
+	n.mutex.Unlock()
+	if start {
+		go n.deliver()
+	}
+}
+
+// deliver sends the queued payloads one by one until the queue is empty.
+func (n *notifier) deliver() {
+	for {
+		n.mutex.Lock()
+		if len(n.queue) == 0 {
+			n.senders--
+			n.mutex.Unlock()
+			return
+		}
+		delivery := n.queue[0]
+		n.queue = n.queue[1:]
+		n.mutex.Unlock()
+
+		webhook, payload, entry := delivery.webhook, delivery.payload, delivery.entry
+		if err := webhook.Send(n.ctx, payload); err != nil {
+			entry.Level, entry.Err = LevelWarn, err
+			entry.Message = "Couldn't send the " + payload.Event + " webhook to " + webhook.displayURL() + "."
+		} else {
+			entry.Message = "Sent the " + payload.Event + " webhook to " + webhook.displayURL() + "."
+		}
+		n.options.log(entry)
+		n.pending.Done()
+	}
+}
+
+// begin gets the notifier ready to send the payloads of a new run.
+func (n *notifier) begin() {
+	n.ctx, n.cancel = context.WithCancel(context.Background())
+}
+
+// wait waits until every payload of the run has been sent (or given up on). The payloads are sent with a context of
+// their own, so that the summary of a run that was interrupted can still be sent, but once the run's ctx is done they
+// only get webhookGracePeriod more before they're cancelled.
+func (n *notifier) wait(ctx context.Context) {
+	defer n.cancel()
+	sent := make(chan struct{})
+	go func() {
+		n.pending.Wait()
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		return
+	case <-ctx.Done():
+	}
+	select {
+	case <-sent:
+	case <-time.After(webhookGracePeriod):
+		n.cancel()
+		<-sent
+	}
+}
@@ -0,0 +1,246 @@
+package dirculese
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhook_Send(t *testing.T) {
+	var requests []*http.Request
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		if len(requests) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	webhook, err := GetWebhook(WebhookConfig{URL: server.URL, Secret: "hunter2", Retries: 1, Headers: map[string]string{"Authorization": "Bearer token"}})
+	if err != nil {
+		t.Fatalf("GetWebhook returned an error. Got '%v'", err)
+	}
+	webhook.backoff = time.Millisecond
+	payload := WebhookPayload{Event: WebhookEventRun, RunID: "abc", Run: &Report{Result: RunResultSuccess}}
+	if err = webhook.Send(context.Background(), payload); err != nil {
+		t.Fatalf("Send returned an error. Got '%v'", err)
+	}
+
+	// the first request failed with a 500, so it was retried
+	if len(requests) != 2 || bodies[0] != bodies[1] {
+		t.Fatalf("Mismatch in the requests. Got '%v'", bodies)
+	}
+	request := requests[1]
+	if request.Method != http.MethodPost || request.Header.Get("Content-Type") != "application/json" || request.Header.Get(WebhookEventHeader) != WebhookEventRun {
+		t.Errorf("Mismatch in the request. Got '%v %v'", request.Method, request.Header)
+	}
+	if request.Header.Get("Authorization") != "Bearer token" {
+		t.Errorf("The custom header wasn't sent. Got '%v'", request.Header)
+	}
+	if got := request.Header.Get(WebhookSignatureHeader); got != SignWebhookBody("hunter2", []byte(bodies[1])) || !strings.HasPrefix(got, "sha256=") {
+		t.Errorf("Mismatch in the signature. Got '%v'", got)
+	}
+	var decoded WebhookPayload
+	if err = json.Unmarshal([]byte(bodies[1]), &decoded); err != nil || decoded.RunID != "abc" || decoded.Run == nil || decoded.Run.Result != RunResultSuccess {
+		t.Errorf("Mismatch in the body. Got '%v' (%v)", bodies[1], err)
+	}
+
+	// client errors aren't retried
+	webhook.retries = 3
+	webhook.backoff = time.Hour
+	webhook.url = server.URL + "/missing"
+	if err = webhook.Send(context.Background(), payload); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Send didn't return the error of the response. Got '%v'", err)
+	}
+
+	// the headers of the webhook can replace its content type
+	webhook, _ = GetWebhook(WebhookConfig{URL: server.URL, Headers: map[string]string{"content-type": "application/x-www-form-urlencoded"}, Body: "run={{.RunID}}"})
+	if err = webhook.Send(context.Background(), payload); err != nil {
+		t.Fatalf("Send returned an error. Got '%v'", err)
+	}
+	if got := requests[len(requests)-1].Header.Get("Content-Type"); got != "application/x-www-form-urlencoded" || bodies[len(bodies)-1] != "run=abc" {
+		t.Errorf("Mismatch in the content type. Got '%v' for '%v'", got, bodies[len(bodies)-1])
+	}
+}
+
+func TestWebhook_SendTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	webhook, _ := GetWebhook(WebhookConfig{URL: server.URL})
+	if webhook.timeout != DefaultWebhookTimeout || webhook.events != WebhookEventsSummary {
+		t.Errorf("Mismatch in the defaults. Got '%+v'", webhook)
+	}
+	if capped, _ := GetWebhook(WebhookConfig{URL: server.URL, Retries: 100}); capped.retries != MaxWebhookRetries {
+		t.Errorf("Mismatch in retries. Got '%v', want '%v'", capped.retries, MaxWebhookRetries)
+	}
+	webhook.timeout = 20 * time.Millisecond
+	if err := webhook.Send(context.Background(), WebhookPayload{Event: WebhookEventRun}); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Send didn't time out. Got '%v'", err)
+	}
+}
+
+func TestWebhook_Body(t *testing.T) {
+	webhook, err := GetWebhook(WebhookConfig{Body: `{"text": {{json (printf "%s moved %s (%s)" .Rule (base .File.Source) (bytes .File.Size))}}}`})
+	if err != nil {
+		t.Fatalf("GetWebhook returned an error. Got '%v'", err)
+	}
+	body, err := webhook.render(WebhookPayload{Event: WebhookEventFile, Rule: "images", File: &ReportAction{Source: "/downloads/\"a\".png", Size: 2048}})
+	if err != nil {
+		t.Fatalf("render returned an error. Got '%v'", err)
+	}
+	if want := `{"text": "images moved \"a\".png (2.0 KB)"}`; string(body) != want {
+		t.Errorf("Mismatch in the body. Got '%v', want '%v'", string(body), want)
+	}
+	if _, err = webhook.render(WebhookPayload{Event: WebhookEventRun}); err == nil {
+		t.Error("render didn't return the error of the template")
+	}
+	if got := webhook.contentType(body); got != "application/json" {
+		t.Errorf("Mismatch in the content type of a JSON body. Got '%v'", got)
+	}
+	if got := webhook.contentType([]byte("images moved a.png")); got != "text/plain; charset=utf-8" {
+		t.Errorf("Mismatch in the content type of a plain text body. Got '%v'", got)
+	}
+	if _, err = GetWebhook(WebhookConfig{Body: "{{.Rule"}); err == nil {
+		t.Error("GetWebhook accepted an invalid template")
+	}
+	if webhooks := GetWebhooks([]WebhookConfig{{Body: "{{.Rule"}, {URL: "http://localhost"}}); len(webhooks) != 1 {
+		t.Errorf("GetWebhooks didn't leave out the invalid webhook. Got '%v'", webhooks)
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	var mutex sync.Mutex
+	received := make(map[string][]WebhookPayload)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload WebhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		mutex.Lock()
+		received[r.URL.Path] = append(received[r.URL.Path], payload)
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	fs := NewMemFS()
+	fs.MkdirAll("/downloads", 0755)
+	fs.MkdirAll("/images", 0755)
+	fs.WriteFile("/downloads/a.png", 100, 0644)
+	fs.WriteFile("/downloads/b.png", 20, 0644)
+	fs.WriteFile("/downloads/c.txt", 5, 0644)
+	config := DirectoriesConfig{
+		Webhooks: []WebhookConfig{{URL: server.URL + "/run"}},
+		Directories: []DirectoryConfig{{
+			Path: "/downloads",
+			Name: "downloads",
+			Rules: []RuleConfig{
+				{Name: "images", Handler: "ExtensionHandler", Extensions: []string{"png"}, Target: "/images", Webhooks: []WebhookConfig{
+					{URL: server.URL + "/files", Events: WebhookEventsFiles},
+					{URL: server.URL + "/images"},
+				}},
+				{Name: "text", Handler: "ExtensionHandler", Extensions: []string{"txt"}, Delete: true},
+				{Name: "documents", Handler: "ExtensionHandler", Extensions: []string{"pdf"}, Target: "/images", Webhooks: []WebhookConfig{{URL: server.URL + "/documents"}}},
+			},
+		}},
+	}
+
+	// nothing is sent during a dry run
+	logger := &recorder{}
+	engine, err := New(config, Options{FS: fs, Logger: logger, DryRun: true})
+	if err != nil {
+		t.Fatalf("New returned an error. Got '%v'", err)
+	}
+	if err = engine.Run(context.Background()); err != nil {
+		t.Fatalf("Run returned an error during the dry run. Got '%v'", err)
+	}
+	if len(received) != 0 || !strings.Contains(strings.Join(logger.messages, "\n"), "Would send the file webhook to "+server.URL+".") {
+		t.Errorf("Mismatch in the dry run's webhooks. Got '%v' and '%v'", received, logger.messages)
+	}
+
+	engine, err = New(config, Options{FS: fs})
+	if err != nil {
+		t.Fatalf("New returned an error. Got '%v'", err)
+	}
+	if err = engine.Run(context.Background()); err != nil {
+		t.Fatalf("Run returned an error. Got '%v'", err)
+	}
+
+	// Run waits for the webhooks, so they've all been received
+	if run := received["/run"]; len(run) != 1 || run[0].Event != WebhookEventRun || run[0].Run == nil || run[0].Run.Totals.Moved != 2 || run[0].Run.Totals.Deleted != 1 {
+		t.Errorf("Mismatch in the run's summary. Got '%+v'", run)
+	}
+	files := received["/files"]
+	if len(files) != 2 || files[0].Event != WebhookEventFile || files[0].Directory != "downloads" || files[0].Rule != "images" || files[0].File == nil {
+		t.Fatalf("Mismatch in the files of the images rule. Got '%+v'", files)
+	}
+	if sources := files[0].File.Source + "," + files[1].File.Source; sources != "/downloads/a.png,/downloads/b.png" && sources != "/downloads/b.png,/downloads/a.png" {
+		t.Errorf("Mismatch in the files of the images rule. Got '%v'", sources)
+	}
+	if images := received["/images"]; len(images) != 1 || images[0].Event != WebhookEventRule || images[0].Summary == nil || images[0].Summary.Totals.Moved != 2 {
+		t.Errorf("Mismatch in the summary of the images rule. Got '%+v'", images)
+	}
+	// the documents rule didn't match anything, so it doesn't get a summary
+	if documents := received["/documents"]; len(documents) != 0 {
+		t.Errorf("The documents rule was sent a summary. Got '%+v'", documents)
+	}
+}
+
+func TestNotifier_Interrupted(t *testing.T) {
+	release := make(chan struct{})
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	defer func(grace time.Duration) { webhookGracePeriod = grace }(webhookGracePeriod)
+	webhookGracePeriod = 50 * time.Millisecond
+
+	fs := NewMemFS()
+	fs.MkdirAll("/downloads", 0755)
+	config := DirectoriesConfig{
+		Webhooks:    []WebhookConfig{{URL: server.URL, Timeout: 60, Retries: 3}},
+		Directories: []DirectoryConfig{{Path: "/downloads", Rules: []RuleConfig{{Handler: "ExtensionHandler", Extensions: []string{"png"}, Delete: true}}}},
+	}
+	engine, err := New(config, Options{FS: fs})
+	if err != nil {
+		t.Fatalf("New returned an error. Got '%v'", err)
+	}
+
+	// the summary of an interrupted run is still sent, but Run only waits for it a little while
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	started := time.Now()
+	engine.Run(ctx)
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Run waited too long for the webhook of an interrupted run. Got '%v'", elapsed)
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("Mismatch in the requests that were sent. Got '%v', want '1'", atomic.LoadInt32(&requests))
+	}
+}
+
+func TestWebhook_displayURL(t *testing.T) {
+	webhook, _ := GetWebhook(WebhookConfig{URL: "https://hooks.example.com/services/T000/B000/secret?token=1"})
+	if got := webhook.displayURL(); got != "https://hooks.example.com" {
+		t.Errorf("Mismatch in the URL that's logged. Got '%v'", got)
+	}
+}
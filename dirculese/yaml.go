@@ -0,0 +1,542 @@
+package dirculese
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a single line of a YAML document that has some content, along with the comments that came right before
+// it. yamlLine.indent is the number of spaces before the content and yamlLine.text is the content itself, without any
+// trailing comment.
+type yamlLine struct {
+	number   int
+	indent   int
+	text     string
+	comments []string
+}
+
+// yamlParser builds the tree returned by ParseYAMLConfigTree from the lines of a YAML document.
+type yamlParser struct {
+	lines     []yamlLine
+	current   int
+	positions map[string]ConfigPosition
+	comments  map[string][]string
+}
+
+// ParseYAMLConfigTree parses the contents of a YAML configuration file into the same kind of tree as
+// ParseJSONConfigTree, along with the position of every field and list item and the comments that came right before
+// them. It understands the parts of YAML that a configuration file needs: block mappings and sequences, flow sequences
+// and mappings (which may span several lines), quoted and plain scalars that fit on one line, and comments. Anchors,
+// aliases, tags, block scalars, complex keys, directives and files with more than one document are not supported, and
+// are reported as errors.
+func ParseYAMLConfigTree(data []byte) (tree interface{}, positions map[string]ConfigPosition, comments map[string][]string, err error) {
+	parser := yamlParser{positions: make(map[string]ConfigPosition), comments: make(map[string][]string)}
+	lines := strings.Split(string(data), "\n")
+	var pending []string
+	for i := 0; i < len(lines); i++ {
+		number := i + 1
+		content, comment, hasComment := splitComment(strings.TrimRight(lines[i], "\r"), true)
+		trimmed := strings.TrimSpace(content)
+		if trimmed == "" {
+			if hasComment {
+				pending = append(pending, comment)
+			}
+			continue
+		}
+		if trimmed == "---" && len(parser.lines) == 0 {
+			continue
+		}
+		if trimmed == "..." {
+			break
+		}
+		indent := len(content) - len(strings.TrimLeft(content, " \t"))
+		if message := unsupportedYAML(content, trimmed, indent); message != "" {
+			return nil, nil, nil, ConfigErrors{{Line: number, Column: indent + 1, Message: message}}
+		}
+		text := strings.TrimRight(content[indent:], " \t")
+		// flow sequences and mappings can continue on the following lines
+		for yamlFlowDepth(text) > 0 && i+1 < len(lines) {
+			i++
+			next, _, _ := splitComment(strings.TrimRight(lines[i], "\r"), true)
+			text += " " + strings.TrimSpace(next)
+		}
+		parser.lines = append(parser.lines, yamlLine{number: number, indent: indent, text: text, comments: pending})
+		pending = nil
+	}
+	if len(parser.lines) == 0 {
+		return nil, parser.positions, parser.comments, nil
+	}
+
+	parser.positions[""] = ConfigPosition{Line: parser.lines[0].number, Column: parser.lines[0].indent + 1}
+	tree, err = parser.block(parser.lines[0].indent, "")
+	if err == nil && parser.current < len(parser.lines) {
+		err = parser.errorAt(parser.lines[parser.current], "unexpected indentation")
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return tree, parser.positions, parser.comments, nil
+}
+
+// unsupportedYAML returns an error message if a line with some content uses a part of YAML that ParseYAMLConfigTree
+// doesn't support outside of its values (which are checked by yamlParser.scalar), or an empty string if it doesn't.
+func unsupportedYAML(content string, trimmed string, indent int) string {
+	switch {
+	case strings.Contains(content[:indent], "\t"):
+		return "tabs can't be used for indentation"
+	case trimmed == "---":
+		return "only one document per file is supported"
+	case indent == 0 && strings.HasPrefix(trimmed, "%"):
+		return "directives aren't supported"
+	case trimmed == "?" || strings.HasPrefix(trimmed, "? "):
+		return "complex keys aren't supported"
+	}
+	return ""
+}
+
+// yamlFlowDepth returns how many flow sequences and mappings are left open at the end of a line's content, if its value
+// (after any dashes and key) starts with one. Brackets inside quoted strings don't count.
+func yamlFlowDepth(text string) (depth int) {
+	for isYAMLSequenceItem(text) {
+		text = strings.TrimLeft(text[1:], " ")
+	}
+	if _, rest, ok := splitYAMLKey(text); ok {
+		text = rest
+	}
+	if text == "" || (text[0] != '[' && text[0] != '{') {
+		return 0
+	}
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"', '\'':
+			end := closingQuote(text[i:])
+			if end < 0 {
+				return 0
+			}
+			i += end
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		}
+	}
+	return
+}
+
+// errorAt returns a ConfigErrors list with a single error that points to the start of a line.
+func (p *yamlParser) errorAt(line yamlLine, message string) error {
+	return ConfigErrors{{Line: line.number, Column: line.indent + 1, Message: message}}
+}
+
+// block parses the mapping, sequence or scalar that starts on the current line, which is found at configPath.
+func (p *yamlParser) block(indent int, configPath string) (value interface{}, err error) {
+	line := p.lines[p.current]
+	if isYAMLSequenceItem(line.text) {
+		return p.sequence(indent, configPath)
+	}
+	if _, _, ok := splitYAMLKey(line.text); ok {
+		return p.mapping(indent, configPath)
+	}
+	p.current++
+	return p.scalar(line, line.text)
+}
+
+// mapping parses a block mapping whose keys are all indented by indent spaces.
+func (p *yamlParser) mapping(indent int, configPath string) (value interface{}, err error) {
+	object := make(map[string]interface{})
+	for p.current < len(p.lines) {
+		line := p.lines[p.current]
+		if line.indent < indent {
+			break
+		}
+		key, rest, ok := splitYAMLKey(line.text)
+		if line.indent > indent {
+			return nil, p.errorAt(line, "unexpected indentation (values other than flow sequences and mappings have to fit on one line)")
+		}
+		if !ok {
+			return nil, p.errorAt(line, "expected a \"key: value\" pair")
+		}
+		if _, duplicate := object[key]; duplicate {
+			return nil, p.errorAt(line, "the key \""+key+"\" is used more than once")
+		}
+		fieldPath := joinConfigPath(configPath, key)
+		p.positions[fieldPath] = ConfigPosition{Line: line.number, Column: line.indent + 1}
+		if len(line.comments) > 0 {
+			p.comments[fieldPath] = line.comments
+		}
+		p.current++
+
+		switch {
+		case rest != "":
+			object[key], err = p.scalar(line, rest)
+		case p.current < len(p.lines) && p.lines[p.current].indent > indent:
+			object[key], err = p.block(p.lines[p.current].indent, fieldPath)
+		// sequences are allowed to be indented as much as the key they belong to
+		case p.current < len(p.lines) && p.lines[p.current].indent == indent && isYAMLSequenceItem(p.lines[p.current].text):
+			object[key], err = p.sequence(indent, fieldPath)
+		default:
+			object[key] = nil
+		}
+		if err != nil {
+			return
+		}
+	}
+	return object, nil
+}
+
+// sequence parses a block sequence whose items are all indented by indent spaces.
+func (p *yamlParser) sequence(indent int, configPath string) (value interface{}, err error) {
+	list := make([]interface{}, 0)
+	for p.current < len(p.lines) {
+		line := p.lines[p.current]
+		if line.indent < indent || (line.indent == indent && !isYAMLSequenceItem(line.text)) {
+			break
+		}
+		if line.indent > indent {
+			return nil, p.errorAt(line, "unexpected indentation")
+		}
+		itemPath := indexConfigPath(configPath, len(list))
+		p.positions[itemPath] = ConfigPosition{Line: line.number, Column: line.indent + 1}
+		if len(line.comments) > 0 {
+			p.comments[itemPath] = line.comments
+		}
+
+		var item interface{}
+		content := strings.TrimLeft(line.text[1:], " ")
+		_, _, isMapping := splitYAMLKey(content)
+		switch {
+		case content == "":
+			p.current++
+			if p.current < len(p.lines) && p.lines[p.current].indent > indent {
+				item, err = p.block(p.lines[p.current].indent, itemPath)
+			}
+		case isMapping || isYAMLSequenceItem(content):
+			// the item starts on the same line as its dash, so parse it as if it were on a line of its own
+			itemIndent := line.indent + len(line.text) - len(content)
+			p.lines[p.current] = yamlLine{number: line.number, indent: itemIndent, text: content}
+			item, err = p.block(itemIndent, itemPath)
+		default:
+			p.current++
+			item, err = p.scalar(line, content)
+		}
+		if err != nil {
+			return
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+// scalar parses the value text found on line, which is either a scalar or a flow sequence or mapping.
+func (p *yamlParser) scalar(line yamlLine, text string) (value interface{}, err error) {
+	switch text[0] {
+	case '|', '>':
+		return nil, p.errorAt(line, "block scalars aren't supported (use a quoted string instead)")
+	case '&', '*', '!':
+		return nil, p.errorAt(line, "anchors, aliases and tags aren't supported")
+	}
+	if !strings.ContainsAny(text[:1], "[{\"'") {
+		// a plain scalar outside of a flow collection runs to the end of the line (the comment is already gone)
+		if value, err = parseYAMLScalar(strings.TrimSpace(text)); err != nil {
+			return nil, p.errorAt(line, err.Error())
+		}
+		return
+	}
+	value, rest, err := parseYAMLFlow(text)
+	if err == nil && strings.TrimSpace(rest) != "" {
+		err = errors.New("unexpected \"" + strings.TrimSpace(rest) + "\" after the value")
+	}
+	if err != nil {
+		return nil, p.errorAt(line, err.Error())
+	}
+	return
+}
+
+// isYAMLSequenceItem reports whether a line's content is a block sequence item.
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits a line's content into a mapping key and the rest of the line after the colon. It reports false
+// if the content isn't a "key: value" pair.
+func splitYAMLKey(text string) (key string, rest string, ok bool) {
+	end := 0
+	if text != "" && (text[0] == '"' || text[0] == '\'') {
+		end = closingQuote(text)
+		if end < 0 {
+			return
+		}
+		end++
+	}
+	for i := end; i < len(text); i++ {
+		if text[i] == ':' && (i == len(text)-1 || text[i+1] == ' ') {
+			key = strings.TrimSpace(text[:i])
+			if key == "" || strings.ContainsAny(key[:1], "[{") {
+				return "", "", false
+			}
+			if unquoted, err := parseYAMLScalar(key); err == nil && (key[0] == '"' || key[0] == '\'') {
+				key = unquoted.(string)
+			}
+			return key, strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return
+}
+
+// parseYAMLFlow parses a single scalar, flow sequence or flow mapping at the start of text and returns it along with
+// the rest of the text.
+func parseYAMLFlow(text string) (value interface{}, rest string, err error) {
+	text = strings.TrimLeft(text, " ")
+	if text == "" {
+		return nil, "", nil
+	}
+	switch text[0] {
+	case '[', '{':
+		closing := "]"
+		if text[0] == '{' {
+			closing = "}"
+		}
+		list := make([]interface{}, 0)
+		object := make(map[string]interface{})
+		rest = strings.TrimLeft(text[1:], " ")
+		for !strings.HasPrefix(rest, closing) {
+			if text[0] == '{' {
+				var key interface{}
+				key, rest, err = parseYAMLFlowScalar(rest, ":")
+				if err != nil || !strings.HasPrefix(rest, ":") {
+					return nil, "", errors.New("expected a \"key: value\" pair inside {}")
+				}
+				object[toString(key)], rest, err = parseYAMLFlow(rest[1:])
+			} else {
+				var item interface{}
+				item, rest, err = parseYAMLFlow(rest)
+				list = append(list, item)
+			}
+			if err != nil {
+				return
+			}
+			rest = strings.TrimLeft(rest, " ")
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimLeft(rest[1:], " ")
+			} else if !strings.HasPrefix(rest, closing) {
+				return nil, "", errors.New("expected \",\" or \"" + closing + "\"")
+			}
+		}
+		if text[0] == '{' {
+			return object, rest[1:], nil
+		}
+		return list, rest[1:], nil
+	}
+	return parseYAMLFlowScalar(text, ",]}")
+}
+
+// parseYAMLFlowScalar parses a quoted or plain scalar at the start of text. Plain scalars end at any of the characters
+// in terminators.
+func parseYAMLFlowScalar(text string, terminators string) (value interface{}, rest string, err error) {
+	text = strings.TrimLeft(text, " ")
+	end := len(text)
+	if text != "" && (text[0] == '"' || text[0] == '\'') {
+		end = closingQuote(text)
+		if end < 0 {
+			return nil, "", errors.New("unterminated quoted string")
+		}
+		end++
+	} else if i := strings.IndexAny(text, terminators); i >= 0 {
+		end = i
+	}
+	value, err = parseYAMLScalar(strings.TrimSpace(text[:end]))
+	return value, text[end:], err
+}
+
+// parseYAMLScalar converts a single YAML scalar into a string, bool, json.Number or nil.
+func parseYAMLScalar(text string) (value interface{}, err error) {
+	switch {
+	case strings.HasPrefix(text, "\""):
+		return strconv.Unquote(text)
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || closingQuote(text) != len(text)-1 {
+			return nil, errors.New("unterminated quoted string")
+		}
+		return strings.Replace(text[1:len(text)-1], "''", "'", -1), nil
+	}
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if number, ok := parseNumber(text); ok {
+		return number, nil
+	}
+	return text, nil
+}
+
+// parseNumber converts text into a json.Number if it's an integer or a decimal number.
+func parseNumber(text string) (number json.Number, ok bool) {
+	if strings.Trim(text, "+-0123456789.eE") != "" || strings.Trim(text, "+-.eE") == "" {
+		return
+	}
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return json.Number(strconv.FormatInt(i, 10)), true
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil {
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), true
+	}
+	return
+}
+
+// closingQuote returns the index of the quote that closes the quoted string at the start of text, or -1 if there isn't
+// one. Double-quoted strings use backslash escapes and single-quoted strings escape quotes by doubling them.
+func closingQuote(text string) int {
+	for i := 1; i < len(text); i++ {
+		switch {
+		case text[0] == '"' && text[i] == '\\':
+			i++
+		case text[i] == text[0] && text[0] == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == text[0]:
+			return i
+		}
+	}
+	return -1
+}
+
+// splitComment splits a line into its content and the text of its trailing comment, ignoring any # characters inside
+// quoted strings. If needSpace is true (as in YAML), a # only starts a comment at the start of the line or after
+// whitespace.
+func splitComment(line string, needSpace bool) (content string, comment string, hasComment bool) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"', '\'':
+			if needSpace && i > 0 && line[i-1] != ' ' && !strings.ContainsRune("[{,:-", rune(line[i-1])) {
+				continue
+			}
+			end := closingQuote(line[i:])
+			if end < 0 {
+				return line, "", false
+			}
+			i += end
+		case '#':
+			if !needSpace || i == 0 || line[i-1] == ' ' || line[i-1] == '\t' {
+				comment = strings.TrimPrefix(line[i+1:], " ")
+				return line[:i], strings.TrimRight(comment, " \t\r"), true
+			}
+		}
+	}
+	return line, "", false
+}
+
+// toString converts a scalar from a configuration tree back into a string.
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// WriteYAMLConfigTree writes a configuration tree to w as YAML. Fields are written in the order they're declared in the
+// Go type t, and the comments (keyed by configuration path) are written right before the fields and list items they
+// belong to.
+func WriteYAMLConfigTree(w io.Writer, tree interface{}, t reflect.Type, comments map[string][]string) (err error) {
+	var lines []string
+	writeComments(&lines, comments[""], "", "#")
+	if object, ok := tree.(map[string]interface{}); ok && len(object) > 0 {
+		writeYAMLMapping(&lines, object, t, "", "", comments)
+	} else {
+		lines = append(lines, yamlScalar(tree))
+	}
+	_, err = io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return
+}
+
+// writeYAMLMapping adds the lines of a block mapping, indented by indent, to lines.
+func writeYAMLMapping(lines *[]string, object map[string]interface{}, t reflect.Type, indent string, configPath string, comments map[string][]string) {
+	for _, key := range orderedKeys(object, t) {
+		fieldPath := joinConfigPath(configPath, key)
+		writeComments(lines, comments[fieldPath], indent, "#")
+		yamlKey := yamlScalar(key)
+		switch value := object[key].(type) {
+		case map[string]interface{}:
+			if len(value) == 0 {
+				*lines = append(*lines, indent+yamlKey+": {}")
+				continue
+			}
+			*lines = append(*lines, indent+yamlKey+":")
+			writeYAMLMapping(lines, value, fieldType(t, key), indent+"  ", fieldPath, comments)
+		case []interface{}:
+			if len(value) == 0 {
+				*lines = append(*lines, indent+yamlKey+": []")
+				continue
+			}
+			*lines = append(*lines, indent+yamlKey+":")
+			writeYAMLSequence(lines, value, fieldType(t, key), indent+"  ", fieldPath, comments)
+		default:
+			*lines = append(*lines, indent+yamlKey+": "+yamlScalar(value))
+		}
+	}
+}
+
+// writeYAMLSequence adds the lines of a block sequence, indented by indent, to lines.
+func writeYAMLSequence(lines *[]string, list []interface{}, t reflect.Type, indent string, configPath string, comments map[string][]string) {
+	for i, item := range list {
+		itemPath := indexConfigPath(configPath, i)
+		writeComments(lines, comments[itemPath], indent, "#")
+		var itemLines []string
+		switch value := item.(type) {
+		case map[string]interface{}:
+			if len(value) == 0 {
+				*lines = append(*lines, indent+"- {}")
+				continue
+			}
+			writeYAMLMapping(&itemLines, value, fieldType(t, ""), indent+"  ", itemPath, comments)
+		case []interface{}:
+			if len(value) == 0 {
+				*lines = append(*lines, indent+"- []")
+				continue
+			}
+			writeYAMLSequence(&itemLines, value, fieldType(t, ""), indent+"  ", itemPath, comments)
+		default:
+			*lines = append(*lines, indent+"- "+yamlScalar(value))
+			continue
+		}
+		// the first line of a nested mapping or sequence goes on the same line as the dash, after any comments
+		for j, itemLine := range itemLines {
+			if !strings.HasPrefix(strings.TrimLeft(itemLine, " "), "#") {
+				itemLines[j] = indent + "- " + itemLine[len(indent)+2:]
+				break
+			}
+		}
+		*lines = append(*lines, itemLines...)
+	}
+}
+
+// yamlScalar formats a scalar from a configuration tree as YAML, quoting strings that would otherwise be read back as
+// something else.
+func yamlScalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		parsed, err := parseYAMLScalar(v)
+		if err != nil || parsed != v || strings.TrimSpace(v) != v || strings.ContainsAny(v, "\n\t\"") ||
+			strings.Contains(v, ": ") || strings.Contains(v, " #") || strings.HasSuffix(v, ":") ||
+			strings.ContainsAny(v[:1], "-?:,[]{}#&*!|>'%@`") {
+			return strconv.Quote(v)
+		}
+		return v
+	}
+	return toString(value)
+}
@@ -0,0 +1,116 @@
+package dirculese
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAMLConfigTree(t *testing.T) {
+	data := []byte(`# organize downloads
+Directories:
+  - Path: "/tmp"
+    Hidden: Include # hidden files too
+    Rules:
+    # pictures
+    - Handler: ExtensionHandler
+      Description: Images, screenshots [and] {photos} # not the flow terminators
+      Extensions: [
+        png,  # pictures
+        'jp]g',
+        tar.gz,
+      ]
+      SizeMax: 10
+      Delete: true
+      Target: ~
+`)
+	tree, positions, comments, err := ParseYAMLConfigTree(data)
+	if err != nil {
+		t.Fatalf("Couldn't parse valid YAML. Got '%v'", err)
+	}
+	directory := tree.(map[string]interface{})["Directories"].([]interface{})[0].(map[string]interface{})
+	rule := directory["Rules"].([]interface{})[0].(map[string]interface{})
+	if directory["Path"] != "/tmp" || directory["Hidden"] != "Include" {
+		t.Errorf("Mismatch in directory. Got '%v'", directory)
+	}
+	want := map[string]interface{}{
+		"Handler":     "ExtensionHandler",
+		"Description": "Images, screenshots [and] {photos}",
+		"Extensions":  []interface{}{"png", "jp]g", "tar.gz"},
+		"SizeMax":     json.Number("10"),
+		"Delete":      true,
+		"Target":      nil,
+	}
+	if !reflect.DeepEqual(rule, want) {
+		t.Errorf("Mismatch in rule. Got '%v', want '%v'", rule, want)
+	}
+
+	wantPositions := map[string]ConfigPosition{
+		"Directories":                     {Line: 2, Column: 1},
+		"Directories[0]":                  {Line: 3, Column: 3},
+		"Directories[0].Path":             {Line: 3, Column: 5},
+		"Directories[0].Rules[0]":         {Line: 7, Column: 5},
+		"Directories[0].Rules[0].SizeMax": {Line: 14, Column: 7},
+	}
+	for configPath, position := range wantPositions {
+		if positions[configPath] != position {
+			t.Errorf("Mismatch in the position of %v. Got '%v', want '%v'", configPath, positions[configPath], position)
+		}
+	}
+	if strings.Join(comments["Directories"], ",") != "organize downloads" || strings.Join(comments["Directories[0].Rules[0]"], ",") != "pictures" {
+		t.Errorf("Mismatch in comments. Got '%v'", comments)
+	}
+
+	bad := map[string]int{
+		"Directories:\n  - Path: /tmp\n   Rules: x\n": 3,
+		"Directories:\n\t- Path: /tmp\n":              2,
+		"Path: |\n  text\n":                           1,
+		"Path: 'unterminated\n":                       1,
+		"Extensions: [png,\n  jpg\nPath: /tmp\n":      1,
+		"Stability: &defaults\n  SettleTime: 5\n":     1,
+		"Directories:\n  - *downloads\n":              2,
+		"Path: /tmp\n---\nPath: /home\n":              2,
+		"%YAML 1.2\n---\nPath: /tmp\n":                1,
+		"? Path\n: /tmp\n":                            1,
+		"Description: a long\n  description\n":        2,
+		"Extensions: [png, jpg] tar\n":                1,
+	}
+	for document, line := range bad {
+		_, _, _, err = ParseYAMLConfigTree([]byte(document))
+		errs, ok := err.(ConfigErrors)
+		if !ok || len(errs) != 1 || errs[0].Line != line {
+			t.Errorf("Error in %q wasn't reported on line %v. Got '%v'", document, line, err)
+		}
+	}
+}
+
+func TestWriteYAMLConfigTree(t *testing.T) {
+	data := []byte(`Directories:
+  # downloads
+  - Path: /tmp
+    Rules:
+      - Handler: ExtensionHandler
+        Extensions:
+          - png
+          - "null"
+        PrefixDelimiters:
+          - "- "
+        Command:
+          Path: /bin/echo
+          Args: []
+`)
+	tree, _, comments, err := ParseYAMLConfigTree(data)
+	if err != nil {
+		t.Fatalf("Couldn't parse valid YAML. Got '%v'", err)
+	}
+	var output bytes.Buffer
+	err = WriteYAMLConfigTree(&output, tree, reflect.TypeOf(DirectoriesConfig{}), comments)
+	if err != nil {
+		t.Fatalf("Couldn't write YAML. Got '%v'", err)
+	}
+	if output.String() != string(data) {
+		t.Errorf("Mismatch in output. Got '%v', want '%v'", output.String(), string(data))
+	}
+}
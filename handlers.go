@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/moismailzai/dirculese/dirculese"
+)
+
+// Handlers is the handlers command. It prints every handler that rules can use, what it does, and the options it takes
+// in a rule's Options setting.
+func Handlers() (err error) {
+	for _, name := range dirculese.HandlerNames() {
+		handler, _ := dirculese.LookupHandler(name)
+		fmt.Println(name)
+		fmt.Println("    " + handler.Description())
+		options := dirculese.HandlerOptions(handler)
+		if len(options) == 0 {
+			fmt.Println("    Options: none")
+			continue
+		}
+		fmt.Println("    Options:")
+		for _, option := range options {
+			line := "      " + option.Name + " (" + option.Type + ")"
+			if option.Description != "" {
+				line += ": " + option.Description
+			}
+			fmt.Println(line)
+		}
+	}
+	return
+}
@@ -1,14 +1,56 @@
 /*
 dirculese organizes your directories so you don't have to.
 Usage:
-	dirculese [flag]
+	dirculese [flag] [command] [flag]
+The commands are:
+	validate
+		check the configuration file and report every problem with it (without a command, dirculese organizes your
+		directories)
+	migrate
+		convert the configuration file into the format of the file given with the -output flag
+	init
+		ask which directories to organize and write a configuration file with rules suggested for them
+	paths
+		show where dirculese looks for its configuration file and which one is in effect, and where it logs to
+	handlers
+		list the handlers that rules can use and the options each of them takes
 The flags are:
 	-verbose
 		also print log messages to standard out and standard error
 	-config /full/path/to/your/config.json
 		the full path to a dirculese configuration file
+	-format json|yaml|toml
+		the format of the configuration file, if it can't be told from its extension
+	-output /full/path/to/your/new/config.yaml
+		the full path to the file that the migrate command writes to
+	-directories Downloads,Desktop
+		only organize the directories with these names (or paths)
+	-rules images,Downloads/documents
+		only run the rules with these names (optionally prefixed with the name of their directory)
+	-dry-run
+		only log what would be moved, deleted or run, without doing it
+	-time-budget 10m
+		stop the run after the file that is being handled once it has taken this long
+	-log-level debug|info|warn|error
+		only log messages of this level and above (info by default)
+	-log-format text|json
+		write the log as text (the default) or as one JSON object per line
+	-log-to file,stderr,syslog,journald
+		log to these places instead of the ones in the configuration file
+	-log-file /full/path/to/your/dirculese.log
+		the full path to the log file
+	-metrics-address localhost:9251
+		serve Prometheus metrics at /metrics on this address while dirculese runs
+	-metrics-file /full/path/to/your/dirculese.prom
+		write Prometheus metrics to this file after the run
+	-report /full/path/to/your/report.html
+		write a report of the run to this file, in Markdown (.md), HTML (.html) or JSON (.json)
 Before you can use dirculese, you will need to create a configuration file. By default, dirculese will try to load a
-file called .dirculese.json in your home directory. Here's what a basic configuration file looks like:
+file called config.json in ~/.config/dirculese (or $XDG_CONFIG_HOME/dirculese). The easiest way to create one is the
+init command, which asks which directories you want to organize, looks at the files that are in them and suggests rules
+for images, documents, archives, installers and screenshots:
+	dirculese init
+Here's what a basic configuration file looks like:
 	{
 	  "Directories": [
 		{
@@ -38,524 +80,307 @@ file called .dirculese.json in your home directory. Here's what a basic configur
 	}
 This configuration only has a single directory with a single rule, but you can have as many directories and rules as you
 want (dirculese will parse them in sequence).
-If want to place your configuration file somewhere else, just call dirculese with the -config flag:
+If want to place your configuration file somewhere else, just call dirculese with the -config flag (or set the
+DIRCULESE_CONFIG environment variable):
 	dirculese -config /full/path/to/your/config.json
+Otherwise, dirculese uses the first of these files that exists: config.json, config.yaml, config.yml or config.toml in
+$XDG_CONFIG_HOME/dirculese, then .dirculese.json, .dirculese.yaml, .dirculese.yml or .dirculese.toml in your home
+directory, then config.json, config.yaml, config.yml or config.toml in /etc/dirculese. The paths command shows every
+file dirculese looks for and which one is in effect:
+	dirculese paths
 By default, dirculese is very verbose about what it's doing, but you can tell it to be silent with the -silent flag:
 	dirculese -silent
-Even when running silently, dirculese logs everything to dirculese.log which it saves to your home directory.
+Even when running silently, dirculese logs everything to dirculese.log which it saves to ~/.local/state/dirculese (or
+$XDG_STATE_HOME/dirculese).
+Before organizing anything, dirculese checks your whole configuration file and refuses to run if it has problems
+(unknown fields, unrecognized handlers, missing settings, directories that don't exist and so on). You can run the same
+check yourself and see every problem at once, along with the line and column it was found on:
+	dirculese validate
+Configuration files can also be written in YAML (.yaml or .yml) or TOML (.toml), which allow comments. The migrate
+command converts a configuration file from one format to another, keeping its comments:
+	dirculese migrate -config ~/.dirculese.json -output ~/.config/dirculese/config.yaml
+Configuration files can include other configuration files with the top-level Include setting, define Variables that
+any setting can use as {var:NAME}, and define RuleTemplates that rules can start from with their Template setting. See
+https://github.com/moismailzai/dirculese for examples.
+Rules pick a handler with their Handler setting, and settings that only apply to their handler go in their Options.
+The handlers command lists every handler and the options it takes:
+	dirculese handlers
+Directories and rules can have a Name, which is used in every log message and error about them and by the -directories
+and -rules flags, a Description, and an Enabled setting that can be set to false to turn them off without removing
+them:
+	dirculese -rules images,screenshots
+Rules with a higher Priority run first. Setting a directory's Evaluation to FirstMatch reads it once and gives each file
+only to the first rule that matches it (rules with Continue set pass it on to the rules after them), and logs the files
+that no rule matched.
+Setting Workers at the top level of the configuration file lets dirculese organize independent directories, and the
+files matched by each rule, several at a time. Workers is the limit for the whole run, which is split between the
+directories that run at the same time and the files each of them handles.
+To see what dirculese would do without touching anything, use the -dry-run flag (along with -verbose to see it):
+	dirculese -dry-run -verbose
+If dirculese is interrupted (with Ctrl+C, or by a SIGTERM), it finishes the file it's handling, logs that it was
+interrupted and stops; sending the signal again stops it right away. The -time-budget flag stops a run the same way once
+it has taken too long, and the files that are left are organized the next time dirculese runs:
+	dirculese -time-budget 10m
+Every log message has a level and fields for the run, directory, rule, action, source, destination and error it's
+about. The -log-level flag hides the less important ones, and -log-format json makes the log easy for other programs to
+parse:
+	dirculese -log-level warn -log-format json
+The log file is rotated once it reaches 10 MB, and the five newest backups are kept. The Logging setting of the
+configuration file changes that, and can also send the log to standard error, syslog or journald instead of (or as
+well as) the file. The -log-to and -log-file flags take precedence over it:
+	dirculese -log-to file,journald -log-file /var/log/dirculese.log
+Prometheus metrics about the files that every rule matched, moved and deleted, the bytes it moved and deleted, its
+conflicts and failures, and how long runs take and when the last one succeeded, can be written to a file for the node
+exporter's textfile collector once the run is done, or served over HTTP for as long as the run takes:
+	dirculese -metrics-file /var/lib/node_exporter/textfile_collector/dirculese.prom
+The -report flag writes a report of the run once it's done, with what every directory and rule moved and deleted, how
+much space was reclaimed, and the conflicts, skipped files and errors along the way. The format is told from the file's
+extension: Markdown (.md), HTML (.html) or JSON (.json), whose version field only changes if its fields do:
+	dirculese -report ~/dirculese-report.html
+The Webhooks setting of the configuration file, or of a rule, POSTs a JSON summary of the run or rule to a URL once
+the run is done, or a request for every file that's moved or deleted, with retries, a timeout, an HMAC signature and
+an optional templated body:
+	"Webhooks": [{"URL": "http://localhost:8080/dirculese", "Secret": "...", "Retries": 3}]
+The organizing itself is done by the github.com/moismailzai/dirculese/dirculese package, which other programs can
+import.
 Dirculese returns an exit code of 0 if everything went well and an exit code of 1 if something went wrong.
 */
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"flag"
-	"io"
-	"io/ioutil"
+	"fmt"
 	"log"
 	"os"
-	"os/user"
-	"path"
-	"path/filepath"
+	"os/signal"
 	"strconv"
-	"strings"
-)
+	"syscall"
+	"time"
 
-// DefaultConfigFile is the name of the file in the user's home directory that dirculese will use for its configuration.
-// DefaultLogFile is the name of the file in the user's home directory that dirculese will log to.
-const (
-	DefaultConfigFile = ".dirculese.json"
-	DefaultLogFile    = "dirculese.log"
+	"github.com/moismailzai/dirculese/dirculese"
 )
 
 var (
-	flagConfig  string
-	flagVerbose bool
-	logStandard *log.Logger
-	logError    *log.Logger
+	flagConfig         string
+	flagDirectories    string
+	flagDryRun         bool
+	flagFormat         string
+	flagLogFile        string
+	flagLogFormat      string
+	flagLogLevel       string
+	flagLogTo          string
+	flagMetricsAddress string
+	flagMetricsFile    string
+	flagOutput         string
+	flagReport         string
+	flagRules          string
+	flagTimeBudget     time.Duration
+	flagVerbose        bool
+	logStandard        *dirculese.MultiLogger
+	logError           *dirculese.MultiLogger
+	logDestinations    *dirculese.MultiLogger
 )
 
+// Commands is the list of commands that dirculese understands, along with a short description of each one. Running
+// dirculese without a command organizes the configured directories.
+var Commands = map[string]string{
+	"validate": "check the configuration file and report every problem with it",
+	"migrate":  "convert the configuration file into the format of the file given with the -output flag",
+	"init":     "ask which directories to organize and write a configuration file with rules suggested for them",
+	"paths":    "show where dirculese looks for its configuration file and which one is in effect, and where it logs to",
+	"handlers": "list the handlers that rules can use and the options each of them takes",
+}
+
 func init() {
 	flag.StringVar(&flagConfig, "config", "", "the full path to a dirculese configuration file")
+	flag.StringVar(&flagFormat, "format", "", "the format of the configuration file (json, yaml or toml), if it can't be told from its extension")
+	flag.StringVar(&flagOutput, "output", "", "the full path to the file that the migrate command writes to")
+	flag.StringVar(&flagDirectories, "directories", "", "a comma-separated list of the names (or paths) of the only directories to organize")
+	flag.StringVar(&flagRules, "rules", "", "a comma-separated list of the names of the only rules to run")
 	flag.BoolVar(&flagVerbose, "verbose", false, "also print log messages to standard out and standard error")
-	flag.Parse()
-
-	// setup logging
-	userHome, _ := GetUserHome()
-	logFile, err := os.OpenFile(userHome+string(os.PathSeparator)+DefaultLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		log.Fatalln("Failed to open log file '"+DefaultLogFile+"': ", err.Error())
-	}
-
-	// also print log messages to standard out and standard error if the -verbose flag was used
-	if flagVerbose {
-		logStandard = log.New(io.MultiWriter(logFile, os.Stdout), "", log.Ldate|log.Ltime|log.Lshortfile)
-		logError = log.New(io.MultiWriter(logFile, os.Stderr), "", log.Ldate|log.Ltime|log.Lshortfile)
-	} else {
-		logStandard = log.New(logFile, "", log.Ldate|log.Ltime|log.Lshortfile)
-		logError = log.New(logFile, "", log.Ldate|log.Ltime|log.Lshortfile)
-	}
+	flag.BoolVar(&flagDryRun, "dry-run", false, "only log what would be moved, deleted or run, without doing it")
+	flag.StringVar(&flagLogLevel, "log-level", "info", "only log messages of this level (debug, info, warn or error) and above")
+	flag.StringVar(&flagLogFormat, "log-format", dirculese.LogFormatText, "the format of the log (text or json)")
+	flag.StringVar(&flagLogTo, "log-to", "", "a comma-separated list of the places to log to (file, stderr, syslog or journald), instead of the ones in the configuration file")
+	flag.StringVar(&flagLogFile, "log-file", "", "the full path to the log file, instead of dirculese.log in the state directory")
+	flag.StringVar(&flagMetricsAddress, "metrics-address", "", "serve Prometheus metrics at /metrics on this address (e.g. localhost:9251) while dirculese runs")
+	flag.StringVar(&flagMetricsFile, "metrics-file", "", "the full path to a file to write Prometheus metrics to after the run (e.g. for node_exporter's textfile collector)")
+	flag.StringVar(&flagReport, "report", "", "the full path to a file to write a report of the run to, in Markdown (.md), HTML (.html) or JSON (.json)")
+	flag.DurationVar(&flagTimeBudget, "time-budget", 0, "stop the run after the file that is being handled once it has taken this long (e.g. 10m)")
+
+	// discard log messages until SetupLogging is called
+	logStandard = dirculese.NewMultiLogger()
+	logError = dirculese.NewMultiLogger()
+	logDestinations = dirculese.NewMultiLogger()
 }
 
-// DirectoriesConfig is a simple struct that is used to map to the top-level array of directories in a dirculese JSON
-// configuration file.
-type DirectoriesConfig struct {
-	Directories []DirectoryConfig
-}
-
-// DirectoryConfig is a simple struct that is used to map to a single directory in a dirculese JSON configuration file.
-type DirectoryConfig struct {
-	Rules []RuleConfig
-	Path  string
-}
-
-// RuleConfig is a simple struct that is used to map to a single rule in a dirculese JSON configuration file.
-type RuleConfig struct {
-	Target           string
-	Delete           bool
-	Handler          string
-	Extensions       []string
-	PrefixDelimiters []string
-	SuffixDelimiters []string
-	SizeMax          int
-	SizeMin          int
-	DateMax          int
-	DateMin          int
-}
-
-// Directory is the basic type of a managed directory. Directories are managed based on the Rule items in the
-// Directory.rules slice, which are executed sequentially by Directory.Ruler(). The Directory.path string should be an
-// existing, accessible directory, which is validated by calling Directory.CheckPath()
-type Directory struct {
-	rules []Rule
-	path  string
-}
-
-// Rule defines a single criteria for managing a directory. Rule.source is a pointer to a Directory representation of
-// the source directory and Rule.target is a pointer to a Directory representation of the target directory. Any files in
-// the source directory that match the rule's criteria will be moved into the target directory, unless Rule.delete is
-// true, in which case the files will be deleted instead. Rule.handler is the name of the handler function that should
-// be used to execute the rule's logic, and is parsed by Rule.Handler().
-type Rule struct {
-	source           *Directory
-	target           *Directory
-	delete           bool
-	handler          string
-	extensions       []string
-	prefixDelimiters []string
-	suffixDelimiters []string
-	sizeMax          int
-	sizeMin          int
-	dateMax          int
-	dateMin          int
-}
-
-// CheckPath tests to see if a directory's d.path points to an existing directory on the filesystem.
-func (d *Directory) CheckPath() (err error) {
-	var fileInfo os.FileInfo
-	if d.path == "" {
-		return errors.New("empty paths are not valid")
-	}
-	fileInfo, err = os.Stat(d.path)
-	if err != nil {
-		return errors.New(err.Error())
-	}
-	if !fileInfo.IsDir() {
-		return errors.New(d.path + " is not a directory")
+// ParseCommandLine parses the command line flags and returns the command that dirculese should run, if any. Flags can
+// be given before or after the command.
+func ParseCommandLine(arguments []string) (command string, err error) {
+	err = flag.CommandLine.Parse(arguments)
+	if err != nil || flag.NArg() == 0 {
+		return
 	}
-	return
-}
-
-// Contents returns the contents of a directory's d.path.
-func (d *Directory) Contents() (contents []os.FileInfo, err error) {
-	contents, err = ioutil.ReadDir(d.path)
-	if err != nil {
-		err = errors.New(err.Error())
+	command = flag.Arg(0)
+	if _, ok := Commands[command]; !ok {
+		return "", errors.New("unrecognized command \"" + command + "\"")
 	}
-	return
-}
-
-// Ruler sequentially executes the individuals rules in a directory's d.rules slice.
-func (d *Directory) Ruler() (err error) {
-	for _, element := range d.rules {
-		err = element.Handler()
-		if err != nil {
-			return errors.New(err.Error())
-		}
+	err = flag.CommandLine.Parse(flag.Args()[1:])
+	if err == nil && flag.NArg() > 0 {
+		err = errors.New("unexpected argument \"" + flag.Arg(0) + "\"")
 	}
 	return
 }
 
-// Handler reads a rule's r.handler property and maps it to a predefined handler. This allows rules that are defined in
-// text configuration files to be easily mapped to handler methods.
-func (r *Rule) Handler() (err error) {
-	switch r.handler {
-	case "ExtensionHandler":
-		err = r.ExtensionHandler()
-	case "PrefixHandler":
-		err = r.PrefixHandler()
-	case "SuffixHandler":
-		err = r.SuffixHandler()
-	default:
-		err = errors.New("unrecognized handler")
-	}
-	return
+// interruptContext returns a context that is cancelled when dirculese receives SIGINT or SIGTERM, so that the run stops
+// cleanly after the file it's handling. Only the first signal is caught: sending another one stops dirculese right
+// away.
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		received := <-signals
+		signal.Stop(signals)
+		logError.Log(dirculese.LogEntry{Level: dirculese.LevelWarn, Action: dirculese.ActionStop, Message: "Received " + received.String() + ", stopping after the current file (send it again to stop right away)."})
+		cancel()
+	}()
+	return ctx
 }
 
-// ExtensionHandler iterates through all of the files in a rule's r.source directory, and if any file has an extension
-// that's listed in the r.extensions slice, it is either moved into the r.target directory or deleted, depending on the
-// boolean state of r.delete
-func (r *Rule) ExtensionHandler() (err error) {
-	if len(r.extensions) < 1 {
-		return errors.New("you need to specify at least one extension")
-	}
-
-	// make sure the path we're going to be moving items into exists and is accessible (only necessary if r.delete is
-	// false
-	if !r.delete {
-		err = r.target.CheckPath()
-		if err != nil {
-			return errors.New(err.Error())
-		}
-	}
-
-	// make a map of all the extensions so lookups are easier later
-	fileExtensions := make(map[string]string)
-	for _, extension := range r.extensions {
-		fileExtensions[extension] = extension
+// SetupLogging points the standard and error loggers at the log destinations in config (or the dirculese.log file, see
+// GetLogFilePath, if config is nil or doesn't have any), and also at standard out and standard error if the -verbose
+// flag was used. The -log-level, -log-format, -log-to and -log-file flags take precedence over config. Calling it again
+// (e.g. once the configuration file is loaded) closes the destinations that were opened before.
+func SetupLogging(config *dirculese.LoggingConfig) (err error) {
+	loggingConf := loggingFlags(config)
+	level, err := dirculese.ParseLevel(loggingConf.Level)
+	if err != nil {
+		return
 	}
-
-	// get a list of all the items in the directory we're managing
-	files, err := r.source.Contents()
+	destinations, err := dirculese.OpenLogDestinations(loggingConf)
 	if err != nil {
-		return errors.New(err.Error())
+		return
 	}
+	logDestinations.Close()
+	logDestinations, logStandard, logError = destinations, destinations, destinations
 
-	// for each item
-	for _, f := range files {
-		// if it's a file
-		if !f.IsDir() {
-			var message string
-			fileExtension := strings.TrimLeft(filepath.Ext(f.Name()), ".")
-			// and if this file's extension is in the map we created earlier
-			if _, extensionExists := fileExtensions[fileExtension]; extensionExists {
-				// if the delete flag is set, delete the file
-				if r.delete {
-					err = os.Remove(r.source.path + string(os.PathSeparator) + f.Name())
-					message = "Deleted the file " + f.Name() + " in the path " + r.source.path + "."
-				} else {
-					// otherwise, stat the full path of the new file we want to create
-					_, newFileLocationStatErr := os.Stat(r.target.path + string(os.PathSeparator) + f.Name())
-					// and check for an IsNotExist error, which means a file by that name doesn't already exist in the
-					// new location and we're safe to move it there
-					if os.IsNotExist(newFileLocationStatErr) {
-						err = os.Rename(r.source.path+string(os.PathSeparator)+f.Name(), r.target.path+string(os.PathSeparator)+f.Name())
-						message = "Moved the file " + f.Name() + " from the path " + r.source.path + " to " + r.target.path + "."
-					} else {
-						// if there was no error, it means a file by that name does already exist in the new location,
-						// so lets try appending numbers to the end of the filename and redo the stat check up to 9998
-						// times (which is an entirely arbitrary limit)
-						if newFileLocationStatErr == nil {
-							for i := 0; i < 9999; i++ {
-								appendedFileName := strings.TrimRight(f.Name(), filepath.Ext(f.Name())) + strconv.Itoa(i) + filepath.Ext(f.Name())
-								if _, e := os.Stat(r.target.path + string(os.PathSeparator) + appendedFileName); os.IsNotExist(e) {
-									err = os.Rename(r.source.path+string(os.PathSeparator)+f.Name(), r.target.path+string(os.PathSeparator)+appendedFileName)
-									message = "Moved the file " + f.Name() + " from the path " + r.source.path + " to " + r.target.path + " (renamed to " + appendedFileName + ") because a file with the same name already exists there."
-									break
-								}
-								if i == 9998 {
-									message = "Didn't move the file " + f.Name() + " from the path " + r.source.path + " to " + r.target.path + " because a file with the same name already exists there."
-								}
-							}
-							// if there was an error, let's register it as such
-						} else {
-							err = errors.New("Couldn't move the file " + f.Name() + " from the path " + r.source.path + " to " + r.target.path + " (" + newFileLocationStatErr.Error() + ").")
-						}
-					}
-				}
-				if err != nil {
-					return errors.New(err.Error())
-				}
-				logStandard.Println(message)
-			}
-		}
+	// also print log messages to standard out and standard error if the -verbose flag was used
+	if flagVerbose {
+		stdout, _ := dirculese.NewLogWriter(os.Stdout, loggingConf.Format, level)
+		stderr, _ := dirculese.NewLogWriter(os.Stderr, loggingConf.Format, level)
+		logStandard = destinations.With(stdout)
+		logError = destinations.With(stderr)
 	}
 	return
 }
 
-// PrefixHandler iterates through all of the files in a rule's r.source directory and handles any file whose name
-// portion (excluding extension) includes a substring that matches any member of the the r.prefixDelimiters slice.
-// Matching files are either deleted (depending on the boolean state of r.delete) or moved into a subdirectory of
-// r.target. The name of this subdirectory will be the portion of the filename that precedes the prefix delimiter and
-// the subdirectory will be automatically created if it does not already exist.
-func (r *Rule) PrefixHandler() (err error) {
-
-	if len(r.prefixDelimiters) == 0 {
-		return errors.New("you need to specify at least one prefix delimiter")
-	}
-
-	// make sure the path we're going to be moving items into exists and is accessible (only necessary if r.delete is
-	// false
-	if !r.delete {
-		err = r.target.CheckPath()
-		if err != nil {
-			return errors.New(err.Error())
-		}
-	}
-
-	// get a list of all the items in the directory we're managing
-	files, err := r.source.Contents()
-	if err != nil {
-		return errors.New(err.Error())
-	}
-
-	// for each item
-	for _, f := range files {
-		// if it's a file
-		if !f.IsDir() {
-			var message string
-			fileName := strings.TrimSuffix(f.Name(), path.Ext(f.Name()))
-			for _, prefix := range r.prefixDelimiters {
-				result := strings.Split(fileName, prefix)
-				if len(result) > 1 {
-					// if the delete flag is set, delete the file
-					if r.delete {
-						err = os.Remove(r.source.path + string(os.PathSeparator) + f.Name())
-						message = "Deleted the file " + f.Name() + " in the path " + r.source.path + "."
-					} else {
-						// otherwise, create the new directory if necessary
-						if _, err := os.Stat(r.target.path + string(os.PathSeparator) + result[0]); os.IsNotExist(err) {
-							err = os.MkdirAll(r.target.path+string(os.PathSeparator)+result[0], 0755)
-							if err != nil {
-								return errors.New(err.Error())
-							}
-						}
-						// and stat the full path of the new file we want to create
-						_, newFileLocationStatErr := os.Stat(r.target.path + string(os.PathSeparator) + result[0] + string(os.PathSeparator) + f.Name())
-						// and check for an IsNotExist error, which means a file by that name doesn't already exist
-						// in the new location and we're safe to move it there
-						if os.IsNotExist(newFileLocationStatErr) {
-							err = os.Rename(r.source.path+string(os.PathSeparator)+f.Name(), r.target.path+string(os.PathSeparator)+result[0]+string(os.PathSeparator)+f.Name())
-							message = "Moved the file " + f.Name() + " from the path " + r.source.path + " to " + r.target.path + string(os.PathSeparator) + result[0] + "."
-						} else {
-							// if there was no error, it means a file by that name does already exist in the new
-							// location, so lets try appending numbers to the end of the filename and redo the stat
-							// check up to 9998 times (which is an entirely arbitrary limit)
-							if newFileLocationStatErr == nil {
-								for i := 0; i < 9999; i++ {
-									appendedFileName := strings.TrimRight(f.Name(), filepath.Ext(f.Name())) + strconv.Itoa(i) + filepath.Ext(f.Name())
-									if _, newFileLocationStatErr := os.Stat(r.target.path + string(os.PathSeparator) + result[0] + string(os.PathSeparator) + appendedFileName); os.IsNotExist(newFileLocationStatErr) {
-										err = os.Rename(r.source.path+string(os.PathSeparator)+f.Name(), r.target.path+string(os.PathSeparator)+result[0]+string(os.PathSeparator)+appendedFileName)
-										message = "Moved the file " + f.Name() + " from the path " + r.source.path + " to " + r.target.path + string(os.PathSeparator) + result[0] + " (renamed to " + appendedFileName + ") because a file with the same name already exists there."
-										break
-									}
-									if i == 9998 {
-										message = "Didn't move the file " + f.Name() + " from the path " + r.source.path + " to " + r.target.path + string(os.PathSeparator) + result[0] + " because a file with the same name already exists there."
-									}
-								}
-								// if there was an error, let's register it as such
-							} else {
-								err = errors.New("Couldn't move the file " + f.Name() + " from the path " + r.source.path + " to " + r.target.path + string(os.PathSeparator) + result[0] + " (" + newFileLocationStatErr.Error() + ").")
-							}
-						}
-					}
-					if err != nil {
-						return errors.New(err.Error())
-					}
-					logStandard.Println(message)
-					continue
+// loggingFlags returns the logging settings in config with the logging flags applied on top of them. The level and
+// format flags only replace the configured ones if they were given (or there aren't any), -log-to replaces the
+// configured destinations (keeping the settings of the configured ones of the same type), and -log-file sets the path
+// of every File destination.
+func loggingFlags(config *dirculese.LoggingConfig) (loggingConf dirculese.LoggingConfig) {
+	if config != nil {
+		loggingConf = *config
+	}
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	if given["log-level"] || loggingConf.Level == "" {
+		loggingConf.Level = flagLogLevel
+	}
+	if given["log-format"] || loggingConf.Format == "" {
+		loggingConf.Format = flagLogFormat
+	}
+
+	destinations := loggingConf.Destinations
+	if given["log-to"] {
+		destinations = nil
+		for _, name := range dirculese.SplitNames(flagLogTo) {
+			destinationConf := dirculese.LogDestinationConfig{Type: name}
+			destinationType, _ := dirculese.LogDestinationType(name)
+			for _, configured := range loggingConf.Destinations {
+				if configuredType, _ := dirculese.LogDestinationType(configured.Type); destinationType != "" && configuredType == destinationType {
+					destinationConf = configured
+					break
 				}
 			}
+			destinations = append(destinations, destinationConf)
 		}
 	}
-	return
-}
-
-// SuffixHandler iterates through all of the files in a rule's r.source directory and handles any file whose name
-// portion (excluding extension) includes a substring that matches any member of the the r.suffixDelimiters slice.
-// Matching files are either deleted (depending on the boolean state of r.delete) or moved into a subdirectory of
-// r.target. The name of this subdirectory will be the portion of the filename that follows the suffix delimiter and
-// the subdirectory will be automatically created if it does not already exist.
-func (r *Rule) SuffixHandler() (err error) {
-
-	if len(r.suffixDelimiters) == 0 {
-		return errors.New("you need to specify at least one suffix delimiter")
-	}
-
-	// make sure the path we're going to be moving items into exists and is accessible (only necessary if r.delete is
-	// false
-	if !r.delete {
-		err = r.target.CheckPath()
-		if err != nil {
-			return errors.New(err.Error())
-		}
-	}
-
-	// get a list of all the items in the directory we're managing
-	files, err := r.source.Contents()
-	if err != nil {
-		return errors.New(err.Error())
+	if len(destinations) == 0 {
+		destinations = []dirculese.LogDestinationConfig{{Type: dirculese.LogDestinationFile}}
 	}
-
-	// for each item
-	for _, f := range files {
-		// if it's a file
-		if !f.IsDir() {
-			var message string
-			fileName := strings.TrimSuffix(f.Name(), path.Ext(f.Name()))
-			for _, suffix := range r.suffixDelimiters {
-				result := strings.Split(fileName, suffix)
-				if len(result) > 1 {
-					// if the delete flag is set, delete the file
-					if r.delete {
-						err = os.Remove(r.source.path + string(os.PathSeparator) + f.Name())
-						message = "Deleted the file " + f.Name() + " in the path " + r.source.path + "."
-					} else {
-						// otherwise, create the new directory if necessary
-						if _, err := os.Stat(r.target.path + string(os.PathSeparator) + result[1]); os.IsNotExist(err) {
-							err = os.MkdirAll(r.target.path+string(os.PathSeparator)+result[1], 0755)
-							if err != nil {
-								return errors.New(err.Error())
-							}
-						}
-						// and stat the full path of the new file we want to create
-						_, newFileLocationStatErr := os.Stat(r.target.path + string(os.PathSeparator) + result[1] + string(os.PathSeparator) + f.Name())
-						// and check for an IsNotExist error, which means a file by that name doesn't already exist
-						// in the new location and we're safe to move it there
-						if os.IsNotExist(newFileLocationStatErr) {
-							err = os.Rename(r.source.path+string(os.PathSeparator)+f.Name(), r.target.path+string(os.PathSeparator)+result[1]+string(os.PathSeparator)+f.Name())
-							message = "Moved the file " + f.Name() + " from the path " + r.source.path + " to " + r.target.path + string(os.PathSeparator) + result[1] + "."
-						} else {
-							// if there was no error, it means a file by that name does already exist in the new
-							// location, so lets try appending numbers to the end of the filename and redo the stat
-							// check up to 9998 times (which is an entirely arbitrary limit)
-							if newFileLocationStatErr == nil {
-								for i := 0; i < 9999; i++ {
-									appendedFileName := strings.TrimRight(f.Name(), filepath.Ext(f.Name())) + strconv.Itoa(i) + filepath.Ext(f.Name())
-									if _, newFileLocationStatErr := os.Stat(r.target.path + string(os.PathSeparator) + result[1] + string(os.PathSeparator) + appendedFileName); os.IsNotExist(newFileLocationStatErr) {
-										err = os.Rename(r.source.path+string(os.PathSeparator)+f.Name(), r.target.path+string(os.PathSeparator)+result[1]+string(os.PathSeparator)+appendedFileName)
-										message = "Moved the file " + f.Name() + " from the path " + r.source.path + " to " + r.target.path + string(os.PathSeparator) + result[1] + " (renamed to " + appendedFileName + ") because a file with the same name already exists there."
-										break
-									}
-									if i == 9998 {
-										message = "Didn't move the file " + f.Name() + " from the path " + r.source.path + " to " + r.target.path + string(os.PathSeparator) + result[1] + " because a file with the same name already exists there."
-									}
-								}
-								// if there was an error, let's register it as such
-							} else {
-								err = errors.New("Couldn't move the file " + f.Name() + " from the path " + r.source.path + " to " + r.target.path + string(os.PathSeparator) + result[1] + " (" + newFileLocationStatErr.Error() + ").")
-							}
-						}
-					}
-					if err != nil {
-						return errors.New(err.Error())
-					}
-					logStandard.Println(message)
-					continue
-				}
-			}
+	loggingConf.Destinations = make([]dirculese.LogDestinationConfig, len(destinations))
+	for i, destinationConf := range destinations {
+		if destinationType, _ := dirculese.LogDestinationType(destinationConf.Type); destinationType == dirculese.LogDestinationFile && flagLogFile != "" {
+			destinationConf.Path = flagLogFile
 		}
+		loggingConf.Destinations[i] = destinationConf
 	}
 	return
 }
 
 // GetConfigFilePath returns the full path to the user's dirculese configuration file. If a -config flag was specified,
-// its argument will be used verbatim. Otherwise, the path to the user's home directory will be prepended to the OS's
-// path separator and the constant DefaultConfigFile.
+// its argument will be used verbatim, followed by the DIRCULESE_CONFIG environment variable. Otherwise, the first of
+// the ConfigSearchPaths that exists is used, falling back to the first of them (config.json in the user's XDG config
+// directory) if none of them do.
 func GetConfigFilePath() (path string, err error) {
 	path = ""
-	if flagConfig == "" {
-		path, err = GetUserHome()
-		if err != nil {
-			return
-		}
-		path += string(os.PathSeparator) + DefaultConfigFile
-	} else {
-		path = flagConfig
+	if flagConfig != "" {
+		return flagConfig, nil
 	}
-	return
-}
-
-// GetConfigStruct loads a JSON file from the given path on the filesystem and maps its contents to a DirectoriesConfig
-// struct.
-func GetConfigStruct(path string) (conf DirectoriesConfig, err error) {
-	conf = DirectoriesConfig{}
-	confFile, err := os.Open(path)
+	if path = os.Getenv(ConfigEnvironmentVariable); path != "" {
+		return
+	}
+	searchPaths, err := dirculese.ConfigSearchPaths()
 	if err != nil {
 		return
 	}
-	decoder := json.NewDecoder(confFile)
-	decoder.Decode(&conf)
-	if len(conf.Directories) < 1 {
-		err = errors.New("your configuration file should include at least one directory")
+	for _, searchPath := range searchPaths {
+		if _, statErr := os.Stat(searchPath); statErr == nil {
+			return searchPath, nil
+		}
 	}
-	return
+	return searchPaths[0], nil
 }
 
-// GetDirectories creates an array of Directories (including the rules associated with each one) based on the contents
-// of a DirectoriesConfig struct.
-func GetDirectories(config DirectoriesConfig) (directories []Directory) {
-	for _, directoryConf := range config.Directories {
-		d := Directory{}
-		d.path = directoryConf.Path
-		for _, ruleConf := range directoryConf.Rules {
-			rule := Rule{}
-			targetDirectory := Directory{path: ruleConf.Target}
-			rule.source = &d
-			rule.target = &targetDirectory
-			rule.delete = ruleConf.Delete
-			rule.handler = ruleConf.Handler
-			rule.extensions = ruleConf.Extensions
-			rule.prefixDelimiters = ruleConf.PrefixDelimiters
-			rule.suffixDelimiters = ruleConf.SuffixDelimiters
-			rule.sizeMax = ruleConf.SizeMax
-			rule.sizeMin = ruleConf.SizeMin
-			rule.dateMax = ruleConf.DateMax
-			rule.dateMin = ruleConf.DateMin
-			d.rules = append(d.rules, rule)
+// Validate is the validate command. It loads the configuration file, prints every problem with it and returns an
+// error if there were any.
+func Validate(configFilePath string) (err error) {
+	_, err = dirculese.GetConfigStruct(configFilePath, flagFormat)
+	if errs, ok := err.(dirculese.ConfigErrors); ok {
+		for _, configError := range errs {
+			// errors in included files already say which file they're in
+			if configError.File == "" {
+				configError.File = configFilePath
+			}
+			fmt.Println(configError.Error())
 		}
-		directories = append(directories, d)
+		return errors.New("found " + strconv.Itoa(len(errs)) + " problem(s) in the configuration file '" + configFilePath + "'")
 	}
-	return
-}
-
-// GetSampleConfig generates a sample dirculese configuration file.
-func GetSampleConfig() (config string) {
-	config = `{"Directories":[{"Path":"/path/to/a/source/directory/that/you/want/to/keep/organized/with/dirculese/rules","Rules":[{"Target":"/path/to/a/destination/directory/where/items/matching/your/rule/will/be/moved","Delete":false,"Handler":"ExtensionHandler","Extensions":["png"],"PrefixDelimiters":["__"],"SuffixDelimiters":["--"],"SizeMax":0,"SizeMin":0,"DateMax":0,"DateMin":0}]}]}`
-	return
-}
-
-// GetUserHome returns the runtime user's home directory.
-func GetUserHome() (home string, err error) {
-	currentUser, _ := user.Current()
-	home = currentUser.HomeDir
-	if home == "" {
-		err = errors.New("can't find your home directory (try using the -config flag with the full path to your config file)")
+	if err != nil {
+		fmt.Println(configFilePath + ": " + err.Error())
+		return errors.New(err.Error())
 	}
+	fmt.Println("The configuration file '" + configFilePath + "' is valid.")
 	return
 }
 
-// ValidateConfigFile checks to see if the configuration file at the provided path exists on the filesystem and is in
-// JSON format.
-func ValidateConfigFile(path string) (err error) {
-	var configFile *os.File
-	configFile, err = os.Open(path)
+func main() {
+
+	// parse the command line and setup logging
+	command, err := ParseCommandLine(os.Args[1:])
 	if err != nil {
-		return errors.New(err.Error())
+		log.Fatalln("Whoops: " + err.Error() + ".")
 	}
-	defer configFile.Close()
-	confContents, err := ioutil.ReadAll(configFile)
+	err = SetupLogging(nil)
 	if err != nil {
-		return errors.New(err.Error())
+		log.Fatalln("Whoops: " + err.Error() + ".")
 	}
-	if !json.Valid(confContents) {
-		return errors.New("the JSON in your configuration file cannot be validated")
-	}
-	return
-}
-
-func main() {
 
 	// load the configuration file
 	configFilePath, err := GetConfigFilePath()
@@ -567,43 +392,128 @@ func main() {
 		logError.Fatalln(message)
 	}
 
-	// validate that the configuration file exists and is in json format
-	err = ValidateConfigFile(configFilePath)
+	if command == "validate" {
+		err = Validate(configFilePath)
+		if err != nil {
+			logError.Fatalln(err.Error())
+		}
+		os.Exit(0)
+	}
+
+	if command == "init" {
+		err = dirculese.Init(os.Stdin, os.Stdout, flagOutput)
+		if err != nil {
+			logError.Fatalln("Whoops: " + err.Error() + ".")
+		}
+		os.Exit(0)
+	}
+
+	if command == "paths" {
+		err = Paths()
+		if err != nil {
+			logError.Fatalln("Whoops: " + err.Error() + ".")
+		}
+		os.Exit(0)
+	}
+
+	if command == "handlers" {
+		err = Handlers()
+		if err != nil {
+			logError.Fatalln("Whoops: " + err.Error() + ".")
+		}
+		os.Exit(0)
+	}
+
+	if command == "migrate" {
+		err = dirculese.Migrate(configFilePath, flagFormat, flagOutput)
+		if err != nil {
+			logError.Fatalln("Whoops, couldn't migrate your configuration file '" + configFilePath + "':\n" + err.Error())
+		}
+		fmt.Println("Wrote the configuration file '" + configFilePath + "' to '" + flagOutput + "'.")
+		os.Exit(0)
+	}
+
+	// validate that the configuration file exists and can be parsed
+	err = dirculese.ValidateConfigFile(configFilePath, flagFormat)
 
 	if err != nil {
 		message := "Whoops, there is a problem loading or parsing your configuration file '"
 		message += configFilePath
 		message += "': "
 		message += err.Error()
-		message += ". Here's what a valid Dirculese configuration file looks like: "
-		message += GetSampleConfig()
+		message += ". Run 'dirculese init' to create a configuration file, or here's what a valid Dirculese configuration file looks like: "
+		message += dirculese.GetSampleConfig()
 		message += " See https://github.com/moismailzai/dirculese for more information."
 		logError.Fatalln(message)
 	}
 
 	// map the configuration file to a configuration struct
-	configStruct, err := GetConfigStruct(configFilePath)
+	configStruct, err := dirculese.GetConfigStruct(configFilePath, flagFormat)
 
 	if err != nil {
 		message := "Whoops, your configuration file '"
 		message += configFilePath
-		message += "' is incorrectly formatted: "
+		message += "' has problems:\n"
 		message += err.Error()
-		message += ". Here's what a valid Dirculese configuration file looks like: "
-		message += GetSampleConfig()
+		message += "\nHere's what a valid Dirculese configuration file looks like: "
+		message += dirculese.GetSampleConfig()
 		message += " See https://github.com/moismailzai/dirculese for more information."
 		logError.Fatalln(message)
 	}
 
-	// use the configuration struct to build directories and rules
-	directories := GetDirectories(configStruct)
+	// switch to the log destinations in the configuration file, if it has any
+	if configStruct.Logging != nil {
+		err = SetupLogging(configStruct.Logging)
+		if err != nil {
+			logError.Fatalln("Whoops: " + err.Error() + ".")
+		}
+	}
+
+	// use the configuration struct to build an engine that runs the selected directories and rules
+	engine, err := dirculese.New(configStruct, dirculese.Options{Logger: logStandard, ErrorLogger: logError, DryRun: flagDryRun, TimeBudget: flagTimeBudget})
+	if err != nil {
+		logError.Fatalln("Whoops: " + err.Error() + ".")
+	}
+	err = engine.Select(dirculese.SplitNames(flagDirectories), dirculese.SplitNames(flagRules))
+	if err != nil {
+		logError.Fatalln("Whoops: " + err.Error() + ".")
+	}
+
+	// report on the run if a report file was asked for
+	var reporter *dirculese.Reporter
+	if flagReport != "" {
+		if dirculese.ReportFormat(flagReport) == "" {
+			logError.Fatalln("Whoops, can't tell the format of the report '" + flagReport + "' from its extension (use .md, .html or .json).")
+		}
+		reporter = dirculese.NewReporter(engine)
+	}
 
-	for _, directory := range directories {
-		err := directory.Ruler()
+	// collect metrics about the run if they're served or written to a file
+	metrics := dirculese.NewMetrics()
+	metrics.Subscribe(engine)
+	if flagMetricsAddress != "" {
+		address, err := ServeMetrics(flagMetricsAddress, metrics)
 		if err != nil {
-			logError.Fatalln(err.Error())
+			logError.Fatalln("Whoops, couldn't serve the metrics: " + err.Error() + ".")
+		}
+		logStandard.Log(dirculese.LogEntry{Level: dirculese.LevelDebug, Message: "Serving metrics at http://" + address + MetricsPath + "."})
+	}
+
+	err = engine.Run(interruptContext())
+	if flagMetricsFile != "" {
+		if metricsErr := metrics.WriteFile(flagMetricsFile); metricsErr != nil {
+			logError.Log(dirculese.LogEntry{Level: dirculese.LevelWarn, Message: "Couldn't write the metrics file '" + flagMetricsFile + "'.", Err: metricsErr})
 		}
 	}
+	if reporter != nil {
+		if reportErr := reporter.Report().WriteFile(flagReport); reportErr != nil {
+			logError.Log(dirculese.LogEntry{Level: dirculese.LevelWarn, Message: "Couldn't write the report '" + flagReport + "'.", Err: reportErr})
+		}
+	}
+	if err != nil {
+		logError.Fatalln(err.Error())
+	}
 
+	logDestinations.Close()
 	os.Exit(0)
 }
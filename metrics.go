@@ -0,0 +1,26 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/moismailzai/dirculese/dirculese"
+)
+
+// MetricsPath is the path that ServeMetrics serves the metrics at.
+const MetricsPath = "/metrics"
+
+// ServeMetrics serves metrics in Prometheus' text format at the MetricsPath of an HTTP listener on address (e.g. :9251
+// or localhost:9251) until dirculese exits. It returns once the listener is ready, or an error if it couldn't be
+// started, and the address the listener ended up on (which tells the port when address doesn't have one, e.g. :0).
+func ServeMetrics(address string, metrics *dirculese.Metrics) (listening string, err error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return "", errors.New(err.Error())
+	}
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, metrics)
+	go http.Serve(listener, mux)
+	return listener.Addr().String(), nil
+}
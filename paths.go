@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/moismailzai/dirculese/dirculese"
+)
+
+// ConfigEnvironmentVariable is the environment variable that can point to a configuration file instead of the -config
+// flag.
+const ConfigEnvironmentVariable = "DIRCULESE_CONFIG"
+
+// Paths is the paths command. It prints every place that dirculese looks for its configuration file, marking the one
+// that is in effect, followed by the log file.
+func Paths() (err error) {
+	configFilePath, err := GetConfigFilePath()
+	if err != nil {
+		return
+	}
+	searchPaths, err := dirculese.ConfigSearchPaths()
+	if err != nil {
+		return
+	}
+	logFilePath := flagLogFile
+	if logFilePath == "" {
+		if logFilePath, err = dirculese.GetLogFilePath(); err != nil {
+			return
+		}
+	}
+
+	mark := func(path string, notes ...string) string {
+		line := "    " + path
+		if path == configFilePath {
+			line = "  * " + path
+		}
+		if _, statErr := os.Stat(path); statErr != nil {
+			notes = append(notes, "not found")
+		}
+		if len(notes) > 0 {
+			line += " (" + strings.Join(notes, ", ") + ")"
+		}
+		return line
+	}
+	fmt.Println("Configuration files, in the order they're searched (* is in effect):")
+	for _, source := range [][]string{{"-config flag", flagConfig}, {"$" + ConfigEnvironmentVariable, os.Getenv(ConfigEnvironmentVariable)}} {
+		if source[1] == "" {
+			fmt.Println("    " + source[0] + " (not set)")
+		} else {
+			fmt.Println(mark(source[1], "from the "+source[0]))
+		}
+	}
+	for _, path := range searchPaths {
+		fmt.Println(mark(path))
+	}
+	fmt.Println("Log file:")
+	fmt.Println("    " + logFilePath)
+	return
+}